@@ -81,6 +81,7 @@ func getMinioInstanceInfo(cli DockerClient, containerID string) (minio_adapter.M
 	}
 
 	return minio_adapter.MinioInstance{
+		ID:        strings.TrimPrefix(inspect.Name, "/"),
 		Endpoint:  fmt.Sprintf("%s:9000", ip),
 		AccessKey: accessKey,
 		SecretKey: secretKey,
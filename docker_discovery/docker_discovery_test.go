@@ -34,7 +34,8 @@ func TestDiscoverMinioInstances(t *testing.T) {
 
 	mockInspect1 := types.ContainerJSON{
 		ContainerJSONBase: &types.ContainerJSONBase{
-			ID: "container1",
+			ID:   "container1",
+			Name: "/amazin-object-storage-node-1",
 		},
 		Config: &container.Config{
 			Env: []string{
@@ -52,7 +53,8 @@ func TestDiscoverMinioInstances(t *testing.T) {
 	}
 	mockInspect2 := types.ContainerJSON{
 		ContainerJSONBase: &types.ContainerJSONBase{
-			ID: "container2",
+			ID:   "container2",
+			Name: "/amazin-object-storage-node-2",
 		},
 		Config: &container.Config{
 			Env: []string{
@@ -83,9 +85,11 @@ func TestDiscoverMinioInstances(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Len(t, instances, 2)
+	assert.Equal(t, "amazin-object-storage-node-1", instances[0].ID)
 	assert.Equal(t, "172.17.0.2:9000", instances[0].Endpoint)
 	assert.Equal(t, "access1", instances[0].AccessKey)
 	assert.Equal(t, "secret1", instances[0].SecretKey)
+	assert.Equal(t, "amazin-object-storage-node-2", instances[1].ID)
 	assert.Equal(t, "172.17.0.3:9000", instances[1].Endpoint)
 	assert.Equal(t, "access2", instances[1].AccessKey)
 	assert.Equal(t, "secret2", instances[1].SecretKey)
@@ -125,7 +129,8 @@ func TestGetMinioInstanceInfo(t *testing.T) {
 
 	mockInspect := types.ContainerJSON{
 		ContainerJSONBase: &types.ContainerJSONBase{
-			ID: "container1",
+			ID:   "container1",
+			Name: "/amazin-object-storage-node-1",
 		},
 		Config: &container.Config{
 			Env: []string{
@@ -146,6 +151,7 @@ func TestGetMinioInstanceInfo(t *testing.T) {
 	instance, err := getMinioInstanceInfo(mockClient, "container1")
 
 	assert.NoError(t, err)
+	assert.Equal(t, "amazin-object-storage-node-1", instance.ID)
 	assert.Equal(t, "172.17.0.2:9000", instance.Endpoint)
 	assert.Equal(t, "access1", instance.AccessKey)
 	assert.Equal(t, "secret1", instance.SecretKey)
@@ -158,7 +164,8 @@ func TestGetMinioInstanceInfo_NoIP(t *testing.T) {
 
 	mockInspect := types.ContainerJSON{
 		ContainerJSONBase: &types.ContainerJSONBase{
-			ID: "container1",
+			ID:   "container1",
+			Name: "/amazin-object-storage-node-1",
 		},
 		Config: &container.Config{
 			Env: []string{
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+const (
+	// maxBatchDeleteIDs matches the S3 limit for a single DeleteObjects call.
+	maxBatchDeleteIDs = 1000
+	// batchStatConcurrency bounds the lookups in flight per instance.
+	batchStatConcurrency = 16
+)
+
+const (
+	deleteStatusDeleted  = "deleted"
+	deleteStatusNotFound = "not_found"
+	deleteStatusError    = "error"
+)
+
+type batchDeleteResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type batchDeleteResponse struct {
+	Results []batchDeleteResult `json:"results"`
+}
+
+// HandleBatchDelete removes the objects listed in the request body and
+// reports the outcome for each ID. IDs are grouped by the instance owning
+// them so every instance gets a single RemoveObjects call. Like S3, missing
+// objects are reported as deleted unless reportMissing is set, which costs a
+// lookup per ID.
+func (h *Handler) HandleBatchDelete(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	log := h.logger.WithField("bucket", bucketName)
+
+	var req struct {
+		IDs           []string `json:"ids"`
+		ReportMissing bool     `json:"reportMissing"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "At least one ID is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxBatchDeleteIDs {
+		http.Error(w, fmt.Sprintf("At most %d IDs can be deleted at once", maxBatchDeleteIDs), http.StatusBadRequest)
+		return
+	}
+
+	if bucketName != h.defaultBucket {
+		if _, ok := h.locate(w, r, bucketName, ""); !ok {
+			return
+		}
+	}
+
+	results := make(map[string]batchDeleteResult, len(req.IDs))
+	groups := make(map[minio_adapter.MinioClientInterface][]string)
+	for _, id := range req.IDs {
+		if _, seen := results[id]; seen {
+			continue
+		}
+		if err := validateID(id); err != nil {
+			results[id] = batchDeleteResult{ID: id, Status: deleteStatusError, Error: err.Error()}
+			continue
+		}
+		client, err := h.getMinioClient(h.placementKey(bucketName, id))
+		if err != nil {
+			results[id] = batchDeleteResult{ID: id, Status: deleteStatusError, Error: err.Error()}
+			continue
+		}
+		// Reserve the ID so duplicates are skipped, the group fills it in.
+		results[id] = batchDeleteResult{ID: id}
+		groups[client] = append(groups[client], id)
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for client, ids := range groups {
+		wg.Add(1)
+		go func(client minio_adapter.MinioClientInterface, ids []string) {
+			defer wg.Done()
+			groupResults := h.deleteFrom(r.Context(), client, bucketName, ids, req.ReportMissing, log)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, result := range groupResults {
+				results[result.ID] = result
+			}
+		}(client, ids)
+	}
+	wg.Wait()
+	// The sizes of the deleted objects are not known, so the bucket is
+	// counted again before its next upload.
+	if h.quotas != nil {
+		h.quotas.invalidate(bucketName)
+	}
+
+	resp := batchDeleteResponse{Results: make([]batchDeleteResult, 0, len(results))}
+	for _, id := range req.IDs {
+		if result, ok := results[id]; ok {
+			resp.Results = append(resp.Results, result)
+			delete(results, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// deleteFrom removes ids from bucketName on a single instance. MinIO reports
+// no error for objects that do not exist, so with reportMissing each ID is
+// looked up first to tell deleted objects from missing ones.
+func (h *Handler) deleteFrom(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName string, ids []string, reportMissing bool, log *logrus.Entry) []batchDeleteResult {
+	results := make([]batchDeleteResult, len(ids))
+	fail := func(err error) []batchDeleteResult {
+		for i, id := range ids {
+			results[i] = batchDeleteResult{ID: id, Status: deleteStatusError, Error: err.Error()}
+		}
+		return results
+	}
+
+	if bucketName == h.defaultBucket {
+		if err := h.ensureDefaultBucket(ctx, client); err != nil {
+			log.WithError(err).Error("Failed to create default bucket")
+			return fail(err)
+		}
+	}
+
+	for i, id := range ids {
+		results[i] = batchDeleteResult{ID: id, Status: deleteStatusDeleted}
+	}
+	if reportMissing {
+		h.findMissing(ctx, client, bucketName, results, log)
+	}
+
+	index := make(map[string]int, len(ids))
+	var existing []string
+	for i, result := range results {
+		if result.Status == deleteStatusDeleted {
+			index[result.ID] = i
+			existing = append(existing, result.ID)
+		}
+	}
+	if len(existing) == 0 {
+		return results
+	}
+
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, id := range existing {
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: id}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for removeErr := range client.RemoveObjects(ctx, bucketName, objectsCh, minio.RemoveObjectsOptions{}) {
+		i, ok := index[removeErr.ObjectName]
+		if !ok {
+			continue
+		}
+		log.WithError(removeErr.Err).WithField("id", removeErr.ObjectName).Error("Failed to delete object")
+		results[i] = batchDeleteResult{ID: removeErr.ObjectName, Status: deleteStatusError, Error: removeErr.Err.Error()}
+	}
+	return results
+}
+
+// findMissing looks up the objects of results, marking those that do not
+// exist as not found and those that could not be looked up as failed.
+func (h *Handler) findMissing(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName string, results []batchDeleteResult, log *logrus.Entry) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchStatConcurrency)
+	for i, result := range results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			_, err := client.StatObject(ctx, bucketName, id, minio.StatObjectOptions{})
+			if err == nil {
+				return
+			}
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				results[i] = batchDeleteResult{ID: id, Status: deleteStatusNotFound}
+				return
+			}
+			log.WithError(err).WithField("id", id).Error("Failed to stat object")
+			results[i] = batchDeleteResult{ID: id, Status: deleteStatusError, Error: err.Error()}
+		}(i, result.ID)
+	}
+	wg.Wait()
+}
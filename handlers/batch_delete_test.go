@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestHandleBatchDelete(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	notFound := minio.ErrorResponse{Code: "NoSuchKey"}
+
+	tests := []struct {
+		name           string
+		bucket         string
+		body           string
+		setupMocks     func(first, second *mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "Mixed results",
+			bucket: "testbucket",
+			body:   `{"ids":["abc123","missing","bad-id","abc123","broken"],"reportMissing":true}`,
+			setupMocks: func(first, second *mocks.MockMinioClient) {
+				first.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+				first.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, nil)
+				first.On("StatObject", mock.Anything, "testbucket", "missing", mock.Anything).Return(minio.ObjectInfo{}, notFound)
+				first.On("StatObject", mock.Anything, "testbucket", "broken", mock.Anything).Return(minio.ObjectInfo{}, nil)
+				first.On("RemoveObjects", mock.Anything, "testbucket", mock.MatchedBy(func(names []string) bool {
+					return assert.ElementsMatch(t, []string{"abc123", "broken"}, names)
+				}), mock.Anything).Return([]minio.RemoveObjectError{{ObjectName: "broken", Err: errors.New("access denied")}})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"results":[` +
+				`{"id":"abc123","status":"deleted"},` +
+				`{"id":"missing","status":"not_found"},` +
+				`{"id":"bad-id","status":"error","error":"ID must contain only alphanumeric characters"},` +
+				`{"id":"broken","status":"error","error":"access denied"}]}`,
+		},
+		{
+			name:   "Default bucket is deleted from every owning instance",
+			bucket: DefaultBucketName,
+			body:   `{"ids":["abc123","def456"]}`,
+			setupMocks: func(first, second *mocks.MockMinioClient) {
+				for _, m := range []*mocks.MockMinioClient{first, second} {
+					m.On("BucketExists", mock.Anything, DefaultBucketName).Return(true, nil)
+				}
+				first.On("RemoveObjects", mock.Anything, DefaultBucketName, []string{"abc123"}, mock.Anything).Return(nil)
+				second.On("RemoveObjects", mock.Anything, DefaultBucketName, []string{"def456"}, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[{"id":"abc123","status":"deleted"},{"id":"def456","status":"deleted"}]}`,
+		},
+		{
+			name:   "Missing objects are deleted by default",
+			bucket: "testbucket",
+			body:   `{"ids":["abc123","missing"]}`,
+			setupMocks: func(first, second *mocks.MockMinioClient) {
+				first.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+				first.On("RemoveObjects", mock.Anything, "testbucket", []string{"abc123", "missing"}, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[{"id":"abc123","status":"deleted"},{"id":"missing","status":"deleted"}]}`,
+		},
+		{
+			name:   "Nothing to remove",
+			bucket: "testbucket",
+			body:   `{"ids":["missing"],"reportMissing":true}`,
+			setupMocks: func(first, second *mocks.MockMinioClient) {
+				first.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+				first.On("StatObject", mock.Anything, "testbucket", "missing", mock.Anything).Return(minio.ObjectInfo{}, notFound)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[{"id":"missing","status":"not_found"}]}`,
+		},
+		{
+			name:   "Missing bucket",
+			bucket: "testbucket",
+			body:   `{"ids":["abc123"]}`,
+			setupMocks: func(first, second *mocks.MockMinioClient) {
+				first.On("BucketExists", mock.Anything, "testbucket").Return(false, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Bucket not found",
+		},
+		{
+			name:           "No IDs",
+			bucket:         "testbucket",
+			body:           `{"ids":[]}`,
+			setupMocks:     func(first, second *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "At least one ID is required",
+		},
+		{
+			name:           "Too many IDs",
+			bucket:         "testbucket",
+			body:           `{"ids":["a"` + strings.Repeat(`,"a"`, maxBatchDeleteIDs) + `]}`,
+			setupMocks:     func(first, second *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "At most 1000 IDs can be deleted at once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := new(mocks.MockMinioClient)
+			second := new(mocks.MockMinioClient)
+			tt.setupMocks(first, second)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(key string) (minio_adapter.MinioClientInterface, error) {
+				if key == "def456" {
+					return second, nil
+				}
+				return first, nil
+			}
+
+			r := chi.NewRouter()
+			r.Post("/buckets/{bucketName}/objects:delete", h.HandleBatchDelete)
+
+			req, _ := http.NewRequest("POST", "/buckets/"+tt.bucket+"/objects:delete", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedBody, strings.TrimSpace(rr.Body.String()))
+			first.AssertExpectations(t)
+			second.AssertExpectations(t)
+		})
+	}
+}
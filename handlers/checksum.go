@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"expvar"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+var checksumMismatches = expvar.NewMap("checksum_mismatches")
+
+type checksumAlgorithm struct {
+	// name is the algorithm's key in the Repr-Digest header.
+	name string
+	// header carries the digest on uploads.
+	header      string
+	metadataKey string
+	size        int
+	newHash     func() hash.Hash
+}
+
+var checksumAlgorithms = []checksumAlgorithm{
+	{name: "md5", header: "Content-MD5", metadataKey: internalMetadataPrefix + "Checksum-Md5", size: md5.Size, newHash: md5.New},
+	{name: "sha-256", header: "X-Checksum-SHA256", metadataKey: internalMetadataPrefix + "Checksum-Sha256", size: sha256.Size, newHash: sha256.New},
+	{name: "crc32c", header: "X-Checksum-CRC32C", metadataKey: internalMetadataPrefix + "Checksum-Crc32c", size: crc32.Size, newHash: func() hash.Hash {
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}},
+}
+
+type checksum struct {
+	algorithm checksumAlgorithm
+	digest    []byte
+}
+
+type checksumMismatchError struct {
+	algorithm string
+}
+
+func (e checksumMismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch", e.algorithm)
+}
+
+// Is keeps mismatches from counting against the instance the data was
+// streamed to or from.
+func (e checksumMismatchError) Is(target error) bool {
+	return target == minio_adapter.ErrInvalidInput
+}
+
+// requestChecksums reads the base64 digests a client sent with an upload.
+// The error is meant for the client.
+func requestChecksums(r *http.Request) ([]checksum, error) {
+	var checksums []checksum
+	for _, algorithm := range checksumAlgorithms {
+		value := r.Header.Get(algorithm.header)
+		if value == "" {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(digest) != algorithm.size {
+			return nil, fmt.Errorf("Invalid %s header", algorithm.header)
+		}
+		checksums = append(checksums, checksum{algorithm: algorithm, digest: digest})
+	}
+	return checksums, nil
+}
+
+// storedChecksums returns the digests recorded when the object was uploaded.
+func storedChecksums(info minio.ObjectInfo) []checksum {
+	var checksums []checksum
+	for _, algorithm := range checksumAlgorithms {
+		digest, err := base64.StdEncoding.DecodeString(info.UserMetadata[algorithm.metadataKey])
+		if err != nil || len(digest) != algorithm.size {
+			continue
+		}
+		checksums = append(checksums, checksum{algorithm: algorithm, digest: digest})
+	}
+	return checksums
+}
+
+// addChecksumMetadata records checksums with the object being uploaded.
+func addChecksumMetadata(opts *minio.PutObjectOptions, checksums []checksum) {
+	for _, c := range checksums {
+		if opts.UserMetadata == nil {
+			opts.UserMetadata = make(map[string]string)
+		}
+		opts.UserMetadata[c.algorithm.metadataKey] = base64.StdEncoding.EncodeToString(c.digest)
+	}
+}
+
+// setDigestHeaders advertises checksums both as Repr-Digest (RFC 9530) and
+// as the older Digest header (RFC 3230).
+func setDigestHeaders(w http.ResponseWriter, checksums []checksum) {
+	if len(checksums) == 0 {
+		return
+	}
+	reprDigest := make([]string, len(checksums))
+	digest := make([]string, len(checksums))
+	for i, c := range checksums {
+		encoded := base64.StdEncoding.EncodeToString(c.digest)
+		reprDigest[i] = fmt.Sprintf("%s=:%s:", c.algorithm.name, encoded)
+		digest[i] = fmt.Sprintf("%s=%s", strings.ToUpper(c.algorithm.name), encoded)
+	}
+	w.Header().Set("Repr-Digest", strings.Join(reprDigest, ", "))
+	w.Header().Set("Digest", strings.Join(digest, ","))
+}
+
+// checksumReader hashes everything read through it and, once the underlying
+// reader is exhausted, replaces io.EOF with a checksumMismatchError if any
+// digest differs. Failing the final read keeps minio-go from completing an
+// upload with bad data.
+type checksumReader struct {
+	reader    io.Reader
+	checksums []checksum
+	hashes    []hash.Hash
+}
+
+func newChecksumReader(reader io.Reader, checksums []checksum) *checksumReader {
+	hashes := make([]hash.Hash, len(checksums))
+	for i, c := range checksums {
+		hashes[i] = c.algorithm.newHash()
+	}
+	return &checksumReader{reader: reader, checksums: checksums, hashes: hashes}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	for _, h := range c.hashes {
+		h.Write(p[:n])
+	}
+	if err == io.EOF {
+		for i, expected := range c.checksums {
+			if !bytes.Equal(c.hashes[i].Sum(nil), expected.digest) {
+				return n, checksumMismatchError{algorithm: expected.algorithm.name}
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func sha256Base64(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestChecksumReader(t *testing.T) {
+	checksums, err := requestChecksums(httptest.NewRequest("PUT", "/", nil))
+	assert.NoError(t, err)
+	assert.Empty(t, checksums)
+
+	req := httptest.NewRequest("PUT", "/", nil)
+	req.Header.Set("Content-MD5", "XUFAKrxLKna5cZ2REBfFkg==")
+	req.Header.Set("X-Checksum-SHA256", sha256Base64("hello"))
+	req.Header.Set("X-Checksum-CRC32C", "mnG7TA==")
+	checksums, err = requestChecksums(req)
+	assert.NoError(t, err)
+
+	content, err := io.ReadAll(newChecksumReader(strings.NewReader("hello"), checksums))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	_, err = io.ReadAll(newChecksumReader(strings.NewReader("hellO"), checksums))
+	assert.Equal(t, checksumMismatchError{algorithm: "md5"}, err)
+	assert.ErrorIs(t, err, minio_adapter.ErrInvalidInput)
+
+	req.Header.Set("X-Checksum-SHA256", "not base64")
+	_, err = requestChecksums(req)
+	assert.EqualError(t, err, "Invalid X-Checksum-SHA256 header")
+}
+
+// uploadClient drains upload bodies like minio-go does, failing the upload
+// when the body cannot be read.
+type uploadClient struct {
+	*mocks.MockMinioClient
+	opts minio.PutObjectOptions
+}
+
+func (c *uploadClient) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	if _, err := io.ReadAll(reader); err != nil {
+		return minio.UploadInfo{}, err
+	}
+	c.opts = opts
+	return minio.UploadInfo{ETag: "v1"}, nil
+}
+
+func TestHandlePutObjectChecksum(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Matching checksum", "hello", http.StatusOK, ""},
+		{"Corrupted body", "hellO", http.StatusBadRequest, "Checksum mismatch: sha-256\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+			client := &uploadClient{MockMinioClient: mockClient}
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return client, nil
+			}
+
+			r := chi.NewRouter()
+			r.Put("/buckets/{bucketName}/objects/{id}", h.HandlePutObject)
+
+			req, _ := http.NewRequest("PUT", "/buckets/testbucket/objects/abc123", bytes.NewBufferString(tt.body))
+			req.Header.Set("X-Checksum-SHA256", sha256Base64("hello"))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, sha256Base64("hello"), client.opts.UserMetadata["Gateway-Checksum-Sha256"])
+			} else {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleGetObjectDigest(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	info := minio.ObjectInfo{
+		Size:         5,
+		UserMetadata: map[string]string{"Gateway-Checksum-Sha256": sha256Base64("hello")},
+	}
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+		Return(&readerObject{Reader: strings.NewReader("hellO"), info: info}, nil)
+
+	h := NewHandler(nil, logger)
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Get("/buckets/{bucketName}/objects/{id}", h.HandleGetObject)
+
+	req, _ := http.NewRequest("GET", "/buckets/testbucket/objects/abc123", nil)
+	rr := httptest.NewRecorder()
+
+	mismatches := func() string {
+		if v := checksumMismatches.Get("download"); v != nil {
+			return v.String()
+		}
+		return "0"
+	}
+	before := mismatches()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "sha-256=:"+sha256Base64("hello")+":", rr.Header().Get("Repr-Digest"))
+	assert.Equal(t, "SHA-256="+sha256Base64("hello"), rr.Header().Get("Digest"))
+	assert.Empty(t, rr.Header().Get("X-Object-Meta-Gateway-Checksum-Sha256"))
+	assert.NotEqual(t, before, mismatches())
+	mockClient.AssertExpectations(t)
+}
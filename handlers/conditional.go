@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// hasWritePreconditions reports whether a PUT or DELETE is conditional on
+// the current state of the object.
+func hasWritePreconditions(r *http.Request) bool {
+	return r.Header.Get("If-Match") != "" ||
+		r.Header.Get("If-None-Match") != "" ||
+		r.Header.Get("If-Unmodified-Since") != ""
+}
+
+// evaluatePreconditions checks the conditional headers of r against the
+// object described by info, in the order of RFC 9110 section 13.2.2. exists
+// is false when the object is missing. It returns the status to answer with,
+// or 0 if the request should proceed.
+func evaluatePreconditions(r *http.Request, info minio.ObjectInfo, exists bool) int {
+	etag := quoteETag(info.ETag)
+	lastModified := info.LastModified.Truncate(time.Second)
+	isRead := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !exists || !etagListMatches(ifMatch, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && exists {
+		if lastModified.After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if exists && etagListMatches(ifNoneMatch, etag, true) {
+			if isRead {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && exists && isRead {
+		if !lastModified.After(since) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// etagListMatches reports whether etag is listed in an If-Match or
+// If-None-Match header. The weak comparison ignores W/ prefixes, the strong
+// one never matches a weak tag.
+func etagListMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
+
+// setValidators sets the ETag and Last-Modified headers clients use for
+// conditional requests.
+func setValidators(w http.ResponseWriter, etag string, lastModified time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", quoteETag(etag))
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// respondPrecondition answers a request whose preconditions did not hold.
+func respondPrecondition(w http.ResponseWriter, info minio.ObjectInfo, status int) {
+	if status == http.StatusNotModified {
+		setValidators(w, info.ETag, info.LastModified)
+		w.WriteHeader(status)
+		return
+	}
+	http.Error(w, "Precondition failed", status)
+}
+
+// statForWrite looks up the object a conditional PUT or DELETE targets,
+// writing an error response on failure. exists is false if there is no such
+// object yet.
+func (h *Handler) statForWrite(w http.ResponseWriter, r *http.Request, ref objectRef) (info minio.ObjectInfo, exists, ok bool) {
+	info, err := ref.client.StatObject(r.Context(), ref.bucket, ref.id, minio.StatObjectOptions{VersionID: ref.versionID})
+	if err == nil {
+		return info, true, true
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return minio.ObjectInfo{}, false, true
+	}
+	if h.respondUnavailable(w, err) {
+		return minio.ObjectInfo{}, false, false
+	}
+	h.logger.WithError(err).WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+	}).Error("Failed to stat object")
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+	return minio.ObjectInfo{}, false, false
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestEvaluatePreconditions(t *testing.T) {
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	info := minio.ObjectInfo{ETag: "v1", LastModified: modified}
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name     string
+		method   string
+		headers  map[string]string
+		exists   bool
+		expected int
+	}{
+		{"No conditions", "GET", nil, true, 0},
+		{"If-None-Match hit", "GET", map[string]string{"If-None-Match": `"v0", "v1"`}, true, http.StatusNotModified},
+		{"If-None-Match weak hit", "HEAD", map[string]string{"If-None-Match": `W/"v1"`}, true, http.StatusNotModified},
+		{"If-None-Match miss", "GET", map[string]string{"If-None-Match": `"v0"`}, true, 0},
+		{"If-Modified-Since not modified", "GET", map[string]string{"If-Modified-Since": after}, true, http.StatusNotModified},
+		{"If-Modified-Since modified", "GET", map[string]string{"If-Modified-Since": before}, true, 0},
+		{"If-None-Match overrides If-Modified-Since", "GET", map[string]string{"If-None-Match": `"v0"`, "If-Modified-Since": after}, true, 0},
+		{"If-Match hit", "PUT", map[string]string{"If-Match": `"v1"`}, true, 0},
+		{"If-Match miss", "PUT", map[string]string{"If-Match": `"v0"`}, true, http.StatusPreconditionFailed},
+		{"If-Match weak tag", "DELETE", map[string]string{"If-Match": `W/"v1"`}, true, http.StatusPreconditionFailed},
+		{"If-Match on missing object", "PUT", map[string]string{"If-Match": "*"}, false, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since modified", "DELETE", map[string]string{"If-Unmodified-Since": before}, true, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since unmodified", "DELETE", map[string]string{"If-Unmodified-Since": after}, true, 0},
+		{"Create only on existing object", "PUT", map[string]string{"If-None-Match": "*"}, true, http.StatusPreconditionFailed},
+		{"Create only on missing object", "PUT", map[string]string{"If-None-Match": "*"}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			assert.Equal(t, tt.expected, evaluatePreconditions(req, info, tt.exists))
+		})
+	}
+}
+
+func TestConditionalObjectRequests(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	info := minio.ObjectInfo{ETag: "v1", LastModified: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), ContentType: "text/plain", Size: 4}
+	notFound := minio.ErrorResponse{Code: "NoSuchKey"}
+
+	tests := []struct {
+		name           string
+		method         string
+		headers        map[string]string
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedETag   string
+	}{
+		{
+			name:    "GET not modified",
+			method:  "GET",
+			headers: map[string]string{"If-None-Match": `"v1"`},
+			setupMock: func(m *mocks.MockMinioClient) {
+				object := new(mocks.MockMinioObject)
+				object.On("Stat").Return(info, nil)
+				object.On("Close").Return(nil)
+				m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(object, nil)
+			},
+			expectedStatus: http.StatusNotModified,
+			expectedETag:   `"v1"`,
+		},
+		{
+			name:    "PUT create only on existing object",
+			method:  "PUT",
+			headers: map[string]string{"If-None-Match": "*"},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(info, nil)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:    "PUT create only on missing object",
+			method:  "PUT",
+			headers: map[string]string{"If-None-Match": "*"},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, notFound)
+				m.On("PutObject", mock.Anything, "testbucket", "abc123", mock.Anything, int64(-1), mock.Anything).Return(minio.UploadInfo{ETag: "v2"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"v2"`,
+		},
+		{
+			name:    "PUT loses a race",
+			method:  "PUT",
+			headers: map[string]string{"If-Match": `"v1"`},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(info, nil)
+				m.On("PutObject", mock.Anything, "testbucket", "abc123", mock.Anything, int64(-1), mock.Anything).Return(minio.UploadInfo{}, minio.ErrorResponse{Code: "PreconditionFailed"})
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:    "DELETE with stale ETag",
+			method:  "DELETE",
+			headers: map[string]string{"If-Match": `"v0"`},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(info, nil)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:    "DELETE with current ETag",
+			method:  "DELETE",
+			headers: map[string]string{"If-Match": `"v1"`},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(info, nil)
+				m.On("RemoveObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Route("/buckets/{bucketName}/objects", func(r chi.Router) {
+				r.Put("/{id}", h.HandlePutObject)
+				r.Get("/{id}", h.HandleGetObject)
+				r.Delete("/{id}", h.HandleDeleteObject)
+			})
+
+			var body io.Reader
+			if tt.method == "PUT" {
+				body = bytes.NewBufferString("data")
+			}
+			req, _ := http.NewRequest(tt.method, "/buckets/testbucket/objects/abc123", body)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedETag != "" {
+				assert.Equal(t, tt.expectedETag, rr.Header().Get("ETag"))
+			}
+			if tt.expectedStatus == http.StatusNotModified {
+				assert.Empty(t, strings.TrimSpace(rr.Body.String()))
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
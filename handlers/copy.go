@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// errCopyMismatch means the destination of a copy does not match its source.
+var errCopyMismatch = errors.New("copied object does not match its source")
+
+type copyRequest struct {
+	Bucket string `json:"bucket"`
+	ID     string `json:"id"`
+}
+
+type copyResponse struct {
+	Bucket string `json:"bucket"`
+	ID     string `json:"id"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// HandleCopyObject copies an object to the bucket and ID in the request body.
+func (h *Handler) HandleCopyObject(w http.ResponseWriter, r *http.Request) {
+	h.copyObject(w, r, false)
+}
+
+// HandleMoveObject copies an object like HandleCopyObject and removes the
+// source once the copy has been verified.
+func (h *Handler) HandleMoveObject(w http.ResponseWriter, r *http.Request) {
+	h.copyObject(w, r, true)
+}
+
+func (h *Handler) copyObject(w http.ResponseWriter, r *http.Request, move bool) {
+	var req copyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	src, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	if req.Bucket == "" {
+		req.Bucket = src.bucket
+	}
+	if err := validateID(req.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Bucket == src.bucket && req.ID == src.id {
+		http.Error(w, "Source and destination must differ", http.StatusBadRequest)
+		return
+	}
+	dst, ok := h.locate(w, r, req.Bucket, req.ID)
+	if !ok {
+		return
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket":            src.bucket,
+		"id":                src.id,
+		"destinationBucket": dst.bucket,
+		"destinationId":     dst.id,
+	})
+
+	info, err := src.client.StatObject(r.Context(), src.bucket, src.id, minio.StatObjectOptions{})
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			http.Error(w, "Object not found", http.StatusNotFound)
+			return
+		}
+		log.WithError(err).Error("Failed to stat object")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	reservation, ok := h.reserveQuota(w, r, dst, info.Size)
+	if !ok {
+		return
+	}
+	h.noteExpiring(dst.bucket, info.UserMetadata)
+	copied, err := h.copyBetween(r, src, dst, info)
+	if err != nil {
+		reservation.release()
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		switch {
+		case minio.ToErrorResponse(err).Code == "PreconditionFailed":
+			http.Error(w, "Object changed during copy", http.StatusConflict)
+		case errors.As(err, &checksumMismatchError{}):
+			checksumMismatches.Add("copy", 1)
+			log.WithError(err).Error("Copied object does not match its source")
+			http.Error(w, "Failed to copy object", http.StatusInternalServerError)
+		default:
+			log.WithError(err).Error("Failed to copy object")
+			http.Error(w, "Failed to copy object", http.StatusInternalServerError)
+		}
+		return
+	}
+	reservation.commit(copied.Size)
+
+	if move {
+		if err := src.client.RemoveObject(r.Context(), src.bucket, src.id, minio.RemoveObjectOptions{}); err != nil {
+			if h.respondUnavailable(w, err) {
+				return
+			}
+			log.WithError(err).Error("Failed to remove source of moved object")
+			http.Error(w, "Object was copied but the source could not be removed", http.StatusInternalServerError)
+			return
+		}
+		// A versioned bucket keeps the source as a noncurrent version.
+		if h.quotas != nil && !h.knownVersioned(src.bucket) {
+			h.quotas.add(src.bucket, -info.Size, -1)
+		}
+		log.Info("Moved object")
+	} else {
+		log.Info("Copied object")
+	}
+
+	setValidators(w, copied.ETag, copied.LastModified)
+	w.Header().Set("Location", fmt.Sprintf("/buckets/%s/objects/%s", dst.bucket, dst.id))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(copyResponse{Bucket: dst.bucket, ID: dst.id, ETag: copied.ETag, Size: copied.Size})
+}
+
+// copyBetween copies the object described by info from src to dst and
+// returns the stat of the copy. Objects that stay on the same instance are
+// copied by MinIO, others are streamed through the gateway. Either way the
+// source must still match info, and the copy is checked against it.
+func (h *Handler) copyBetween(r *http.Request, src, dst objectRef, info minio.ObjectInfo) (minio.ObjectInfo, error) {
+	ctx := r.Context()
+	if src.client == dst.client {
+		_, err := dst.client.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: dst.bucket, Object: dst.id},
+			minio.CopySrcOptions{Bucket: src.bucket, Object: src.id, MatchETag: info.ETag})
+		if err != nil {
+			return minio.ObjectInfo{}, err
+		}
+	} else {
+		getOpts := minio.GetObjectOptions{}
+		if err := getOpts.SetMatchETag(info.ETag); err != nil {
+			return minio.ObjectInfo{}, err
+		}
+		object, err := h.getObject(ctx, src.client, src.bucket, src.id, getOpts)
+		if err != nil {
+			return minio.ObjectInfo{}, err
+		}
+		defer object.Close()
+
+		putOpts := copyPutOptions(info)
+		// Tags are not part of the object's metadata and have to be fetched.
+		if info.UserTagCount > 0 {
+			t, err := src.client.GetObjectTagging(ctx, src.bucket, src.id, minio.GetObjectTaggingOptions{})
+			if err != nil {
+				return minio.ObjectInfo{}, err
+			}
+			putOpts.UserTags = t.ToMap()
+		}
+
+		reader := newChecksumReader(object, storedChecksums(info))
+		_, err = dst.client.PutObject(ctx, dst.bucket, dst.id, reader, info.Size, putOpts)
+		if err != nil {
+			return minio.ObjectInfo{}, err
+		}
+	}
+
+	copied, err := dst.client.StatObject(ctx, dst.bucket, dst.id, minio.StatObjectOptions{})
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	if !sameContent(info, copied) {
+		return copied, errCopyMismatch
+	}
+	return copied, nil
+}
+
+// sameContent reports whether two objects agree on size, content type and
+// user metadata, which includes any recorded checksums.
+func sameContent(a, b minio.ObjectInfo) bool {
+	if a.Size != b.Size || a.ContentType != b.ContentType || len(a.UserMetadata) != len(b.UserMetadata) {
+		return false
+	}
+	for key, value := range a.UserMetadata {
+		if b.UserMetadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// copyPutOptions returns the options that store an object with the same
+// representation headers and metadata as the one described by info.
+func copyPutOptions(info minio.ObjectInfo) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{
+		ContentType:        info.ContentType,
+		ContentEncoding:    info.Metadata.Get("Content-Encoding"),
+		ContentDisposition: info.Metadata.Get("Content-Disposition"),
+		CacheControl:       info.Metadata.Get("Cache-Control"),
+	}
+	if len(info.UserMetadata) > 0 {
+		opts.UserMetadata = make(map[string]string, len(info.UserMetadata))
+		for key, value := range info.UserMetadata {
+			opts.UserMetadata[key] = value
+		}
+	}
+	return opts
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestHandleCopyObject(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	source := minio.ObjectInfo{
+		Size:         5,
+		ContentType:  "text/plain",
+		ETag:         "5a105e8b9d40e1329780d62ea2265d8a",
+		Metadata:     http.Header{"Cache-Control": []string{"no-cache"}},
+		UserMetadata: map[string]string{"Owner": "alice", "Gateway-Checksum-Sha256": sha256Base64("hello")},
+	}
+	copied := source
+	copied.ETag = "6b105e8b9d40e1329780d62ea2265d8a"
+
+	tests := []struct {
+		name           string
+		action         string
+		body           string
+		sameInstance   bool
+		setupMocks     func(src, dst *mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:         "Copy on the same instance",
+			action:       "copy",
+			body:         `{"bucket":"dstbucket","id":"def456"}`,
+			sameInstance: true,
+			setupMocks: func(src, dst *mocks.MockMinioClient) {
+				src.On("StatObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(source, nil)
+				src.On("CopyObject", mock.Anything,
+					minio.CopyDestOptions{Bucket: "dstbucket", Object: "def456"},
+					minio.CopySrcOptions{Bucket: "srcbucket", Object: "abc123", MatchETag: source.ETag}).
+					Return(minio.UploadInfo{}, nil)
+				src.On("StatObject", mock.Anything, "dstbucket", "def456", mock.Anything).Return(copied, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"bucket":"dstbucket","id":"def456","etag":"6b105e8b9d40e1329780d62ea2265d8a","size":5}` + "\n",
+		},
+		{
+			name:   "Copy across instances",
+			action: "copy",
+			body:   `{"bucket":"dstbucket","id":"def456"}`,
+			setupMocks: func(src, dst *mocks.MockMinioClient) {
+				src.On("StatObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(source, nil)
+				src.On("GetObject", mock.Anything, "srcbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("hello")}, nil)
+				dst.On("PutObject", mock.Anything, "dstbucket", "def456", mock.Anything, int64(5), mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+					return opts.ContentType == "text/plain" && opts.CacheControl == "no-cache" && opts.UserMetadata["Owner"] == "alice"
+				})).Run(func(args mock.Arguments) {
+					content, err := io.ReadAll(args.Get(3).(io.Reader))
+					assert.NoError(t, err)
+					assert.Equal(t, "hello", string(content))
+				}).Return(minio.UploadInfo{Size: 5}, nil)
+				dst.On("StatObject", mock.Anything, "dstbucket", "def456", mock.Anything).Return(copied, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"bucket":"dstbucket","id":"def456","etag":"6b105e8b9d40e1329780d62ea2265d8a","size":5}` + "\n",
+		},
+		{
+			name:   "Copy across instances keeps tags",
+			action: "copy",
+			body:   `{"bucket":"dstbucket","id":"def456"}`,
+			setupMocks: func(src, dst *mocks.MockMinioClient) {
+				tagged := source
+				tagged.UserTagCount = 1
+				projectTags, _ := tags.NewTags(map[string]string{"project": "alpha"}, true)
+				src.On("StatObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(tagged, nil)
+				src.On("GetObject", mock.Anything, "srcbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("hello")}, nil)
+				src.On("GetObjectTagging", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(projectTags, nil)
+				dst.On("PutObject", mock.Anything, "dstbucket", "def456", mock.Anything, int64(5), mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+					return opts.UserTags["project"] == "alpha"
+				})).Return(minio.UploadInfo{Size: 5}, nil)
+				dst.On("StatObject", mock.Anything, "dstbucket", "def456", mock.Anything).Return(copied, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"bucket":"dstbucket","id":"def456","etag":"6b105e8b9d40e1329780d62ea2265d8a","size":5}` + "\n",
+		},
+		{
+			name:   "Move removes the source",
+			action: "move",
+			body:   `{"bucket":"dstbucket","id":"def456"}`,
+			setupMocks: func(src, dst *mocks.MockMinioClient) {
+				src.On("StatObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(source, nil)
+				src.On("GetObject", mock.Anything, "srcbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("hello")}, nil)
+				dst.On("PutObject", mock.Anything, "dstbucket", "def456", mock.Anything, int64(5), mock.Anything).
+					Return(minio.UploadInfo{Size: 5}, nil)
+				dst.On("StatObject", mock.Anything, "dstbucket", "def456", mock.Anything).Return(copied, nil)
+				src.On("RemoveObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"bucket":"dstbucket","id":"def456","etag":"6b105e8b9d40e1329780d62ea2265d8a","size":5}` + "\n",
+		},
+		{
+			name:   "Move keeps the source when the copy does not match",
+			action: "move",
+			body:   `{"bucket":"dstbucket","id":"def456"}`,
+			setupMocks: func(src, dst *mocks.MockMinioClient) {
+				src.On("StatObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(source, nil)
+				src.On("GetObject", mock.Anything, "srcbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("hello")}, nil)
+				dst.On("PutObject", mock.Anything, "dstbucket", "def456", mock.Anything, int64(5), mock.Anything).
+					Return(minio.UploadInfo{Size: 5}, nil)
+				dst.On("StatObject", mock.Anything, "dstbucket", "def456", mock.Anything).Return(minio.ObjectInfo{Size: 4}, nil)
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "Failed to copy object\n",
+		},
+		{
+			name:   "Move keeps the source when the stream is corrupted",
+			action: "move",
+			body:   `{"bucket":"dstbucket","id":"def456"}`,
+			setupMocks: func(src, dst *mocks.MockMinioClient) {
+				src.On("StatObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(source, nil)
+				src.On("GetObject", mock.Anything, "srcbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("hellp")}, nil)
+				dst.On("PutObject", mock.Anything, "dstbucket", "def456", mock.Anything, int64(5), mock.Anything).
+					Run(func(args mock.Arguments) {
+						_, err := io.ReadAll(args.Get(3).(io.Reader))
+						assert.Equal(t, checksumMismatchError{algorithm: "sha-256"}, err)
+					}).Return(minio.UploadInfo{}, checksumMismatchError{algorithm: "sha-256"})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "Failed to copy object\n",
+		},
+		{
+			name:   "Source changed during copy",
+			action: "copy",
+			body:   `{"bucket":"dstbucket","id":"def456"}`,
+			setupMocks: func(src, dst *mocks.MockMinioClient) {
+				src.On("StatObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(source, nil)
+				src.On("GetObject", mock.Anything, "srcbucket", "abc123", mock.Anything).
+					Return(nil, minio.ErrorResponse{Code: "PreconditionFailed"})
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   "Object changed during copy\n",
+		},
+		{
+			name:   "Missing source",
+			action: "copy",
+			body:   `{"bucket":"dstbucket","id":"def456"}`,
+			setupMocks: func(src, dst *mocks.MockMinioClient) {
+				src.On("StatObject", mock.Anything, "srcbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Object not found\n",
+		},
+		{
+			name:           "Same source and destination",
+			action:         "copy",
+			body:           `{"id":"abc123"}`,
+			setupMocks:     func(src, dst *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Source and destination must differ\n",
+		},
+		{
+			name:           "Invalid destination ID",
+			action:         "copy",
+			body:           `{"bucket":"dstbucket","id":"def-456"}`,
+			setupMocks:     func(src, dst *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "ID must contain only alphanumeric characters\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcClient := new(mocks.MockMinioClient)
+			dstClient := srcClient
+			if !tt.sameInstance {
+				dstClient = new(mocks.MockMinioClient)
+			}
+			srcClient.On("BucketExists", mock.Anything, "srcbucket").Return(true, nil).Maybe()
+			dstClient.On("BucketExists", mock.Anything, "dstbucket").Return(true, nil).Maybe()
+			tt.setupMocks(srcClient, dstClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(key string) (minio_adapter.MinioClientInterface, error) {
+				if key == "dstbucket" {
+					return dstClient, nil
+				}
+				return srcClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Post("/buckets/{bucketName}/objects/{id}/copy", h.HandleCopyObject)
+			r.Post("/buckets/{bucketName}/objects/{id}/move", h.HandleMoveObject)
+
+			req, _ := http.NewRequest("POST", "/buckets/srcbucket/objects/abc123/"+tt.action, bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedBody, rr.Body.String())
+			srcClient.AssertExpectations(t)
+			dstClient.AssertExpectations(t)
+		})
+	}
+}
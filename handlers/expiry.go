@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+// expiresAfterHeader sets the lifetime of an uploaded object in seconds.
+const expiresAfterHeader = "X-Expires-After"
+
+// expiresAtKey is the metadata key the expiry of an object is kept in, as
+// Unix seconds.
+const expiresAtKey = internalMetadataPrefix + "Expires-At"
+
+const (
+	maxExpiresAfter = 100 * 365 * 24 * time.Hour
+	// expirySweepBatchSize matches the S3 limit for a single DeleteObjects
+	// call.
+	expirySweepBatchSize = 1000
+)
+
+var (
+	// expiredBacklog counts expired objects found by the running or last
+	// sweep that are not deleted yet.
+	expiredBacklog = expvar.NewInt("expired_objects_backlog")
+	expiredDeleted = expvar.NewInt("expired_objects_deleted")
+	expiredFailed  = expvar.NewInt("expired_objects_failed")
+)
+
+// parseExpiresAfter returns the expiry requested by an upload, or the zero
+// time if there is none. The error is meant for the client.
+func parseExpiresAfter(r *http.Request, now time.Time) (time.Time, error) {
+	value := r.Header.Get(expiresAfterHeader)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 1 || seconds > int64(maxExpiresAfter/time.Second) {
+		return time.Time{}, fmt.Errorf("%s must be between 1 and %d seconds", expiresAfterHeader, int64(maxExpiresAfter/time.Second))
+	}
+	return now.Add(time.Duration(seconds) * time.Second), nil
+}
+
+// objectExpiry returns when an object expires. Listings with metadata report
+// the keys with their header prefix, so both forms are accepted.
+func objectExpiry(userMetadata map[string]string) (time.Time, bool) {
+	value, ok := userMetadata[expiresAtKey]
+	if !ok {
+		value, ok = userMetadata["X-Amz-Meta-"+expiresAtKey]
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// expired reports whether the object in info has outlived its expiry. The
+// sweeper removes expired objects eventually, until then reads treat them as
+// missing.
+func expired(info minio.ObjectInfo, now time.Time) bool {
+	expiresAt, ok := objectExpiry(info.UserMetadata)
+	return ok && !now.Before(expiresAt)
+}
+
+// noteExpiring records that a bucket holds objects with an expiry, which
+// listings of it have to leave out once expired.
+func (h *Handler) noteExpiring(bucketName string, userMetadata map[string]string) {
+	if _, ok := objectExpiry(userMetadata); ok {
+		h.expiringBuckets.Store(bucketName, struct{}{})
+	}
+}
+
+// knownExpiring reports whether a bucket was seen holding objects with an
+// expiry, through an upload or copy since the gateway started or by the
+// expiry sweeper.
+func (h *Handler) knownExpiring(bucketName string) bool {
+	_, ok := h.expiringBuckets.Load(bucketName)
+	return ok
+}
+
+// RunExpirySweeper deletes expired objects every interval until ctx is done.
+func (h *Handler) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.sweepExpired(ctx, time.Now())
+		}
+	}
+}
+
+func (h *Handler) sweepExpired(ctx context.Context, now time.Time) {
+	expiredBacklog.Set(0)
+	for _, ic := range h.getAllMinioClients() {
+		log := h.logger.WithField("instance", instanceID(ic.Instance))
+		if ic.Err != nil {
+			log.WithError(ic.Err).Warn("Skipping instance in expiry sweeper")
+			continue
+		}
+		buckets, err := ic.Client.ListBuckets(ctx)
+		if err != nil {
+			log.WithError(err).Warn("Failed to list buckets for expiry sweeper")
+			continue
+		}
+		for _, bucket := range buckets {
+			h.sweepExpiredIn(ctx, ic.Client, bucket.Name, now, log.WithField("bucket", bucket.Name))
+		}
+	}
+}
+
+// sweepExpiredIn deletes the expired objects of a bucket in batches. The
+// listing may be stale by the time a batch is deleted, so every candidate
+// is looked up again first and skipped if it was overwritten since.
+func (h *Handler) sweepExpiredIn(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName string, now time.Time, log *logrus.Entry) {
+	batch := make([]string, 0, expirySweepBatchSize)
+	flush := func() {
+		h.deleteExpired(ctx, client, bucketName, batch, now, log)
+		batch = batch[:0]
+	}
+
+	objects := client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Recursive: true, WithMetadata: true})
+	for object := range objects {
+		if object.Err != nil {
+			log.WithError(object.Err).Warn("Failed to list objects for expiry sweeper")
+			break
+		}
+		h.noteExpiring(bucketName, object.UserMetadata)
+		if !expired(object, now) {
+			continue
+		}
+		expiredBacklog.Add(1)
+		batch = append(batch, object.Key)
+		if len(batch) == expirySweepBatchSize {
+			flush()
+		}
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+}
+
+func (h *Handler) deleteExpired(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName string, keys []string, now time.Time, log *logrus.Entry) {
+	var confirmed []string
+	for _, key := range keys {
+		info, err := client.StatObject(ctx, bucketName, key, minio.StatObjectOptions{})
+		switch {
+		case err == nil && expired(info, now):
+			confirmed = append(confirmed, key)
+		case err != nil && !objectNotFound(err):
+			log.WithError(err).WithField("id", key).Warn("Failed to stat expired object")
+			expiredFailed.Add(1)
+		default:
+			// Gone or overwritten without expiry in the meantime.
+			expiredBacklog.Add(-1)
+		}
+	}
+	if len(confirmed) == 0 {
+		return
+	}
+
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, key := range confirmed {
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: key}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	failed := 0
+	for removeErr := range client.RemoveObjects(ctx, bucketName, objectsCh, minio.RemoveObjectsOptions{}) {
+		log.WithError(removeErr.Err).WithField("id", removeErr.ObjectName).Warn("Failed to delete expired object")
+		failed++
+	}
+	if h.quotas != nil {
+		h.quotas.invalidate(bucketName)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	expiredFailed.Add(int64(failed))
+	expiredDeleted.Add(int64(len(confirmed) - failed))
+	expiredBacklog.Add(-int64(len(confirmed) - failed))
+	log.WithField("count", len(confirmed)-failed).Info("Deleted expired objects")
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestParseExpiresAfter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+		err      bool
+	}{
+		{"No header", "", time.Time{}, false},
+		{"Valid", "3600", now.Add(time.Hour), false},
+		{"Not a number", "1h", time.Time{}, true},
+		{"Zero", "0", time.Time{}, true},
+		{"Too far", strconv.FormatInt(int64(maxExpiresAfter/time.Second)+1, 10), time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", "/", nil)
+			if tt.value != "" {
+				req.Header.Set(expiresAfterHeader, tt.value)
+			}
+			expiresAt, err := parseExpiresAfter(req, now)
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, expiresAt)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	assert.True(t, expired(minio.ObjectInfo{UserMetadata: map[string]string{expiresAtKey: "1700000000"}}, now))
+	assert.True(t, expired(minio.ObjectInfo{UserMetadata: map[string]string{"X-Amz-Meta-" + expiresAtKey: "1699999999"}}, now))
+	assert.False(t, expired(minio.ObjectInfo{UserMetadata: map[string]string{expiresAtKey: "1700000001"}}, now))
+	assert.False(t, expired(minio.ObjectInfo{UserMetadata: map[string]string{expiresAtKey: "soon"}}, now))
+	assert.False(t, expired(minio.ObjectInfo{}, now))
+}
+
+func TestHandlePutObjectExpiry(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("PutObject", mock.Anything, "testbucket", "abc123", mock.Anything, int64(-1), mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+		expiresAt, ok := objectExpiry(opts.UserMetadata)
+		return ok && time.Until(expiresAt) > 59*time.Minute && time.Until(expiresAt) <= time.Hour
+	})).Return(minio.UploadInfo{ETag: "v1"}, nil)
+
+	h := NewHandler(nil, logger)
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Put("/buckets/{bucketName}/objects/{id}", h.HandlePutObject)
+
+	req, _ := http.NewRequest("PUT", "/buckets/testbucket/objects/abc123", bytes.NewBufferString("data"))
+	req.Header.Set(expiresAfterHeader, "3600")
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, h.knownExpiring("testbucket"))
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleGetExpiredObject(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	info := minio.ObjectInfo{
+		Size:         5,
+		UserMetadata: map[string]string{expiresAtKey: strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)},
+	}
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+		Return(&readerObject{Reader: strings.NewReader("hello"), info: info}, nil)
+
+	h := NewHandler(nil, logger)
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Get("/buckets/{bucketName}/objects/{id}", h.HandleGetObject)
+
+	req, _ := http.NewRequest("GET", "/buckets/testbucket/objects/abc123", nil)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "Object not found\n", rr.Body.String())
+}
+
+func TestSweepExpired(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	now := time.Now()
+	past := map[string]string{"X-Amz-Meta-" + expiresAtKey: strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)}
+	future := map[string]string{"X-Amz-Meta-" + expiresAtKey: strconv.FormatInt(now.Add(time.Hour).Unix(), 10)}
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{{Name: "testbucket"}}, nil)
+	mockClient.On("ListObjects", mock.Anything, "testbucket", minio.ListObjectsOptions{Recursive: true, WithMetadata: true}).
+		Return([]minio.ObjectInfo{
+			{Key: "old", UserMetadata: past},
+			{Key: "overwritten", UserMetadata: past},
+			{Key: "gone", UserMetadata: past},
+			{Key: "failing", UserMetadata: past},
+			{Key: "fresh", UserMetadata: future},
+			{Key: "plain"},
+		})
+	mockClient.On("StatObject", mock.Anything, "testbucket", "old", minio.StatObjectOptions{}).
+		Return(minio.ObjectInfo{Key: "old", UserMetadata: map[string]string{expiresAtKey: past["X-Amz-Meta-"+expiresAtKey]}}, nil)
+	mockClient.On("StatObject", mock.Anything, "testbucket", "overwritten", minio.StatObjectOptions{}).
+		Return(minio.ObjectInfo{Key: "overwritten"}, nil)
+	mockClient.On("StatObject", mock.Anything, "testbucket", "gone", minio.StatObjectOptions{}).
+		Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+	mockClient.On("StatObject", mock.Anything, "testbucket", "failing", minio.StatObjectOptions{}).
+		Return(minio.ObjectInfo{Key: "failing", UserMetadata: map[string]string{expiresAtKey: past["X-Amz-Meta-"+expiresAtKey]}}, nil)
+	mockClient.On("RemoveObjects", mock.Anything, "testbucket", []string{"old", "failing"}, minio.RemoveObjectsOptions{}).
+		Return([]minio.RemoveObjectError{{ObjectName: "failing", Err: minio.ErrorResponse{Code: "InternalError"}}})
+
+	h := NewHandler(nil, logger)
+	h.getAllMinioClients = func() []minio_adapter.InstanceClient {
+		return []minio_adapter.InstanceClient{{Instance: minio_adapter.MinioInstance{ID: "node-1"}, Client: mockClient}}
+	}
+
+	deleted, failed := expiredDeleted.Value(), expiredFailed.Value()
+	h.sweepExpired(context.Background(), now)
+
+	assert.Equal(t, deleted+1, expiredDeleted.Value())
+	assert.Equal(t, failed+1, expiredFailed.Value())
+	assert.Equal(t, int64(1), expiredBacklog.Value())
+	// Listings of the bucket leave expired objects out from now on.
+	assert.True(t, h.knownExpiring("testbucket"))
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+const deleteBucketJob = "delete-bucket"
+
+// forceDeleteBucket starts a job that aborts the uploads in progress in a
+// bucket, deletes every object version in it and then the bucket itself, and
+// responds with the job to poll. Versions under governance retention are only
+// deleted with the bypass header, locked versions make the job fail.
+func (h *Handler) forceDeleteBucket(w http.ResponseWriter, r *http.Request, bucketName string) {
+	log := h.logger.WithField("bucket", bucketName)
+
+	clients, ok := h.bucketClients(w, r, bucketName, log)
+	if !ok {
+		return
+	}
+	bypass := r.Header.Get(bypassGovernanceHeader) == "true"
+
+	job, started, err := h.jobs.Start(deleteBucketJob, bucketName, func(ctx context.Context, progress func(int64)) error {
+		err := h.emptyAndRemoveBucket(ctx, clients, bucketName, bypass, progress, log)
+		if err != nil && ctx.Err() == nil {
+			log.WithError(err).Error("Failed to force delete bucket")
+		}
+		return err
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to start job")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if started {
+		log.WithField("job", job.ID).Info("Started force delete of bucket")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *Handler) emptyAndRemoveBucket(ctx context.Context, clients []minio_adapter.MinioClientInterface, bucketName string, bypass bool, progress func(int64), log *logrus.Entry) error {
+	for _, client := range clients {
+		// Parts of unfinished uploads keep a bucket from being removed.
+		if err := abortUploads(ctx, client, bucketName, log); err != nil {
+			return err
+		}
+		if err := emptyBucket(ctx, client, bucketName, bypass, progress, log); err != nil {
+			return err
+		}
+	}
+	for _, client := range clients {
+		if err := client.RemoveBucket(ctx, bucketName); err != nil {
+			switch minio.ToErrorResponse(err).Code {
+			case "NoSuchBucket":
+			case "BucketNotEmpty":
+				return errors.New("objects were added to the bucket while it was being emptied")
+			default:
+				return err
+			}
+		}
+	}
+	for _, client := range clients {
+		removeInternalObjects(ctx, client, multipartMarkerPrefix+bucketName+"/", log)
+		removeInternalObjects(ctx, client, tusKeyPrefix+bucketName+"/", log)
+		removeInternalObjects(ctx, client, shareCounterPrefix+bucketName+"/", log)
+	}
+	h.versionedBuckets.Delete(bucketName)
+	h.expiringBuckets.Delete(bucketName)
+	if h.quotas != nil {
+		h.quotas.forget(bucketName)
+	}
+	log.Info("Force deleted bucket")
+	return nil
+}
+
+// abortUploads aborts every multipart upload in progress in bucketName on a
+// single instance.
+func abortUploads(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName string, log *logrus.Entry) error {
+	for upload := range client.ListIncompleteUploads(ctx, bucketName, "", true) {
+		if upload.Err != nil {
+			return fmt.Errorf("failed to list multipart uploads: %w", upload.Err)
+		}
+		err := client.AbortMultipartUpload(ctx, bucketName, upload.Key, upload.UploadID)
+		if err != nil && !uploadGone(err) {
+			return fmt.Errorf("failed to abort multipart upload: %w", err)
+		}
+		if err == nil {
+			abortedUploads.Add(1)
+			log.WithFields(logrus.Fields{"id": upload.Key, "uploadId": upload.UploadID}).Info("Aborted multipart upload")
+		}
+	}
+	return ctx.Err()
+}
+
+// removeInternalObjects deletes the gateway's own objects under prefix in the
+// internal bucket of an instance. Failures are only logged, the bucket they
+// belonged to is gone either way.
+func removeInternalObjects(ctx context.Context, client minio_adapter.MinioClientInterface, prefix string, log *logrus.Entry) {
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for object := range client.ListObjects(ctx, internalBucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if object.Err != nil {
+				if minio.ToErrorResponse(object.Err).Code != "NoSuchBucket" {
+					log.WithError(object.Err).Warn("Failed to list upload state")
+				}
+				return
+			}
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: object.Key}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for removeErr := range client.RemoveObjects(ctx, internalBucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		log.WithError(removeErr.Err).WithField("key", removeErr.ObjectName).Warn("Failed to remove upload state")
+	}
+}
+
+// emptyBucket deletes every version and delete marker in bucketName on a
+// single instance. The listing is streamed into RemoveObjects, which batches
+// the deletes.
+func emptyBucket(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName string, bypass bool, progress func(int64), log *logrus.Entry) error {
+	var listErr error
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for object := range client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Recursive: true, WithVersions: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: object.Key, VersionID: object.VersionID}:
+				progress(1)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	failed := 0
+	for removeErr := range client.RemoveObjects(ctx, bucketName, objectsCh, minio.RemoveObjectsOptions{GovernanceBypass: bypass}) {
+		log.WithError(removeErr.Err).WithFields(logrus.Fields{
+			"id":        removeErr.ObjectName,
+			"versionId": removeErr.VersionID,
+		}).Warn("Failed to delete object")
+		failed++
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if listErr != nil {
+		return fmt.Errorf("failed to list objects: %w", listErr)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d objects could not be deleted", failed)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacelift-io/homework-object-storage/jobs"
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestForceDeleteBucket(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	listAll := minio.ListObjectsOptions{Recursive: true, WithVersions: true}
+	noUploads := []minio.ObjectMultipartInfo{}
+	versions := []minio.ObjectInfo{
+		{Key: "a", VersionID: "v1"},
+		{Key: "a", VersionID: "v2"},
+		{Key: "b", VersionID: "null"},
+	}
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedJob    jobs.Job
+	}{
+		{
+			name: "Empties and removes the bucket",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				m.On("ListIncompleteUploads", mock.Anything, "mybucket", "", true).
+					Return([]minio.ObjectMultipartInfo{{Key: "c", UploadID: "u1"}})
+				m.On("AbortMultipartUpload", mock.Anything, "mybucket", "c", "u1").Return(nil)
+				m.On("ListObjects", mock.Anything, "mybucket", listAll).Return(versions)
+				m.On("RemoveObjects", mock.Anything, "mybucket", []string{"a", "a", "b"}, minio.RemoveObjectsOptions{}).Return(nil)
+				m.On("RemoveBucket", mock.Anything, "mybucket").Return(nil)
+				m.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: "multipart/mybucket/", Recursive: true}).
+					Return([]minio.ObjectInfo{{Key: "multipart/mybucket/c/u1"}})
+				m.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: "tus/mybucket/", Recursive: true}).
+					Return([]minio.ObjectInfo{{Key: "tus/mybucket/u2/info"}})
+				m.On("RemoveObjects", mock.Anything, internalBucket, []string{"multipart/mybucket/c/u1"}, minio.RemoveObjectsOptions{}).Return(nil)
+				m.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: "shares/mybucket/", Recursive: true}).
+					Return([]minio.ObjectInfo{{Key: "shares/mybucket/n1"}})
+				m.On("RemoveObjects", mock.Anything, internalBucket, []string{"tus/mybucket/u2/info"}, minio.RemoveObjectsOptions{}).Return(nil)
+				m.On("RemoveObjects", mock.Anything, internalBucket, []string{"shares/mybucket/n1"}, minio.RemoveObjectsOptions{}).Return(nil)
+			},
+			expectedStatus: http.StatusAccepted,
+			expectedJob:    jobs.Job{Status: jobs.StatusSucceeded, Processed: 3},
+		},
+		{
+			name:    "Bypasses governance retention",
+			headers: map[string]string{"X-Bypass-Governance-Retention": "true"},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				m.On("ListIncompleteUploads", mock.Anything, "mybucket", "", true).Return(noUploads)
+				m.On("ListObjects", mock.Anything, "mybucket", listAll).Return(versions[:1])
+				m.On("RemoveObjects", mock.Anything, "mybucket", []string{"a"}, minio.RemoveObjectsOptions{GovernanceBypass: true}).Return(nil)
+				m.On("RemoveBucket", mock.Anything, "mybucket").Return(nil)
+				m.On("ListObjects", mock.Anything, internalBucket, mock.Anything).Return([]minio.ObjectInfo{{Err: minio.ErrorResponse{Code: "NoSuchBucket"}}})
+				m.On("RemoveObjects", mock.Anything, internalBucket, []string(nil), minio.RemoveObjectsOptions{}).Return(nil)
+			},
+			expectedStatus: http.StatusAccepted,
+			expectedJob:    jobs.Job{Status: jobs.StatusSucceeded, Processed: 1},
+		},
+		{
+			name: "Locked versions fail the job",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				m.On("ListIncompleteUploads", mock.Anything, "mybucket", "", true).Return(noUploads)
+				m.On("ListObjects", mock.Anything, "mybucket", listAll).Return(versions)
+				m.On("RemoveObjects", mock.Anything, "mybucket", []string{"a", "a", "b"}, minio.RemoveObjectsOptions{}).
+					Return([]minio.RemoveObjectError{{ObjectName: "a", VersionID: "v1", Err: minio.ErrorResponse{Code: "AccessDenied"}}})
+			},
+			expectedStatus: http.StatusAccepted,
+			expectedJob:    jobs.Job{Status: jobs.StatusFailed, Processed: 3, Error: "1 objects could not be deleted"},
+		},
+		{
+			name: "Objects added while emptying",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				m.On("ListIncompleteUploads", mock.Anything, "mybucket", "", true).Return(noUploads)
+				m.On("ListObjects", mock.Anything, "mybucket", listAll).Return([]minio.ObjectInfo{})
+				m.On("RemoveObjects", mock.Anything, "mybucket", []string(nil), minio.RemoveObjectsOptions{}).Return(nil)
+				m.On("RemoveBucket", mock.Anything, "mybucket").Return(minio.ErrorResponse{Code: "BucketNotEmpty"})
+			},
+			expectedStatus: http.StatusAccepted,
+			expectedJob:    jobs.Job{Status: jobs.StatusFailed, Error: "objects were added to the bucket while it was being emptied"},
+		},
+		{
+			name: "Failing to abort an upload fails the job",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				m.On("ListIncompleteUploads", mock.Anything, "mybucket", "", true).
+					Return([]minio.ObjectMultipartInfo{{Key: "c", UploadID: "u1"}})
+				m.On("AbortMultipartUpload", mock.Anything, "mybucket", "c", "u1").Return(minio.ErrorResponse{Code: "AccessDenied", Message: "Access Denied."})
+			},
+			expectedStatus: http.StatusAccepted,
+			expectedJob:    jobs.Job{Status: jobs.StatusFailed, Error: "failed to abort multipart upload: Access Denied."},
+		},
+		{
+			name: "Bucket not found",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("BucketExists", mock.Anything, "mybucket").Return(false, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"mybucket": {MaxBytes: 10}}))
+			h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+			h.quotas.set("mybucket", bucketUsage{Bytes: 4, Objects: 3})
+
+			r := chi.NewRouter()
+			r.Delete("/buckets/{bucketName}", h.HandleDeleteBucket)
+
+			req, _ := http.NewRequest("DELETE", "/buckets/mybucket?force=true", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusAccepted {
+				var started jobs.Job
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&started))
+				assert.Equal(t, "/jobs/"+started.ID, rr.Header().Get("Location"))
+				assert.Equal(t, "delete-bucket", started.Kind)
+				assert.Equal(t, "mybucket", started.Target)
+
+				job := waitForJob(t, h, started.ID)
+				assert.Equal(t, tt.expectedJob.Status, job.Status)
+				assert.Equal(t, tt.expectedJob.Processed, job.Processed)
+				assert.Equal(t, tt.expectedJob.Error, job.Error)
+				// A bucket recreated under the same name starts empty.
+				assert.Equal(t, job.Status != jobs.StatusSucceeded, h.quotas.loaded("mybucket"))
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestJobs(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+	mockClient.On("ListIncompleteUploads", mock.Anything, "mybucket", "", true).Return([]minio.ObjectMultipartInfo{})
+	mockClient.On("ListObjects", mock.Anything, "mybucket", mock.Anything).Return([]minio.ObjectInfo{{Key: "a"}})
+	// Hold the deletes until the job is cancelled. The cancel may win the race
+	// against the listing, so the names are not checked.
+	mockClient.On("RemoveObjects", mock.Anything, "mybucket", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		}).Return(nil)
+
+	h := NewHandler(nil, logger)
+	h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Delete("/buckets/{bucketName}", h.HandleDeleteBucket)
+	r.Get("/jobs/{jobId}", h.HandleGetJob)
+	r.Delete("/jobs/{jobId}", h.HandleCancelJob)
+
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("DELETE", "/buckets/mybucket?force=true")
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	var started jobs.Job
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&started))
+
+	t.Run("Second force delete returns the running job", func(t *testing.T) {
+		rr := serve("DELETE", "/buckets/mybucket?force=true")
+		var job jobs.Job
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&job))
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Equal(t, started.ID, job.ID)
+	})
+
+	t.Run("Get running job", func(t *testing.T) {
+		rr := serve("GET", "/jobs/"+started.ID)
+		var job jobs.Job
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&job))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, jobs.StatusRunning, job.Status)
+	})
+
+	t.Run("Cancel job", func(t *testing.T) {
+		rr := serve("DELETE", "/jobs/"+started.ID)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Equal(t, jobs.StatusCancelled, waitForJob(t, h, started.ID).Status)
+		mockClient.AssertNotCalled(t, "RemoveBucket", mock.Anything, "mybucket")
+	})
+
+	t.Run("Cancel finished job", func(t *testing.T) {
+		rr := serve("DELETE", "/jobs/"+started.ID)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, "Job has already finished\n", rr.Body.String())
+	})
+
+	t.Run("Unknown job", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("GET", "/jobs/missing").Code)
+		assert.Equal(t, http.StatusNotFound, serve("DELETE", "/jobs/missing").Code)
+	})
+}
+
+func waitForJob(t *testing.T, h *Handler, id string) jobs.Job {
+	t.Helper()
+	var job jobs.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = h.jobs.Get(id)
+		return err == nil && job.Status != jobs.StatusRunning
+	}, time.Second, time.Millisecond)
+	return job
+}
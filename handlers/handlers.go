@@ -1,62 +1,137 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"errors"
-	"hash/fnv"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/sirupsen/logrus"
 
+	"github.com/spacelift-io/homework-object-storage/jobs"
 	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/share"
 )
 
 type Handler struct {
-	minioInstances []minio_adapter.MinioInstance
+	clients        *minio_adapter.ClientRegistry
 	logger         *logrus.Logger
 	getMinioClient func(id string) (minio_adapter.MinioClientInterface, error)
+	// getAllMinioClients returns a client for every instance, for operations
+	// that fan out across the cluster.
+	getAllMinioClients func() []minio_adapter.InstanceClient
+	hedger             *minio_adapter.Hedger
+	defaultBucket      string
+	ensuredBuckets     sync.Map
+	// versionedBuckets caches whether versioning is enabled per bucket name.
+	versionedBuckets sync.Map
+	// expiringBuckets holds the names of buckets seen holding objects with
+	// an expiry.
+	expiringBuckets  sync.Map
+	presignMaxExpiry time.Duration
+	// presignBaseURL replaces the instance endpoint in presigned URLs.
+	presignBaseURL string
+	shareSigner    *share.Signer
+	jobs           *jobs.Manager
+	// quotas is nil unless buckets have quotas.
+	quotas *quotaTracker
+}
+
+const DefaultBucketName = "objects"
+
+type Option func(*Handler)
+
+// WithHedgedGets hedges slow object reads according to config.
+func WithHedgedGets(config minio_adapter.HedgeConfig) Option {
+	return func(h *Handler) {
+		h.hedger = minio_adapter.NewHedger(config)
+	}
+}
+
+// WithDefaultBucket sets the bucket backing the flat /object/{id} API.
+func WithDefaultBucket(bucketName string) Option {
+	return func(h *Handler) {
+		h.defaultBucket = bucketName
+	}
 }
 
-func NewHandler(minioInstances []minio_adapter.MinioInstance, logger *logrus.Logger) *Handler {
+func NewHandler(minioInstances []minio_adapter.MinioInstance, logger *logrus.Logger, opts ...Option) *Handler {
 	h := &Handler{
-		minioInstances: minioInstances,
-		logger:         logger,
+		logger:           logger,
+		defaultBucket:    DefaultBucketName,
+		presignMaxExpiry: DefaultPresignMaxExpiry,
+		jobs:             jobs.NewManager(context.Background(), finishedJobRetention),
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.clients = minio_adapter.NewClientRegistry(minioInstances,
+		minio_adapter.WithCircuitBreaker(minio_adapter.DefaultCircuitBreakerConfig(), h.logBreakerStateChange))
 	h.getMinioClient = h.defaultGetMinioClient
+	h.getAllMinioClients = h.clients.Clients
 	return h
 }
 
 func (h *Handler) defaultGetMinioClient(id string) (minio_adapter.MinioClientInterface, error) {
-	hash := fnv.New32a()
-	hash.Write([]byte(id))
-	index := int(hash.Sum32()) % len(h.minioInstances)
-	instance := h.minioInstances[index]
-
-	client, err := minio.New(instance.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(instance.AccessKey, instance.SecretKey, ""),
-		Secure: false,
+	return h.clients.ClientForKey(id)
+}
+
+// UpdateMinioInstances swaps the set of instances requests are routed to.
+func (h *Handler) UpdateMinioInstances(minioInstances []minio_adapter.MinioInstance) {
+	if h.clients.Update(minioInstances) {
+		h.logger.WithField("instances", len(minioInstances)).Info("MinIO instance set changed, rebuilt client registry")
+	}
+}
+
+func (h *Handler) logBreakerStateChange(endpoint string, from, to minio_adapter.BreakerState) {
+	entry := h.logger.WithFields(logrus.Fields{
+		"endpoint": endpoint,
+		"from":     from.String(),
+		"to":       to.String(),
 	})
-	if err != nil {
-		return nil, err
+	if to == minio_adapter.StateOpen {
+		entry.Warn("MinIO circuit breaker opened")
+		return
+	}
+	entry.Info("MinIO circuit breaker state changed")
+}
+
+// respondUnavailable fails fast with 503 when err comes from an instance whose
+// circuit breaker is open. It reports whether a response was written.
+func (h *Handler) respondUnavailable(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, minio_adapter.ErrCircuitOpen) {
+		return false
 	}
-	return minio_adapter.NewMinioAdapter(client), nil
+	h.logger.WithError(err).Warn("MinIO instance unavailable, failing fast")
+	w.Header().Set("Retry-After", "5")
+	w.Header().Set("X-Error-Code", "InstanceUnavailable")
+	http.Error(w, "Storage instance temporarily unavailable", http.StatusServiceUnavailable)
+	return true
 }
 
 func (h *Handler) HandleCreateBucket(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		BucketName string `json:"bucketName"`
+		// ObjectLocking creates a write-once bucket. It cannot be enabled
+		// later and implies versioning.
+		ObjectLocking bool `json:"objectLocking"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.WithError(err).Error("Failed to decode request")
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.BucketName == h.defaultBucket || req.BucketName == internalBucket {
+		http.Error(w, "Bucket name is reserved", http.StatusConflict)
+		return
+	}
 
 	minioClient, err := h.getMinioClient(req.BucketName)
 	if err != nil {
@@ -65,8 +140,11 @@ func (h *Handler) HandleCreateBucket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = minioClient.MakeBucket(r.Context(), req.BucketName, minio.MakeBucketOptions{})
+	err = minioClient.MakeBucket(r.Context(), req.BucketName, minio.MakeBucketOptions{ObjectLocking: req.ObjectLocking})
 	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "Your previous request to create the named bucket succeeded") {
 			h.logger.WithField("bucketName", req.BucketName).Info("Bucket already exists")
 			http.Error(w, "Bucket already exists", http.StatusConflict)
@@ -82,13 +160,25 @@ func (h *Handler) HandleCreateBucket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Object locking implies versioning.
+	h.noteVersioning(req.BucketName, req.ObjectLocking)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Bucket created successfully"})
 }
 
+// HandleDeleteBucket removes an empty bucket. With ?force=true it starts a job
+// deleting every object in the bucket first.
 func (h *Handler) HandleDeleteBucket(w http.ResponseWriter, r *http.Request) {
 	bucketName := chi.URLParam(r, "bucketName")
+	if bucketName == h.defaultBucket || bucketName == internalBucket {
+		http.Error(w, "Bucket name is reserved", http.StatusConflict)
+		return
+	}
+	if r.URL.Query().Get("force") == "true" {
+		h.forceDeleteBucket(w, r, bucketName)
+		return
+	}
 
 	minioClient, err := h.getMinioClient(bucketName)
 	if err != nil {
@@ -99,6 +189,9 @@ func (h *Handler) HandleDeleteBucket(w http.ResponseWriter, r *http.Request) {
 
 	err = minioClient.RemoveBucket(r.Context(), bucketName)
 	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
 		minioErr, ok := err.(minio.ErrorResponse)
 		if ok {
 			switch minioErr.Code {
@@ -112,97 +205,130 @@ func (h *Handler) HandleDeleteBucket(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
-		
+
 		h.logger.WithError(err).WithField("bucket", bucketName).Error("Failed to delete bucket")
 		http.Error(w, "Failed to delete bucket", http.StatusInternalServerError)
 		return
 	}
 
+	h.versionedBuckets.Delete(bucketName)
+	h.expiringBuckets.Delete(bucketName)
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *Handler) HandlePutObject(w http.ResponseWriter, r *http.Request) {
-	bucketName := chi.URLParam(r, "bucketName")
-	id := chi.URLParam(r, "id")
-
-	if err := validateID(id); err != nil {
-		h.logger.WithField("id", id).WithError(err).Error("Invalid ID")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
 		return
 	}
 
-	minioClient, err := h.getMinioClient(bucketName)
+	opts, err := putOptions(r)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to get MinIO client")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	exists, err := minioClient.BucketExists(r.Context(), bucketName)
+	h.noteExpiring(ref.bucket, opts.UserMetadata)
+	checksums, err := requestChecksums(r)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to check bucket existence")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if !exists {
-		h.logger.WithField("bucket", bucketName).Error("Bucket does not exist")
-		http.Error(w, "Bucket not found", http.StatusNotFound)
+	addChecksumMetadata(&opts, checksums)
+	var body io.Reader = r.Body
+	if len(checksums) > 0 {
+		body = newChecksumReader(r.Body, checksums)
+	}
+	if hasWritePreconditions(r) {
+		current, exists, ok := h.statForWrite(w, r, ref)
+		if !ok {
+			return
+		}
+		if status := evaluatePreconditions(r, current, exists); status != 0 {
+			respondPrecondition(w, current, status)
+			return
+		}
+		// Have MinIO re-check what we saw, so a concurrent write between
+		// the stat and the upload still fails the precondition.
+		if exists {
+			opts.SetMatchETag(current.ETag)
+		} else {
+			opts.SetMatchETagExcept("*")
+		}
+	}
+	reservation, ok := h.reserveQuota(w, r, ref, r.ContentLength)
+	if !ok {
 		return
 	}
+	body = reservation.limit(body)
 
-	_, err = minioClient.PutObject(r.Context(), bucketName, id, r.Body, -1, minio.PutObjectOptions{})
+	info, err := ref.client.PutObject(r.Context(), ref.bucket, ref.id, body, -1, opts)
 	if err != nil {
+		reservation.release()
+		if h.respondUnavailable(w, err) || respondLocked(w, err) {
+			return
+		}
+		if errors.Is(err, errQuotaExceeded) {
+			quotaRejections.Add(1)
+			http.Error(w, "Bucket quota exceeded", http.StatusInsufficientStorage)
+			return
+		}
+		var mismatch checksumMismatchError
+		if errors.As(err, &mismatch) {
+			checksumMismatches.Add("upload", 1)
+			h.logger.WithError(err).WithFields(logrus.Fields{
+				"bucket": ref.bucket,
+				"id":     ref.id,
+			}).Warn("Rejected upload with mismatching checksum")
+			http.Error(w, "Checksum mismatch: "+mismatch.algorithm, http.StatusBadRequest)
+			return
+		}
+		if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+			http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+			return
+		}
 		h.logger.WithError(err).Error("Failed to put object")
 		http.Error(w, "Failed to store object", http.StatusInternalServerError)
 		return
 	}
 
+	reservation.commit(info.Size)
+
+	// Single part uploads do not report a modification time. MinIO stamps
+	// the object when the upload completes, which is no later than now.
+	lastModified := info.LastModified
+	if lastModified.IsZero() {
+		lastModified = time.Now()
+	}
+	setValidators(w, info.ETag, lastModified)
+	if info.VersionID != "" {
+		w.Header().Set(versionIDHeader, info.VersionID)
+	}
+	// Buckets with versioning suspended write null versions.
+	h.noteVersioning(ref.bucket, info.VersionID != "" && info.VersionID != "null")
 	w.WriteHeader(http.StatusOK)
 }
 
 func (h *Handler) HandleGetObject(w http.ResponseWriter, r *http.Request) {
-	bucketName := chi.URLParam(r, "bucketName")
-	id := chi.URLParam(r, "id")
-	
 	h.logger.WithFields(logrus.Fields{
-		"bucket": bucketName,
-		"id":     id,
+		"bucket": chi.URLParam(r, "bucketName"),
+		"id":     chi.URLParam(r, "id"),
 		"method": r.Method,
 		"path":   r.URL.Path,
 	}).Info("Received GetObject request")
 
-	if err := validateID(id); err != nil {
-		h.logger.WithFields(logrus.Fields{
-			"bucket": bucketName,
-			"id":     id,
-			"error":  err.Error(),
-		}).Error("Invalid ID")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
 		return
 	}
+	h.serveObject(w, r, requestVersion(r, ref))
+}
 
-	minioClient, err := h.getMinioClient(bucketName)
-	if err != nil {
-		h.logger.WithFields(logrus.Fields{
-			"bucket": bucketName,
-			"error":  err.Error(),
-		}).Error("Failed to get MinIO client")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+// serveObject streams the object behind ref, honoring range and conditional
+// request headers.
+func (h *Handler) serveObject(w http.ResponseWriter, r *http.Request, ref objectRef) {
+	minioClient, bucketName, id := ref.client, ref.bucket, ref.id
 
-	exists, err := minioClient.BucketExists(r.Context(), bucketName)
-	if err != nil {
-		h.logger.WithFields(logrus.Fields{
-			"bucket": bucketName,
-			"error":  err.Error(),
-		}).Error("Failed to check bucket existence")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	if !exists {
-		h.logger.WithField("bucket", bucketName).Error("Bucket does not exist")
-		http.Error(w, "Bucket not found", http.StatusNotFound)
+	if r.Header.Get("Range") != "" && h.serveRanges(w, r, ref) {
 		return
 	}
 
@@ -211,17 +337,20 @@ func (h *Handler) HandleGetObject(w http.ResponseWriter, r *http.Request) {
 		"id":     id,
 	}).Info("Attempting to get object")
 
-	object, err := minioClient.GetObject(r.Context(), bucketName, id, minio.GetObjectOptions{})
+	object, err := h.getObject(r.Context(), minioClient, bucketName, id, minio.GetObjectOptions{VersionID: ref.versionID})
 	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
 		errorResponse := minio.ToErrorResponse(err)
 		h.logger.WithFields(logrus.Fields{
-			"bucket":      bucketName,
-			"id":          id,
-			"errorCode":   errorResponse.Code,
+			"bucket":       bucketName,
+			"id":           id,
+			"errorCode":    errorResponse.Code,
 			"errorMessage": errorResponse.Message,
 		}).Error("Failed to get object")
 
-		if errorResponse.Code == "NoSuchKey" {
+		if objectNotFound(err) {
 			http.Error(w, "Object not found", http.StatusNotFound)
 		} else {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -232,6 +361,9 @@ func (h *Handler) HandleGetObject(w http.ResponseWriter, r *http.Request) {
 
 	stat, err := object.Stat()
 	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
 		h.logger.WithFields(logrus.Fields{
 			"bucket": bucketName,
 			"id":     id,
@@ -248,11 +380,27 @@ func (h *Handler) HandleGetObject(w http.ResponseWriter, r *http.Request) {
 		"size":        stat.Size,
 	}).Info("Successfully retrieved object stats")
 
-	w.Header().Set("Content-Type", stat.ContentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size))
+	if expired(stat, time.Now()) {
+		http.Error(w, "Object not found", http.StatusNotFound)
+		return
+	}
+
+	if status := evaluatePreconditions(r, stat, true); status != 0 {
+		respondPrecondition(w, stat, status)
+		return
+	}
 
-	_, err = io.Copy(w, object)
+	setObjectHeaders(w, stat)
+
+	var body io.Reader = object
+	if checksums := storedChecksums(stat); len(checksums) > 0 {
+		body = newChecksumReader(object, checksums)
+	}
+	_, err = io.Copy(w, body)
 	if err != nil {
+		if errors.As(err, &checksumMismatchError{}) {
+			checksumMismatches.Add("download", 1)
+		}
 		h.logger.WithFields(logrus.Fields{
 			"bucket": bucketName,
 			"id":     id,
@@ -267,37 +415,45 @@ func (h *Handler) HandleGetObject(w http.ResponseWriter, r *http.Request) {
 	}).Info("Successfully streamed object")
 }
 
-func (h *Handler) HandleDeleteObject(w http.ResponseWriter, r *http.Request) {
-	bucketName := chi.URLParam(r, "bucketName")
-	id := chi.URLParam(r, "id")
-
-	if err := validateID(id); err != nil {
-		h.logger.WithField("id", id).WithError(err).Error("Invalid ID")
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// getObject opens an object through the hedger when hedging is enabled.
+// Placement keeps no replicas, so there is no other instance to hedge to and
+// reads are only timed.
+func (h *Handler) getObject(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName, id string, opts minio.GetObjectOptions) (minio_adapter.MinioObject, error) {
+	if h.hedger == nil {
+		return client.GetObject(ctx, bucketName, id, opts)
 	}
+	return h.hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{client}, bucketName, id, opts)
+}
 
-	minioClient, err := h.getMinioClient(bucketName)
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to get MinIO client")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+func (h *Handler) HandleDeleteObject(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
 		return
 	}
+	ref = requestVersion(r, ref)
+	bucketName, id := ref.bucket, ref.id
 
-	exists, err := minioClient.BucketExists(r.Context(), bucketName)
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to check bucket existence")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	if !exists {
-		h.logger.WithField("bucket", bucketName).Error("Bucket does not exist")
-		http.Error(w, "Bucket not found", http.StatusNotFound)
-		return
+	// RemoveObject cannot be made conditional, so this check is best effort.
+	if hasWritePreconditions(r) {
+		current, exists, ok := h.statForWrite(w, r, ref)
+		if !ok {
+			return
+		}
+		if status := evaluatePreconditions(r, current, exists); status != 0 {
+			respondPrecondition(w, current, status)
+			return
+		}
 	}
 
-	err = minioClient.RemoveObject(r.Context(), bucketName, id, minio.RemoveObjectOptions{})
+	deleted := h.trackDelete(r.Context(), ref)
+	markerVersionID, err := h.removeObject(r.Context(), ref, minio.RemoveObjectOptions{
+		VersionID:        ref.versionID,
+		GovernanceBypass: r.Header.Get(bypassGovernanceHeader) == "true",
+	})
 	if err != nil {
+		if h.respondUnavailable(w, err) || respondLocked(w, err) {
+			return
+		}
 		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
 			h.logger.WithError(err).WithFields(logrus.Fields{
 				"bucket": bucketName,
@@ -314,6 +470,8 @@ func (h *Handler) HandleDeleteObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	deleted()
+	setDeletedVersion(w, ref, markerVersionID)
 	w.WriteHeader(http.StatusNoContent)
 }
 
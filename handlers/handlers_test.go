@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	minio "github.com/minio/minio-go/v7"
@@ -32,6 +33,7 @@ func TestHandleCreateBucket(t *testing.T) {
 	tests := []struct {
 		name           string
 		bucketName     string
+		body           string
 		mockSetup      func(*mocks.MockMinioClient)
 		expectedStatus int
 		expectedBody   string
@@ -45,6 +47,16 @@ func TestHandleCreateBucket(t *testing.T) {
 			expectedStatus: http.StatusCreated,
 			expectedBody:   `{"message":"Bucket created successfully"}`,
 		},
+		{
+			name:       "Bucket with object locking",
+			bucketName: "locked-bucket",
+			body:       `{"bucketName":"locked-bucket","objectLocking":true}`,
+			mockSetup: func(m *mocks.MockMinioClient) {
+				m.On("MakeBucket", mock.Anything, "locked-bucket", minio.MakeBucketOptions{ObjectLocking: true}).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"message":"Bucket created successfully"}`,
+		},
 		{
 			name:       "Bucket already exists",
 			bucketName: "existing-bucket",
@@ -90,8 +102,11 @@ func TestHandleCreateBucket(t *testing.T) {
 			r := chi.NewRouter()
 			r.Post("/buckets", h.HandleCreateBucket)
 
-			body := bytes.NewBufferString(fmt.Sprintf(`{"bucketName":"%s"}`, tt.bucketName))
-			req, _ := http.NewRequest("POST", "/buckets", body)
+			body := tt.body
+			if body == "" {
+				body = fmt.Sprintf(`{"bucketName":"%s"}`, tt.bucketName)
+			}
+			req, _ := http.NewRequest("POST", "/buckets", bytes.NewBufferString(body))
 			rr := httptest.NewRecorder()
 
 			r.ServeHTTP(rr, req)
@@ -500,3 +515,78 @@ func TestHandleHealthCheck(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "OK", rr.Body.String())
 }
+
+func TestHandlersFailFastWhenCircuitOpen(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	minioInstances := []minio_adapter.MinioInstance{
+		{Endpoint: "localhost:9000", AccessKey: "test", SecretKey: "test"},
+	}
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(false, minio_adapter.ErrCircuitOpen)
+
+	h := NewHandler(minioInstances, logger)
+	h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Get("/buckets/{bucketName}/objects/{id}", h.HandleGetObject)
+
+	req, _ := http.NewRequest("GET", "/buckets/testbucket/objects/testobject123", nil)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "InstanceUnavailable", rr.Header().Get("X-Error-Code"))
+	assert.Equal(t, "Storage instance temporarily unavailable\n", rr.Body.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleGetObjectHedged(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	minioInstances := []minio_adapter.MinioInstance{
+		{Endpoint: "localhost:9000", AccessKey: "test", SecretKey: "test"},
+	}
+
+	newObject := func(content string) *mocks.MockMinioObject {
+		object := new(mocks.MockMinioObject)
+		object.On("Stat").Return(minio.ObjectInfo{ContentType: "text/plain", Size: int64(len(content))}, nil)
+		object.On("Read", mock.Anything).Run(func(args mock.Arguments) {
+			copy(args.Get(0).([]byte), content)
+		}).Return(len(content), io.EOF)
+		object.On("Close").Return(nil)
+		return object
+	}
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	// With a single replica a slow read is not sent to the same instance again.
+	mockClient.On("GetObject", mock.Anything, "testbucket", "testobject123", mock.Anything).Run(func(mock.Arguments) {
+		time.Sleep(30 * time.Millisecond)
+	}).Return(newObject("slow"), nil).Once()
+
+	config := minio_adapter.DefaultHedgeConfig()
+	config.MaxDelay = 10 * time.Millisecond
+	h := NewHandler(minioInstances, logger, WithHedgedGets(config))
+	h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Get("/buckets/{bucketName}/objects/{id}", h.HandleGetObject)
+
+	req, _ := http.NewRequest("GET", "/buckets/testbucket/objects/testobject123", nil)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "slow", rr.Body.String())
+	mockClient.AssertExpectations(t)
+}
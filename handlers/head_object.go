@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// HandleHeadObject returns an object's headers without opening a data stream.
+func (h *Handler) HandleHeadObject(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	ref = requestVersion(r, ref)
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+	})
+
+	info, err := ref.client.StatObject(r.Context(), ref.bucket, ref.id, minio.StatObjectOptions{VersionID: ref.versionID})
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		if objectNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if info.IsDeleteMarker {
+			w.Header().Set(versionIDHeader, info.VersionID)
+			w.Header().Set("X-Delete-Marker", "true")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		log.WithError(err).Error("Failed to stat object")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if expired(info, time.Now()) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if status := evaluatePreconditions(r, info, true); status != 0 {
+		respondPrecondition(w, info, status)
+		return
+	}
+
+	setObjectHeaders(w, info)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestHandleHeadObject(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		setupMock       func(*mocks.MockMinioClient)
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name: "Existing object",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{
+					Size:         42,
+					ContentType:  "text/plain",
+					ETag:         "d41d8cd98f00b204e9800998ecf8427e",
+					LastModified: modified,
+					UserMetadata: map[string]string{"Owner": "alice"},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Length":      "42",
+				"Content-Type":        "text/plain",
+				"ETag":                `"d41d8cd98f00b204e9800998ecf8427e"`,
+				"Last-Modified":       "Mon, 06 May 2024 07:08:09 GMT",
+				"X-Object-Meta-Owner": "alice",
+			},
+		},
+		{
+			name: "Missing object",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "Stat failure",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, errors.New("boom"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Head("/buckets/{bucketName}/objects/{id}", h.HandleHeadObject)
+
+			req, _ := http.NewRequest("HEAD", "/buckets/testbucket/objects/abc123", nil)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Empty(t, rr.Body.String())
+			for key, value := range tt.expectedHeaders {
+				assert.Equal(t, value, rr.Header().Get(key), key)
+			}
+			mockClient.AssertNotCalled(t, "GetObject", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
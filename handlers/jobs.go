@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spacelift-io/homework-object-storage/jobs"
+)
+
+// finishedJobRetention is how long finished jobs can still be polled.
+const finishedJobRetention = time.Hour
+
+// WithJobContext runs background jobs under ctx, so they are cancelled when
+// it is done.
+func WithJobContext(ctx context.Context) Option {
+	return func(h *Handler) {
+		h.jobs = jobs.NewManager(ctx, finishedJobRetention)
+	}
+}
+
+// WaitForJobs blocks until every running background job has returned.
+func (h *Handler) WaitForJobs() {
+	h.jobs.Wait()
+}
+
+// HandleGetJob returns the state of a background job.
+func (h *Handler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Get(chi.URLParam(r, "jobId"))
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleCancelJob asks a running job to stop. Work already done is not
+// undone, the job reports cancelled once it has stopped.
+func (h *Handler) HandleCancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobId")
+	job, err := h.jobs.Cancel(jobID)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		http.Error(w, "Job has already finished", http.StatusConflict)
+		return
+	}
+
+	h.logger.WithField("job", jobID).Info("Cancelled job")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxLifecycleRules matches the S3 limit per bucket.
+	maxLifecycleRules = 1000
+	maxRuleIDLength   = 255
+)
+
+const (
+	ruleEnabled  = "Enabled"
+	ruleDisabled = "Disabled"
+)
+
+// lifecycleRule is the gateway's form of a MinIO lifecycle rule. A rule
+// applies to the objects matching its prefix and all of its tags.
+type lifecycleRule struct {
+	ID     string            `json:"id"`
+	Status string            `json:"status"`
+	Prefix string            `json:"prefix,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	// ExpireAfterDays deletes the current version of matching objects.
+	ExpireAfterDays int `json:"expireAfterDays,omitempty"`
+	// NoncurrentExpireAfterDays deletes versions that stopped being current.
+	NoncurrentExpireAfterDays int `json:"noncurrentExpireAfterDays,omitempty"`
+	// AbortIncompleteUploadAfterDays aborts multipart uploads never completed.
+	AbortIncompleteUploadAfterDays int `json:"abortIncompleteUploadAfterDays,omitempty"`
+}
+
+type lifecycleConfiguration struct {
+	Rules []lifecycleRule `json:"rules"`
+}
+
+// validate checks the rules and fills in defaults. The error is meant for
+// the client.
+func (c *lifecycleConfiguration) validate() error {
+	if len(c.Rules) == 0 {
+		return errors.New("At least one rule is required")
+	}
+	if len(c.Rules) > maxLifecycleRules {
+		return fmt.Errorf("At most %d rules are allowed", maxLifecycleRules)
+	}
+	seen := make(map[string]bool, len(c.Rules))
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.ID == "" || len(rule.ID) > maxRuleIDLength {
+			return fmt.Errorf("Rule %d: id must be between 1 and %d characters", i+1, maxRuleIDLength)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("Rule %s: duplicate id", rule.ID)
+		}
+		seen[rule.ID] = true
+
+		switch rule.Status {
+		case "":
+			rule.Status = ruleEnabled
+		case ruleEnabled, ruleDisabled:
+		default:
+			return fmt.Errorf("Rule %s: status must be %s or %s", rule.ID, ruleEnabled, ruleDisabled)
+		}
+		if len(rule.Tags) > 0 {
+			if _, err := tags.NewTags(rule.Tags, true); err != nil {
+				return fmt.Errorf("Rule %s: invalid tags: %v", rule.ID, err)
+			}
+		}
+
+		if rule.ExpireAfterDays == 0 && rule.NoncurrentExpireAfterDays == 0 && rule.AbortIncompleteUploadAfterDays == 0 {
+			return fmt.Errorf("Rule %s: at least one action is required", rule.ID)
+		}
+		if rule.ExpireAfterDays < 0 || rule.NoncurrentExpireAfterDays < 0 || rule.AbortIncompleteUploadAfterDays < 0 {
+			return fmt.Errorf("Rule %s: days must be positive", rule.ID)
+		}
+		// Multipart uploads have no tags to match until they complete.
+		if rule.AbortIncompleteUploadAfterDays > 0 && len(rule.Tags) > 0 {
+			return fmt.Errorf("Rule %s: aborting incomplete uploads cannot be combined with a tag filter", rule.ID)
+		}
+	}
+	return nil
+}
+
+// toLifecycle translates validated rules into a MinIO lifecycle
+// configuration.
+func (c lifecycleConfiguration) toLifecycle() *lifecycle.Configuration {
+	config := lifecycle.NewConfiguration()
+	for _, rule := range c.Rules {
+		r := lifecycle.Rule{
+			ID:     rule.ID,
+			Status: rule.Status,
+			Expiration: lifecycle.Expiration{
+				Days: lifecycle.ExpirationDays(rule.ExpireAfterDays),
+			},
+			NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+				NoncurrentDays: lifecycle.ExpirationDays(rule.NoncurrentExpireAfterDays),
+			},
+			AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: lifecycle.ExpirationDays(rule.AbortIncompleteUploadAfterDays),
+			},
+		}
+
+		var ruleTags []lifecycle.Tag
+		for key, value := range rule.Tags {
+			ruleTags = append(ruleTags, lifecycle.Tag{Key: key, Value: value})
+		}
+		sort.Slice(ruleTags, func(i, j int) bool {
+			return ruleTags[i].Key < ruleTags[j].Key
+		})
+		switch {
+		case len(ruleTags) == 0:
+			r.RuleFilter.Prefix = rule.Prefix
+		case len(ruleTags) == 1 && rule.Prefix == "":
+			r.RuleFilter.Tag = ruleTags[0]
+		default:
+			r.RuleFilter.And = lifecycle.And{Prefix: rule.Prefix, Tags: ruleTags}
+		}
+		config.Rules = append(config.Rules, r)
+	}
+	return config
+}
+
+// fromLifecycle translates a MinIO lifecycle configuration back into rules.
+func fromLifecycle(config *lifecycle.Configuration) lifecycleConfiguration {
+	resp := lifecycleConfiguration{Rules: []lifecycleRule{}}
+	if config == nil {
+		return resp
+	}
+	for _, r := range config.Rules {
+		rule := lifecycleRule{
+			ID:                             r.ID,
+			Status:                         r.Status,
+			Prefix:                         r.RuleFilter.Prefix,
+			ExpireAfterDays:                int(r.Expiration.Days),
+			NoncurrentExpireAfterDays:      int(r.NoncurrentVersionExpiration.NoncurrentDays),
+			AbortIncompleteUploadAfterDays: int(r.AbortIncompleteMultipartUpload.DaysAfterInitiation),
+		}
+		// Rules written before filters existed keep the prefix on the rule.
+		if rule.Prefix == "" {
+			rule.Prefix = r.Prefix
+		}
+		ruleTags := r.RuleFilter.And.Tags
+		if !r.RuleFilter.And.IsEmpty() {
+			rule.Prefix = r.RuleFilter.And.Prefix
+		}
+		if !r.RuleFilter.Tag.IsEmpty() {
+			ruleTags = append(ruleTags, r.RuleFilter.Tag)
+		}
+		for _, tag := range ruleTags {
+			if rule.Tags == nil {
+				rule.Tags = make(map[string]string)
+			}
+			rule.Tags[tag.Key] = tag.Value
+		}
+		resp.Rules = append(resp.Rules, rule)
+	}
+	return resp
+}
+
+// HandlePutBucketLifecycle replaces the lifecycle rules of a bucket on every
+// instance hosting it.
+func (h *Handler) HandlePutBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	log := h.logger.WithField("bucket", bucketName)
+
+	var req lifecycleConfiguration
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.setBucketLifecycle(w, r, bucketName, req.toLifecycle(), log) {
+		return
+	}
+
+	log.WithField("rules", len(req.Rules)).Info("Changed bucket lifecycle")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// HandleGetBucketLifecycle returns the lifecycle rules of a bucket.
+func (h *Handler) HandleGetBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	log := h.logger.WithField("bucket", bucketName)
+
+	clients, ok := h.bucketClients(w, r, bucketName, log)
+	if !ok {
+		return
+	}
+	config, err := clients[0].GetBucketLifecycle(r.Context(), bucketName)
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		log.WithError(err).Error("Failed to get bucket lifecycle")
+		http.Error(w, "Failed to get bucket lifecycle", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fromLifecycle(config))
+}
+
+// HandleDeleteBucketLifecycle removes every lifecycle rule of a bucket.
+func (h *Handler) HandleDeleteBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	log := h.logger.WithField("bucket", bucketName)
+
+	// An empty configuration removes the rules.
+	if !h.setBucketLifecycle(w, r, bucketName, lifecycle.NewConfiguration(), log) {
+		return
+	}
+
+	log.Info("Removed bucket lifecycle")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setBucketLifecycle applies config on every instance hosting bucketName,
+// writing an error response on failure.
+func (h *Handler) setBucketLifecycle(w http.ResponseWriter, r *http.Request, bucketName string, config *lifecycle.Configuration, log *logrus.Entry) bool {
+	clients, ok := h.bucketClients(w, r, bucketName, log)
+	if !ok {
+		return false
+	}
+	for _, client := range clients {
+		if err := client.SetBucketLifecycle(r.Context(), bucketName, config); err != nil {
+			if h.respondUnavailable(w, err) {
+				return false
+			}
+			resp := minio.ToErrorResponse(err)
+			if resp.Code == "MalformedXML" || resp.Code == "InvalidArgument" || resp.Code == "InvalidRequest" {
+				http.Error(w, "Invalid lifecycle configuration: "+resp.Message, http.StatusBadRequest)
+				return false
+			}
+			log.WithError(err).Error("Failed to set bucket lifecycle")
+			http.Error(w, "Failed to set bucket lifecycle", http.StatusInternalServerError)
+			return false
+		}
+	}
+	return true
+}
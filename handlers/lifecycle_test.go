@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestValidateLifecycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []lifecycleRule
+		err   string
+	}{
+		{"Valid", []lifecycleRule{{ID: "tmp", Prefix: "tmp", ExpireAfterDays: 7}}, ""},
+		{"No rules", nil, "At least one rule is required"},
+		{"Missing id", []lifecycleRule{{ExpireAfterDays: 1}}, "Rule 1: id must be between 1 and 255 characters"},
+		{"Duplicate id", []lifecycleRule{{ID: "a", ExpireAfterDays: 1}, {ID: "a", ExpireAfterDays: 2}}, "Rule a: duplicate id"},
+		{"Invalid status", []lifecycleRule{{ID: "a", Status: "On", ExpireAfterDays: 1}}, "Rule a: status must be Enabled or Disabled"},
+		{"Whole bucket", []lifecycleRule{{ID: "all", ExpireAfterDays: 30}}, ""},
+		{"No action", []lifecycleRule{{ID: "a", Prefix: "tmp"}}, "Rule a: at least one action is required"},
+		{"Negative days", []lifecycleRule{{ID: "a", ExpireAfterDays: -1}}, "Rule a: days must be positive"},
+		{"Abort with tags", []lifecycleRule{{ID: "a", Tags: map[string]string{"k": "v"}, AbortIncompleteUploadAfterDays: 1}}, "Rule a: aborting incomplete uploads cannot be combined with a tag filter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := lifecycleConfiguration{Rules: tt.rules}
+			err := config.validate()
+			if tt.err == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, ruleEnabled, config.Rules[0].Status)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLifecycleTranslation(t *testing.T) {
+	config := lifecycleConfiguration{Rules: []lifecycleRule{
+		{ID: "prefix", Status: ruleEnabled, Prefix: "tmp", ExpireAfterDays: 7, AbortIncompleteUploadAfterDays: 1},
+		{ID: "tag", Status: ruleDisabled, Tags: map[string]string{"class": "scratch"}, NoncurrentExpireAfterDays: 30},
+		{ID: "both", Status: ruleEnabled, Prefix: "logs", Tags: map[string]string{"b": "2", "a": "1"}, ExpireAfterDays: 90},
+	}}
+
+	translated := config.toLifecycle()
+	assert.Equal(t, "tmp", translated.Rules[0].RuleFilter.Prefix)
+	assert.Equal(t, lifecycle.ExpirationDays(1), translated.Rules[0].AbortIncompleteMultipartUpload.DaysAfterInitiation)
+	assert.Equal(t, lifecycle.Tag{Key: "class", Value: "scratch"}, translated.Rules[1].RuleFilter.Tag)
+	assert.Equal(t, lifecycle.And{Prefix: "logs", Tags: []lifecycle.Tag{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}}, translated.Rules[2].RuleFilter.And)
+
+	assert.Equal(t, config, fromLifecycle(translated))
+}
+
+func TestBucketLifecycle(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	expiring := lifecycle.NewConfiguration()
+	expiring.Rules = []lifecycle.Rule{{
+		ID:         "tmp",
+		Status:     "Enabled",
+		RuleFilter: lifecycle.Filter{Prefix: "tmp"},
+		Expiration: lifecycle.Expiration{Days: 7},
+	}}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		setupMocks     func(single, a, b *mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "Set rules",
+			method: "PUT",
+			url:    "/buckets/mybucket/lifecycle",
+			body:   `{"rules":[{"id":"tmp","prefix":"tmp","expireAfterDays":7}]}`,
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("SetBucketLifecycle", mock.Anything, "mybucket", expiring).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"rules":[{"id":"tmp","status":"Enabled","prefix":"tmp","expireAfterDays":7}]}` + "\n",
+		},
+		{
+			name:   "Set rules of the default bucket on every instance",
+			method: "PUT",
+			url:    "/buckets/objects/lifecycle",
+			body:   `{"rules":[{"id":"tmp","prefix":"tmp","expireAfterDays":7}]}`,
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				for _, m := range []*mocks.MockMinioClient{a, b} {
+					m.On("BucketExists", mock.Anything, "objects").Return(true, nil)
+					m.On("SetBucketLifecycle", mock.Anything, "objects", expiring).Return(nil)
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"rules":[{"id":"tmp","status":"Enabled","prefix":"tmp","expireAfterDays":7}]}` + "\n",
+		},
+		{
+			name:           "Invalid rules",
+			method:         "PUT",
+			url:            "/buckets/mybucket/lifecycle",
+			body:           `{"rules":[{"id":"tmp"}]}`,
+			setupMocks:     func(single, a, b *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Rule tmp: at least one action is required\n",
+		},
+		{
+			name:   "Rules rejected by MinIO",
+			method: "PUT",
+			url:    "/buckets/mybucket/lifecycle",
+			body:   `{"rules":[{"id":"tmp","noncurrentExpireAfterDays":7}]}`,
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("SetBucketLifecycle", mock.Anything, "mybucket", mock.Anything).
+					Return(minio.ErrorResponse{Code: "InvalidRequest", Message: "bucket is not versioned"})
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid lifecycle configuration: bucket is not versioned\n",
+		},
+		{
+			name:   "Get rules",
+			method: "GET",
+			url:    "/buckets/mybucket/lifecycle",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("GetBucketLifecycle", mock.Anything, "mybucket").Return(expiring, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"rules":[{"id":"tmp","status":"Enabled","prefix":"tmp","expireAfterDays":7}]}` + "\n",
+		},
+		{
+			name:   "Get rules of a bucket without lifecycle",
+			method: "GET",
+			url:    "/buckets/mybucket/lifecycle",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("GetBucketLifecycle", mock.Anything, "mybucket").
+					Return(nil, minio.ErrorResponse{Code: "NoSuchLifecycleConfiguration"})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"rules":[]}` + "\n",
+		},
+		{
+			name:   "Delete rules",
+			method: "DELETE",
+			url:    "/buckets/mybucket/lifecycle",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("SetBucketLifecycle", mock.Anything, "mybucket", lifecycle.NewConfiguration()).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Bucket not found",
+			method: "DELETE",
+			url:    "/buckets/missing/lifecycle",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "missing").Return(false, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Bucket not found\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			single, a, b := new(mocks.MockMinioClient), new(mocks.MockMinioClient), new(mocks.MockMinioClient)
+			tt.setupMocks(single, a, b)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+				return single, nil
+			}
+			h.getAllMinioClients = func() []minio_adapter.InstanceClient {
+				return []minio_adapter.InstanceClient{{Client: a}, {Client: b}}
+			}
+
+			r := chi.NewRouter()
+			r.Put("/buckets/{bucketName}/lifecycle", h.HandlePutBucketLifecycle)
+			r.Get("/buckets/{bucketName}/lifecycle", h.HandleGetBucketLifecycle)
+			r.Delete("/buckets/{bucketName}/lifecycle", h.HandleDeleteBucketLifecycle)
+
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedBody, rr.Body.String())
+			single.AssertExpectations(t)
+			a.AssertExpectations(t)
+			b.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+type bucketEntry struct {
+	Name         string    `json:"name"`
+	CreationDate time.Time `json:"creationDate"`
+	InstanceID   string    `json:"instanceId"`
+}
+
+type instanceError struct {
+	InstanceID string `json:"instanceId"`
+	Error      string `json:"error"`
+}
+
+type listBucketsResponse struct {
+	Buckets []bucketEntry   `json:"buckets"`
+	Errors  []instanceError `json:"errors,omitempty"`
+	Partial bool            `json:"partial"`
+}
+
+func instanceID(instance minio_adapter.MinioInstance) string {
+	if instance.ID != "" {
+		return instance.ID
+	}
+	return instance.Endpoint
+}
+
+// HandleListBuckets lists the buckets of every instance. Instances that fail
+// are reported in the response instead of failing the whole request, unless
+// every instance fails.
+func (h *Handler) HandleListBuckets(w http.ResponseWriter, r *http.Request) {
+	clients := h.getAllMinioClients()
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		resp = listBucketsResponse{Buckets: []bucketEntry{}}
+	)
+	for _, ic := range clients {
+		wg.Add(1)
+		go func(ic minio_adapter.InstanceClient) {
+			defer wg.Done()
+			id := instanceID(ic.Instance)
+
+			err := ic.Err
+			var buckets []bucketEntry
+			if err == nil {
+				infos, listErr := ic.Client.ListBuckets(r.Context())
+				err = listErr
+				for _, info := range infos {
+					if info.Name == internalBucket {
+						continue
+					}
+					buckets = append(buckets, bucketEntry{Name: info.Name, CreationDate: info.CreationDate, InstanceID: id})
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				h.logger.WithError(err).WithField("instance", id).Error("Failed to list buckets")
+				resp.Errors = append(resp.Errors, instanceError{InstanceID: id, Error: err.Error()})
+				return
+			}
+			resp.Buckets = append(resp.Buckets, buckets...)
+		}(ic)
+	}
+	wg.Wait()
+
+	sort.Slice(resp.Buckets, func(i, j int) bool {
+		if resp.Buckets[i].Name != resp.Buckets[j].Name {
+			return resp.Buckets[i].Name < resp.Buckets[j].Name
+		}
+		return resp.Buckets[i].InstanceID < resp.Buckets[j].InstanceID
+	})
+	sort.Slice(resp.Errors, func(i, j int) bool {
+		return resp.Errors[i].InstanceID < resp.Errors[j].InstanceID
+	})
+	resp.Partial = len(resp.Errors) > 0
+
+	status := http.StatusOK
+	if len(clients) > 0 && len(resp.Errors) == len(clients) {
+		status = http.StatusBadGateway
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
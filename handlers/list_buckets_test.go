@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestHandleListBuckets(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	created := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		setupMocks     func(a, b *mocks.MockMinioClient)
+		expectedStatus int
+		expected       listBucketsResponse
+	}{
+		{
+			name: "All instances respond",
+			setupMocks: func(a, b *mocks.MockMinioClient) {
+				a.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{{Name: "zeta", CreationDate: created}}, nil)
+				b.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{{Name: "alpha", CreationDate: created}, {Name: internalBucket, CreationDate: created}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expected: listBucketsResponse{
+				Buckets: []bucketEntry{
+					{Name: "alpha", CreationDate: created, InstanceID: "node-2"},
+					{Name: "zeta", CreationDate: created, InstanceID: "node-1"},
+				},
+			},
+		},
+		{
+			name: "Partial results",
+			setupMocks: func(a, b *mocks.MockMinioClient) {
+				a.On("ListBuckets", mock.Anything).Return(nil, errors.New("connection refused"))
+				b.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{{Name: "alpha", CreationDate: created}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expected: listBucketsResponse{
+				Buckets: []bucketEntry{{Name: "alpha", CreationDate: created, InstanceID: "node-2"}},
+				Errors:  []instanceError{{InstanceID: "node-1", Error: "connection refused"}},
+				Partial: true,
+			},
+		},
+		{
+			name: "Every instance fails",
+			setupMocks: func(a, b *mocks.MockMinioClient) {
+				a.On("ListBuckets", mock.Anything).Return(nil, errors.New("connection refused"))
+				b.On("ListBuckets", mock.Anything).Return(nil, errors.New("timeout"))
+			},
+			expectedStatus: http.StatusBadGateway,
+			expected: listBucketsResponse{
+				Buckets: []bucketEntry{},
+				Errors: []instanceError{
+					{InstanceID: "node-1", Error: "connection refused"},
+					{InstanceID: "node-2", Error: "timeout"},
+				},
+				Partial: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := new(mocks.MockMinioClient), new(mocks.MockMinioClient)
+			tt.setupMocks(a, b)
+
+			h := NewHandler(nil, logger)
+			h.getAllMinioClients = func() []minio_adapter.InstanceClient {
+				return []minio_adapter.InstanceClient{
+					{Instance: minio_adapter.MinioInstance{ID: "node-1"}, Client: a},
+					{Instance: minio_adapter.MinioInstance{ID: "node-2"}, Client: b},
+				}
+			}
+
+			r := chi.NewRouter()
+			r.Get("/buckets", h.HandleListBuckets)
+
+			req, _ := http.NewRequest("GET", "/buckets", nil)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			var got listBucketsResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			assert.Equal(t, tt.expected, got)
+			a.AssertExpectations(t)
+			b.AssertExpectations(t)
+		})
+	}
+}
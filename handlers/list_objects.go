@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+const maxListLimit = 1000
+
+type objectEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+type listObjectsResponse struct {
+	Objects        []objectEntry `json:"objects"`
+	CommonPrefixes []string      `json:"commonPrefixes"`
+	NextCursor     string        `json:"nextCursor,omitempty"`
+	IsTruncated    bool          `json:"isTruncated"`
+}
+
+func encodeCursor(startAfter string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(startAfter))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	startAfter, err := base64.RawURLEncoding.DecodeString(cursor)
+	return string(startAfter), err
+}
+
+func (h *Handler) HandleListObjects(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	query := r.URL.Query()
+	log := h.logger.WithField("bucket", bucketName)
+
+	limit := maxListLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxListLimit {
+			http.Error(w, "Invalid limit, must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	delimiter := query.Get("delimiter")
+	if delimiter != "" && delimiter != "/" {
+		http.Error(w, "Only the / delimiter is supported", http.StatusBadRequest)
+		return
+	}
+
+	startAfter, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseTagFilter(query["tag"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Common prefixes carry no tags to filter them by.
+	if len(filter) > 0 && delimiter != "" {
+		http.Error(w, "Tag filters cannot be combined with a delimiter", http.StatusBadRequest)
+		return
+	}
+
+	if bucketName == internalBucket {
+		http.Error(w, "Bucket not found", http.StatusNotFound)
+		return
+	}
+	clients, err := h.hostingClients(bucketName)
+	if err != nil {
+		log.WithError(err).Error("Failed to get MinIO client")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if bucketName != h.defaultBucket {
+		exists, err := clients[0].BucketExists(r.Context(), bucketName)
+		if err != nil {
+			if h.respondUnavailable(w, err) {
+				return
+			}
+			log.WithError(err).Error("Failed to check bucket existence")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "Bucket not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	opts := minio.ListObjectsOptions{
+		Prefix:     query.Get("prefix"),
+		Recursive:  delimiter == "",
+		StartAfter: startAfter,
+		// One extra entry tells us whether there is a next page.
+		MaxKeys: limit + 1,
+		// Tags and expiries are only listed by MinIO when metadata is
+		// asked for, which makes listings much slower. Expired objects in
+		// buckets not known to hold any are left to the sweeper, reads
+		// already treat them as missing.
+		WithMetadata: len(filter) > 0 || h.knownExpiring(bucketName),
+	}
+	entries, err := h.listAcross(r.Context(), clients, bucketName, opts, filter, time.Now(), limit+1)
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		log.WithError(err).Error("Failed to list objects")
+		http.Error(w, "Failed to list objects", http.StatusInternalServerError)
+		return
+	}
+
+	resp := listObjectsResponse{
+		Objects:        []objectEntry{},
+		CommonPrefixes: []string{},
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		resp.IsTruncated = true
+	}
+	for _, entry := range entries {
+		if isCommonPrefix(entry, delimiter) {
+			resp.CommonPrefixes = append(resp.CommonPrefixes, entry.Key)
+			continue
+		}
+		resp.Objects = append(resp.Objects, objectEntry{
+			Key:          entry.Key,
+			Size:         entry.Size,
+			ETag:         entry.ETag,
+			LastModified: entry.LastModified,
+		})
+	}
+	if resp.IsTruncated {
+		last := entries[len(entries)-1]
+		next := last.Key
+		if isCommonPrefix(last, delimiter) {
+			// Skip everything rolled up into the prefix.
+			next += string(utf8.MaxRune)
+		}
+		resp.NextCursor = encodeCursor(next)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// listAcross lists up to maxEntries entries from every client and merges them
+// into a single key-ordered listing. Objects expired by now are left out. Common prefixes reported by several instances
+// are only returned once. A bucket missing from an instance counts as empty.
+func (h *Handler) listAcross(ctx context.Context, clients []minio_adapter.MinioClientInterface, bucketName string, opts minio.ListObjectsOptions, filter tagFilter, now time.Time, maxEntries int) ([]minio.ObjectInfo, error) {
+	results := make([][]minio.ObjectInfo, len(clients))
+	errs := make([]error, len(clients))
+
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client minio_adapter.MinioClientInterface) {
+			defer wg.Done()
+			results[i], errs[i] = listFrom(ctx, client, bucketName, opts, filter, now, maxEntries)
+		}(i, client)
+	}
+	wg.Wait()
+
+	var merged []minio.ObjectInfo
+	for i, err := range errs {
+		if err != nil {
+			if len(clients) > 1 && minio.ToErrorResponse(err).Code == "NoSuchBucket" {
+				continue
+			}
+			return nil, err
+		}
+		merged = append(merged, results[i]...)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Key < merged[j].Key
+	})
+	deduped := merged[:0]
+	for _, entry := range merged {
+		if len(deduped) > 0 && deduped[len(deduped)-1].Key == entry.Key {
+			continue
+		}
+		deduped = append(deduped, entry)
+	}
+	return deduped, nil
+}
+
+// listFrom reads at most maxEntries unexpired entries matching filter from a
+// single instance. MinIO returns a page's common prefixes after its objects, so they
+// are sorted here.
+func listFrom(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName string, opts minio.ListObjectsOptions, filter tagFilter, now time.Time, maxEntries int) ([]minio.ObjectInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	ch := client.ListObjects(ctx, bucketName, opts)
+	defer func() {
+		cancel()
+		for range ch {
+		}
+	}()
+
+	var entries []minio.ObjectInfo
+	for entry := range ch {
+		if entry.Err != nil {
+			return nil, entry.Err
+		}
+		if !filter.matches(entry.UserTags) || expired(entry, now) {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) == maxEntries {
+			break
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+func isCommonPrefix(entry minio.ObjectInfo, delimiter string) bool {
+	return delimiter != "" && strings.HasSuffix(entry.Key, delimiter) && entry.ETag == ""
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestHandleListObjects(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		url            string
+		expiring       bool
+		setupMocks     func(single *mocks.MockMinioClient, a, b *mocks.MockMinioClient)
+		expectedStatus int
+		expected       listObjectsResponse
+	}{
+		{
+			name: "Single instance bucket with pagination",
+			url:  "/buckets/mybucket/objects?limit=2&prefix=obj",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("ListObjects", mock.Anything, "mybucket", minio.ListObjectsOptions{Prefix: "obj", Recursive: true, MaxKeys: 3}).
+					Return([]minio.ObjectInfo{
+						{Key: "obj1", Size: 1, ETag: "e1", LastModified: modified},
+						{Key: "obj2", Size: 2, ETag: "e2", LastModified: modified},
+						{Key: "obj3", Size: 3, ETag: "e3", LastModified: modified},
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expected: listObjectsResponse{
+				Objects: []objectEntry{
+					{Key: "obj1", Size: 1, ETag: "e1", LastModified: modified},
+					{Key: "obj2", Size: 2, ETag: "e2", LastModified: modified},
+				},
+				CommonPrefixes: []string{},
+				NextCursor:     encodeCursor("obj2"),
+				IsTruncated:    true,
+			},
+		},
+		{
+			name:           "Internal bucket is hidden",
+			url:            "/buckets/" + internalBucket + "/objects",
+			setupMocks:     func(single, a, b *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "Filter by tags",
+			url:  "/buckets/mybucket/objects?tag=project=alpha&tag=class",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("ListObjects", mock.Anything, "mybucket", minio.ListObjectsOptions{Recursive: true, MaxKeys: 1001, WithMetadata: true}).
+					Return([]minio.ObjectInfo{
+						{Key: "obj1", ETag: "e1", UserTags: minio.URLMap{"project": "alpha", "class": "cold"}},
+						{Key: "obj2", ETag: "e2", UserTags: minio.URLMap{"project": "beta", "class": "cold"}},
+						{Key: "obj3", ETag: "e3", UserTags: minio.URLMap{"project": "alpha"}},
+						{Key: "obj4", ETag: "e4"},
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expected: listObjectsResponse{
+				Objects:        []objectEntry{{Key: "obj1", ETag: "e1"}},
+				CommonPrefixes: []string{},
+			},
+		},
+		{
+			name:     "Expired objects are left out",
+			url:      "/buckets/mybucket/objects",
+			expiring: true,
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("ListObjects", mock.Anything, "mybucket", minio.ListObjectsOptions{Recursive: true, MaxKeys: 1001, WithMetadata: true}).
+					Return([]minio.ObjectInfo{
+						{Key: "obj1", ETag: "e1", UserMetadata: map[string]string{"X-Amz-Meta-" + expiresAtKey: "1"}},
+						{Key: "obj2", ETag: "e2"},
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expected: listObjectsResponse{
+				Objects:        []objectEntry{{Key: "obj2", ETag: "e2"}},
+				CommonPrefixes: []string{},
+			},
+		},
+		{
+			name:           "Tag filter with a delimiter",
+			url:            "/buckets/mybucket/objects?tag=project=alpha&delimiter=/",
+			setupMocks:     func(single, a, b *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Cursor resumes after the last key",
+			url:  "/buckets/mybucket/objects?cursor=" + encodeCursor("obj2"),
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("ListObjects", mock.Anything, "mybucket", minio.ListObjectsOptions{Recursive: true, StartAfter: "obj2", MaxKeys: 1001}).
+					Return([]minio.ObjectInfo{{Key: "obj3", Size: 3, ETag: "e3", LastModified: modified}})
+			},
+			expectedStatus: http.StatusOK,
+			expected: listObjectsResponse{
+				Objects:        []objectEntry{{Key: "obj3", Size: 3, ETag: "e3", LastModified: modified}},
+				CommonPrefixes: []string{},
+			},
+		},
+		{
+			name: "Default bucket is merge-sorted across instances",
+			url:  "/buckets/objects/objects?delimiter=/",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				a.On("ListObjects", mock.Anything, "objects", mock.Anything).Return([]minio.ObjectInfo{
+					{Key: "c", ETag: "ec"},
+					{Key: "a", ETag: "ea"},
+					{Key: "dir/"},
+				})
+				b.On("ListObjects", mock.Anything, "objects", mock.Anything).Return([]minio.ObjectInfo{
+					{Key: "b", ETag: "eb"},
+					{Key: "dir/"},
+				})
+			},
+			expectedStatus: http.StatusOK,
+			expected: listObjectsResponse{
+				Objects: []objectEntry{
+					{Key: "a", ETag: "ea"},
+					{Key: "b", ETag: "eb"},
+					{Key: "c", ETag: "ec"},
+				},
+				CommonPrefixes: []string{"dir/"},
+			},
+		},
+		{
+			name: "Default bucket missing on an instance",
+			url:  "/buckets/objects/objects",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				a.On("ListObjects", mock.Anything, "objects", mock.Anything).Return([]minio.ObjectInfo{{Err: minio.ErrorResponse{Code: "NoSuchBucket"}}})
+				b.On("ListObjects", mock.Anything, "objects", mock.Anything).Return([]minio.ObjectInfo{{Key: "b", ETag: "eb"}})
+			},
+			expectedStatus: http.StatusOK,
+			expected: listObjectsResponse{
+				Objects:        []objectEntry{{Key: "b", ETag: "eb"}},
+				CommonPrefixes: []string{},
+			},
+		},
+		{
+			name: "Bucket not found",
+			url:  "/buckets/missing/objects",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "missing").Return(false, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invalid limit",
+			url:            "/buckets/mybucket/objects?limit=0",
+			setupMocks:     func(single, a, b *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unsupported delimiter",
+			url:            "/buckets/mybucket/objects?delimiter=-",
+			setupMocks:     func(single, a, b *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid cursor",
+			url:            "/buckets/mybucket/objects?cursor=!!",
+			setupMocks:     func(single, a, b *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			single, a, b := new(mocks.MockMinioClient), new(mocks.MockMinioClient), new(mocks.MockMinioClient)
+			tt.setupMocks(single, a, b)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+				return single, nil
+			}
+			h.getAllMinioClients = func() []minio_adapter.InstanceClient {
+				return []minio_adapter.InstanceClient{{Client: a}, {Client: b}}
+			}
+			if tt.expiring {
+				h.noteExpiring("mybucket", map[string]string{expiresAtKey: "1"})
+			}
+
+			r := chi.NewRouter()
+			r.Get("/buckets/{bucketName}/objects", h.HandleListObjects)
+
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var got listObjectsResponse
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				assert.Equal(t, tt.expected, got)
+			}
+			single.AssertExpectations(t)
+			a.AssertExpectations(t)
+			b.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// userMetadataHeaderPrefix marks request and response headers carrying user
+// metadata.
+const userMetadataHeaderPrefix = "X-Object-Meta-"
+
+// internalMetadataPrefix is reserved for metadata the gateway keeps with an
+// object. Clients can neither set nor see it.
+const internalMetadataPrefix = "Gateway-"
+
+const (
+	// maxUserMetadataSize bounds the combined size of user metadata keys and
+	// values, matching the S3 limit.
+	maxUserMetadataSize = 2048
+	maxHeaderValueSize  = 1024
+)
+
+// storedHeaders are the representation headers, besides Content-Type, kept
+// with an object and returned when it is read.
+var storedHeaders = []string{"Content-Encoding", "Content-Disposition", "Cache-Control"}
+
+// putOptions builds the options to store an object with from the headers of
+// the upload request. The error is meant for the client.
+func putOptions(r *http.Request) (minio.PutObjectOptions, error) {
+	opts := minio.PutObjectOptions{
+		ContentType:        r.Header.Get("Content-Type"),
+		ContentEncoding:    r.Header.Get("Content-Encoding"),
+		ContentDisposition: r.Header.Get("Content-Disposition"),
+		CacheControl:       r.Header.Get("Cache-Control"),
+	}
+	for _, name := range append([]string{"Content-Type"}, storedHeaders...) {
+		if len(r.Header.Get(name)) > maxHeaderValueSize {
+			return opts, fmt.Errorf("%s must not exceed %d bytes", name, maxHeaderValueSize)
+		}
+	}
+
+	size := 0
+	for name, values := range r.Header {
+		key, ok := strings.CutPrefix(name, userMetadataHeaderPrefix)
+		if !ok || key == "" {
+			continue
+		}
+		if strings.HasPrefix(key, internalMetadataPrefix) {
+			return opts, fmt.Errorf("User metadata keys must not start with %s", internalMetadataPrefix)
+		}
+		if opts.UserMetadata == nil {
+			opts.UserMetadata = make(map[string]string)
+		}
+		value := strings.Join(values, ",")
+		opts.UserMetadata[key] = value
+		size += len(key) + len(value)
+	}
+	if size > maxUserMetadataSize {
+		return opts, fmt.Errorf("User metadata must not exceed %d bytes (current size: %d)", maxUserMetadataSize, size)
+	}
+
+	userTags, err := parseTaggingHeader(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.UserTags = userTags
+
+	expiresAt, err := parseExpiresAfter(r, time.Now())
+	if err != nil {
+		return opts, err
+	}
+	if !expiresAt.IsZero() {
+		if opts.UserMetadata == nil {
+			opts.UserMetadata = make(map[string]string)
+		}
+		opts.UserMetadata[expiresAtKey] = strconv.FormatInt(expiresAt.Unix(), 10)
+	}
+	return opts, nil
+}
+
+// setObjectHeaders describes the object in info on the response.
+func setObjectHeaders(w http.ResponseWriter, info minio.ObjectInfo) {
+	header := w.Header()
+	header.Set("Content-Type", info.ContentType)
+	header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	header.Set("Accept-Ranges", "bytes")
+	setValidators(w, info.ETag, info.LastModified)
+	if info.VersionID != "" {
+		header.Set(versionIDHeader, info.VersionID)
+	}
+	for _, name := range storedHeaders {
+		if value := info.Metadata.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	for key, value := range info.UserMetadata {
+		if strings.HasPrefix(key, internalMetadataPrefix) {
+			continue
+		}
+		header.Set(userMetadataHeaderPrefix+key, value)
+	}
+	setDigestHeaders(w, storedChecksums(info))
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestHandlePutObjectMetadata(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedOpts   *minio.PutObjectOptions
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "Metadata is stored",
+			headers: map[string]string{
+				"Content-Type":        "image/png",
+				"Content-Encoding":    "gzip",
+				"Content-Disposition": `attachment; filename="cat.png"`,
+				"Cache-Control":       "max-age=60",
+				"X-Object-Meta-Owner": "alice",
+			},
+			expectedOpts: &minio.PutObjectOptions{
+				ContentType:        "image/png",
+				ContentEncoding:    "gzip",
+				ContentDisposition: `attachment; filename="cat.png"`,
+				CacheControl:       "max-age=60",
+				UserMetadata:       map[string]string{"Owner": "alice"},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:    "Tags are stored",
+			headers: map[string]string{"X-Object-Tagging": "project=alpha&class=cold"},
+			expectedOpts: &minio.PutObjectOptions{
+				UserTags: map[string]string{"project": "alpha", "class": "cold"},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid tags",
+			headers:        map[string]string{"X-Object-Tagging": "a=1&a=2"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "User metadata too large",
+			headers:        map[string]string{"X-Object-Meta-Notes": strings.Repeat("a", maxUserMetadataSize)},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "User metadata must not exceed 2048 bytes (current size: 2053)\n",
+		},
+		{
+			name:           "Header value too large",
+			headers:        map[string]string{"Content-Disposition": strings.Repeat("a", maxHeaderValueSize+1)},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Content-Disposition must not exceed 1024 bytes\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+			if tt.expectedOpts != nil {
+				mockClient.On("PutObject", mock.Anything, "testbucket", "abc123", mock.Anything, int64(-1), *tt.expectedOpts).
+					Return(minio.UploadInfo{ETag: "v1"}, nil)
+			}
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Put("/buckets/{bucketName}/objects/{id}", h.HandlePutObject)
+
+			req, _ := http.NewRequest("PUT", "/buckets/testbucket/objects/abc123", bytes.NewBufferString("data"))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSetObjectHeaders(t *testing.T) {
+	rr := httptest.NewRecorder()
+	setObjectHeaders(rr, minio.ObjectInfo{
+		Size:        4,
+		ContentType: "image/png",
+		Metadata: http.Header{
+			"Content-Encoding":    {"gzip"},
+			"Content-Disposition": {"inline"},
+			"Cache-Control":       {"no-cache"},
+		},
+		UserMetadata: map[string]string{"Owner": "alice"},
+	})
+
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "inline", rr.Header().Get("Content-Disposition"))
+	assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"))
+	assert.Equal(t, "alice", rr.Header().Get("X-Object-Meta-Owner"))
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxPartNumber = 10000
+	// multipartMarkerPrefix holds an empty marker object in the internal
+	// bucket for every upload in progress, named {bucket}/{id}/{uploadId}.
+	// The markers are what the janitor walks to find stale uploads.
+	multipartMarkerPrefix = "multipart/"
+)
+
+type partEntry struct {
+	PartNumber   int        `json:"partNumber"`
+	ETag         string     `json:"etag"`
+	Size         int64      `json:"size"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+}
+
+type listPartsResponse struct {
+	UploadID string      `json:"uploadId"`
+	Parts    []partEntry `json:"parts"`
+}
+
+func multipartMarker(bucketName, id, uploadID string) string {
+	return multipartMarkerPrefix + bucketName + "/" + id + "/" + uploadID
+}
+
+// respondMultipartError maps errors of the multipart API to responses.
+func (h *Handler) respondMultipartError(w http.ResponseWriter, err error, log *logrus.Entry, message string) {
+	if h.respondUnavailable(w, err) {
+		return
+	}
+	errorResponse := minio.ToErrorResponse(err)
+	switch errorResponse.Code {
+	case "NoSuchUpload":
+		http.Error(w, "Upload not found", http.StatusNotFound)
+	case "InvalidPart", "InvalidPartOrder", "EntityTooSmall", "BadDigest", "InvalidDigest":
+		http.Error(w, errorResponse.Message, http.StatusBadRequest)
+	default:
+		log.WithError(err).Error(message)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) HandleCreateMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+	})
+
+	opts, err := putOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.noteExpiring(ref.bucket, opts.UserMetadata)
+	// The parts reserve their size as they are uploaded.
+	reservation, ok := h.reserveQuota(w, r, ref, 0)
+	if !ok {
+		return
+	}
+
+	uploadID, err := ref.client.NewMultipartUpload(r.Context(), ref.bucket, ref.id, opts)
+	if err != nil {
+		reservation.release()
+		h.respondMultipartError(w, err, log, "Failed to create upload")
+		return
+	}
+
+	err = h.ensureInternalBucket(r.Context(), ref.client)
+	if err == nil {
+		marker := multipartMarker(ref.bucket, ref.id, uploadID)
+		_, err = ref.client.PutObject(r.Context(), internalBucket, marker, bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+	}
+	if err != nil {
+		if abortErr := ref.client.AbortMultipartUpload(r.Context(), ref.bucket, ref.id, uploadID); abortErr != nil {
+			log.WithError(abortErr).WithField("uploadId", uploadID).Warn("Failed to abort untracked upload")
+		}
+		reservation.release()
+		h.respondMultipartError(w, err, log, "Failed to create upload")
+		return
+	}
+	h.quotas.hold(multipartMarker(ref.bucket, ref.id, uploadID), reservation)
+
+	log.WithField("uploadId", uploadID).Info("Created multipart upload")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"uploadId": uploadID})
+}
+
+func (h *Handler) HandleUploadPart(w http.ResponseWriter, r *http.Request) {
+	partNumber, err := strconv.Atoi(chi.URLParam(r, "partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		http.Error(w, "Invalid part number, must be between 1 and 10000", http.StatusBadRequest)
+		return
+	}
+	if r.ContentLength < 0 {
+		http.Error(w, "Content-Length is required", http.StatusLengthRequired)
+		return
+	}
+
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	uploadID := chi.URLParam(r, "uploadId")
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket":     ref.bucket,
+		"id":         ref.id,
+		"uploadId":   uploadID,
+		"partNumber": partNumber,
+	})
+
+	// Uploads started before the gateway did, or in buckets without a
+	// quota, hold no reservation.
+	reservation := h.quotas.held(multipartMarker(ref.bucket, ref.id, uploadID))
+	var previous int64
+	if reservation != nil {
+		quota, _ := h.quotas.limit(ref.bucket)
+		previous, err = h.quotas.reservePart(reservation, quota, partNumber, r.ContentLength)
+		if err != nil {
+			quotaRejections.Add(1)
+			log.WithField("size", r.ContentLength).Info("Rejected part exceeding the bucket quota")
+			http.Error(w, "Bucket quota exceeded", http.StatusInsufficientStorage)
+			return
+		}
+	}
+
+	opts := minio.PutObjectPartOptions{Md5Base64: r.Header.Get("Content-MD5")}
+	part, err := ref.client.PutObjectPart(r.Context(), ref.bucket, ref.id, uploadID, partNumber, r.Body, r.ContentLength, opts)
+	if err != nil {
+		if reservation != nil {
+			// Shrinking a part never exceeds the quota.
+			h.quotas.reservePart(reservation, Quota{}, partNumber, previous)
+		}
+		h.respondMultipartError(w, err, log, "Failed to upload part")
+		return
+	}
+
+	setValidators(w, part.ETag, time.Time{})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(partEntry{PartNumber: partNumber, ETag: part.ETag, Size: part.Size})
+}
+
+func (h *Handler) HandleListParts(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	uploadID := chi.URLParam(r, "uploadId")
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket":   ref.bucket,
+		"id":       ref.id,
+		"uploadId": uploadID,
+	})
+
+	resp := listPartsResponse{UploadID: uploadID, Parts: []partEntry{}}
+	marker := 0
+	for {
+		result, err := ref.client.ListObjectParts(r.Context(), ref.bucket, ref.id, uploadID, marker, 1000)
+		if err != nil {
+			h.respondMultipartError(w, err, log, "Failed to list parts")
+			return
+		}
+		for _, part := range result.ObjectParts {
+			lastModified := part.LastModified
+			resp.Parts = append(resp.Parts, partEntry{
+				PartNumber:   part.PartNumber,
+				ETag:         part.ETag,
+				Size:         part.Size,
+				LastModified: &lastModified,
+			})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) HandleCompleteMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Parts []partEntry `json:"parts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Parts) == 0 {
+		http.Error(w, "At least one part is required", http.StatusBadRequest)
+		return
+	}
+
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	uploadID := chi.URLParam(r, "uploadId")
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket":   ref.bucket,
+		"id":       ref.id,
+		"uploadId": uploadID,
+	})
+
+	parts := make([]minio.CompletePart, len(req.Parts))
+	partNumbers := make([]int, len(req.Parts))
+	for i, part := range req.Parts {
+		parts[i] = minio.CompletePart{PartNumber: part.PartNumber, ETag: strings.Trim(part.ETag, `"`)}
+		partNumbers[i] = part.PartNumber
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+
+	marker := multipartMarker(ref.bucket, ref.id, uploadID)
+	info, err := ref.client.CompleteMultipartUpload(r.Context(), ref.bucket, ref.id, uploadID, parts, minio.PutObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+			h.quotas.take(marker).release()
+		}
+		h.respondMultipartError(w, err, log, "Failed to complete upload")
+		return
+	}
+	// Parts left out of the upload are dropped.
+	if reservation := h.quotas.take(marker); reservation != nil {
+		reservation.commit(h.quotas.partsSize(reservation, partNumbers))
+	}
+	h.removeMultipartMarker(r, ref, uploadID, log)
+
+	log.Info("Completed multipart upload")
+	lastModified := info.LastModified
+	if lastModified.IsZero() {
+		lastModified = time.Now()
+	}
+	setValidators(w, info.ETag, lastModified)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) HandleAbortMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	uploadID := chi.URLParam(r, "uploadId")
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket":   ref.bucket,
+		"id":       ref.id,
+		"uploadId": uploadID,
+	})
+
+	err := ref.client.AbortMultipartUpload(r.Context(), ref.bucket, ref.id, uploadID)
+	if err != nil {
+		h.respondMultipartError(w, err, log, "Failed to abort upload")
+		return
+	}
+	h.quotas.take(multipartMarker(ref.bucket, ref.id, uploadID)).release()
+	h.removeMultipartMarker(r, ref, uploadID, log)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeMultipartMarker stops tracking a finished upload. A marker left
+// behind is harmless, the janitor removes it eventually.
+func (h *Handler) removeMultipartMarker(r *http.Request, ref objectRef, uploadID string, log *logrus.Entry) {
+	err := ref.client.RemoveObject(r.Context(), internalBucket, multipartMarker(ref.bucket, ref.id, uploadID), minio.RemoveObjectOptions{})
+	if err != nil {
+		log.WithError(err).Warn("Failed to remove multipart upload marker")
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+var (
+	abortedUploads    = expvar.NewInt("multipart_uploads_aborted")
+	expiredTusUploads = expvar.NewInt("tus_uploads_expired")
+)
+
+// RunMultipartJanitor aborts multipart uploads older than maxAge and drops tus
+// uploads that received nothing for maxAge, every interval until ctx is done.
+func (h *Handler) RunMultipartJanitor(ctx context.Context, interval, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.abortStaleUploads(ctx, time.Now().Add(-maxAge))
+		}
+	}
+}
+
+func (h *Handler) abortStaleUploads(ctx context.Context, cutoff time.Time) {
+	for _, ic := range h.getAllMinioClients() {
+		log := h.logger.WithField("instance", instanceID(ic.Instance))
+		if ic.Err != nil {
+			log.WithError(ic.Err).Warn("Skipping instance in multipart janitor")
+			continue
+		}
+		h.abortStaleUploadsOn(ctx, ic.Client, cutoff, log)
+		h.removeStaleTusUploadsOn(ctx, ic.Client, cutoff, log)
+	}
+}
+
+// abortStaleUploadsOn walks the upload markers in the internal bucket of an
+// instance and aborts the uploads they track.
+func (h *Handler) abortStaleUploadsOn(ctx context.Context, client minio_adapter.MinioClientInterface, cutoff time.Time, log *logrus.Entry) {
+	markers := client.ListObjects(ctx, internalBucket, minio.ListObjectsOptions{Prefix: multipartMarkerPrefix, Recursive: true})
+	for marker := range markers {
+		if marker.Err != nil {
+			// No upload was ever started on this instance.
+			if minio.ToErrorResponse(marker.Err).Code != "NoSuchBucket" {
+				log.WithError(marker.Err).Warn("Failed to list multipart upload markers")
+			}
+			return
+		}
+		if !marker.LastModified.Before(cutoff) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(marker.Key, multipartMarkerPrefix), "/", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		bucketName, id, uploadID := parts[0], parts[1], parts[2]
+
+		entry := log.WithFields(logrus.Fields{"bucket": bucketName, "id": id, "uploadId": uploadID})
+		err := client.AbortMultipartUpload(ctx, bucketName, id, uploadID)
+		if err != nil && !uploadGone(err) {
+			entry.WithError(err).Warn("Failed to abort stale multipart upload")
+			continue
+		}
+		if err == nil {
+			abortedUploads.Add(1)
+			entry.Info("Aborted stale multipart upload")
+		}
+		h.quotas.take(marker.Key).release()
+		if err := client.RemoveObject(ctx, internalBucket, marker.Key, minio.RemoveObjectOptions{}); err != nil {
+			entry.WithError(err).Warn("Failed to remove multipart upload marker")
+		}
+	}
+}
+
+// removeStaleTusUploadsOn walks the tus upload state in the internal bucket
+// of an instance and removes the uploads whose last chunk, or info document
+// if they have none, is older than cutoff. The listing holds the chunks of an
+// upload right before its info document.
+func (h *Handler) removeStaleTusUploadsOn(ctx context.Context, client minio_adapter.MinioClientInterface, cutoff time.Time, log *logrus.Entry) {
+	var (
+		prefix       string
+		chunks       []tusChunk
+		lastModified time.Time
+	)
+	flush := func() {
+		if prefix == "" || !lastModified.Before(cutoff) || ctx.Err() != nil {
+			return
+		}
+		bucketName, uploadID, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(prefix, tusKeyPrefix), "/"), "/")
+		ref := objectRef{client: client, bucket: bucketName, id: uploadID}
+		h.removeTusUpload(ctx, ref, chunks)
+		h.quotas.take(tusInfoKey(bucketName, uploadID)).release()
+		expiredTusUploads.Add(1)
+		log.WithFields(logrus.Fields{"bucket": bucketName, "uploadId": uploadID}).Info("Removed stale tus upload")
+	}
+
+	entries := client.ListObjects(ctx, internalBucket, minio.ListObjectsOptions{Prefix: tusKeyPrefix, Recursive: true})
+	for entry := range entries {
+		if entry.Err != nil {
+			// No upload was ever started on this instance.
+			if minio.ToErrorResponse(entry.Err).Code != "NoSuchBucket" {
+				log.WithError(entry.Err).Warn("Failed to list tus uploads")
+			}
+			return
+		}
+		parts := strings.SplitN(strings.TrimPrefix(entry.Key, tusKeyPrefix), "/", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if key := tusKeyPrefix + parts[0] + "/" + parts[1] + "/"; key != prefix {
+			flush()
+			prefix, chunks, lastModified = key, nil, time.Time{}
+		}
+		if entry.Key != tusInfoKey(parts[0], parts[1]) {
+			chunks = append(chunks, tusChunk{key: entry.Key, size: entry.Size})
+		}
+		if entry.LastModified.After(lastModified) {
+			lastModified = entry.LastModified
+		}
+	}
+	flush()
+}
+
+// uploadGone reports whether err says the upload or its bucket no longer
+// exists, so there is nothing left to abort.
+func uploadGone(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchUpload", "NoSuchBucket":
+		return true
+	}
+	return false
+}
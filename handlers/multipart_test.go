@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	const marker = "multipart/testbucket/abc123/up1"
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           []byte
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "Create",
+			method: "POST",
+			path:   "/buckets/testbucket/objects/abc123/uploads",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("NewMultipartUpload", mock.Anything, "testbucket", "abc123", mock.Anything).Return("up1", nil)
+				m.On("BucketExists", mock.Anything, internalBucket).Return(true, nil)
+				m.On("PutObject", mock.Anything, internalBucket, marker, mock.Anything, int64(0), mock.Anything).Return(minio.UploadInfo{}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"uploadId":"up1"}` + "\n",
+		},
+		{
+			name:   "Upload part",
+			method: "PUT",
+			path:   "/buckets/testbucket/objects/abc123/uploads/up1/parts/2",
+			body:   []byte("part"),
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PutObjectPart", mock.Anything, "testbucket", "abc123", "up1", 2, mock.Anything, int64(4), mock.Anything).
+					Return(minio.ObjectPart{PartNumber: 2, ETag: "p2", Size: 4}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"partNumber":2,"etag":"p2","size":4}` + "\n",
+		},
+		{
+			name:           "Invalid part number",
+			method:         "PUT",
+			path:           "/buckets/testbucket/objects/abc123/uploads/up1/parts/10001",
+			body:           []byte("part"),
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid part number, must be between 1 and 10000\n",
+		},
+		{
+			name:   "List parts",
+			method: "GET",
+			path:   "/buckets/testbucket/objects/abc123/uploads/up1/parts",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("ListObjectParts", mock.Anything, "testbucket", "abc123", "up1", 0, 1000).
+					Return(minio.ListObjectPartsResult{ObjectParts: []minio.ObjectPart{{PartNumber: 1, ETag: "p1", Size: 5}}, IsTruncated: true, NextPartNumberMarker: 1}, nil)
+				m.On("ListObjectParts", mock.Anything, "testbucket", "abc123", "up1", 1, 1000).
+					Return(minio.ListObjectPartsResult{ObjectParts: []minio.ObjectPart{{PartNumber: 2, ETag: "p2", Size: 4}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"uploadId":"up1","parts":[{"partNumber":1,"etag":"p1","size":5,"lastModified":"0001-01-01T00:00:00Z"},{"partNumber":2,"etag":"p2","size":4,"lastModified":"0001-01-01T00:00:00Z"}]}` + "\n",
+		},
+		{
+			name:   "Complete",
+			method: "POST",
+			path:   "/buckets/testbucket/objects/abc123/uploads/up1/complete",
+			body:   []byte(`{"parts":[{"partNumber":2,"etag":"\"p2\""},{"partNumber":1,"etag":"p1"}]}`),
+			setupMock: func(m *mocks.MockMinioClient) {
+				parts := []minio.CompletePart{{PartNumber: 1, ETag: "p1"}, {PartNumber: 2, ETag: "p2"}}
+				m.On("CompleteMultipartUpload", mock.Anything, "testbucket", "abc123", "up1", parts, mock.Anything).Return(minio.UploadInfo{ETag: "final-2"}, nil)
+				m.On("RemoveObject", mock.Anything, internalBucket, marker, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Complete with a bad part",
+			method: "POST",
+			path:   "/buckets/testbucket/objects/abc123/uploads/up1/complete",
+			body:   []byte(`{"parts":[{"partNumber":1,"etag":"wrong"}]}`),
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("CompleteMultipartUpload", mock.Anything, "testbucket", "abc123", "up1", mock.Anything, mock.Anything).
+					Return(minio.UploadInfo{}, minio.ErrorResponse{Code: "InvalidPart", Message: "One or more of the specified parts could not be found."})
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "One or more of the specified parts could not be found.\n",
+		},
+		{
+			name:   "Abort unknown upload",
+			method: "DELETE",
+			path:   "/buckets/testbucket/objects/abc123/uploads/up1",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("AbortMultipartUpload", mock.Anything, "testbucket", "abc123", "up1").Return(minio.ErrorResponse{Code: "NoSuchUpload"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Upload not found\n",
+		},
+		{
+			name:   "Abort",
+			method: "DELETE",
+			path:   "/buckets/testbucket/objects/abc123/uploads/up1",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("AbortMultipartUpload", mock.Anything, "testbucket", "abc123", "up1").Return(nil)
+				m.On("RemoveObject", mock.Anything, internalBucket, marker, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil).Maybe()
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Route("/buckets/{bucketName}/objects", func(r chi.Router) {
+				r.Post("/{id}/uploads", h.HandleCreateMultipartUpload)
+				r.Get("/{id}/uploads/{uploadId}/parts", h.HandleListParts)
+				r.Put("/{id}/uploads/{uploadId}/parts/{partNumber}", h.HandleUploadPart)
+				r.Post("/{id}/uploads/{uploadId}/complete", h.HandleCompleteMultipartUpload)
+				r.Delete("/{id}/uploads/{uploadId}", h.HandleAbortMultipartUpload)
+			})
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAbortStaleUploads(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	now := time.Now()
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: multipartMarkerPrefix, Recursive: true}).
+		Return([]minio.ObjectInfo{
+			{Key: multipartMarker("testbucket", "old", "up1"), LastModified: now.Add(-48 * time.Hour)},
+			{Key: multipartMarker("testbucket", "gone", "up2"), LastModified: now.Add(-48 * time.Hour)},
+			{Key: multipartMarker("removed", "abc", "up4"), LastModified: now.Add(-48 * time.Hour)},
+			{Key: multipartMarker("testbucket", "fresh", "up3"), LastModified: now},
+		})
+	mockClient.On("AbortMultipartUpload", mock.Anything, "testbucket", "old", "up1").Return(nil)
+	mockClient.On("AbortMultipartUpload", mock.Anything, "testbucket", "gone", "up2").Return(minio.ErrorResponse{Code: "NoSuchUpload"})
+	mockClient.On("AbortMultipartUpload", mock.Anything, "removed", "abc", "up4").Return(minio.ErrorResponse{Code: "NoSuchBucket"})
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, multipartMarker("testbucket", "old", "up1"), mock.Anything).Return(nil)
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, multipartMarker("testbucket", "gone", "up2"), mock.Anything).Return(nil)
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, multipartMarker("removed", "abc", "up4"), mock.Anything).Return(nil)
+	// Tus uploads age from the last chunk they received.
+	mockClient.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: tusKeyPrefix, Recursive: true}).
+		Return([]minio.ObjectInfo{
+			{Key: tusChunkKey("testbucket", "stale", 0), LastModified: now.Add(-48 * time.Hour)},
+			{Key: tusInfoKey("testbucket", "stale"), LastModified: now.Add(-49 * time.Hour)},
+			{Key: tusChunkKey("testbucket", "active", 0), LastModified: now.Add(-48 * time.Hour)},
+			{Key: tusChunkKey("testbucket", "active", 4), LastModified: now},
+			{Key: tusInfoKey("testbucket", "active"), LastModified: now.Add(-48 * time.Hour)},
+		})
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, tusChunkKey("testbucket", "stale", 0), mock.Anything).Return(nil)
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, tusInfoKey("testbucket", "stale"), mock.Anything).Return(nil)
+
+	// An instance that never had an upload has no internal bucket.
+	emptyClient := new(mocks.MockMinioClient)
+	emptyClient.On("ListObjects", mock.Anything, internalBucket, mock.Anything).
+		Return([]minio.ObjectInfo{{Err: minio.ErrorResponse{Code: "NoSuchBucket"}}})
+
+	h := NewHandler(nil, logger)
+	h.getAllMinioClients = func() []minio_adapter.InstanceClient {
+		return []minio_adapter.InstanceClient{
+			{Instance: minio_adapter.MinioInstance{ID: "node-1"}, Client: mockClient},
+			{Instance: minio_adapter.MinioInstance{ID: "node-2"}, Client: emptyClient},
+		}
+	}
+
+	before, expiredBefore := abortedUploads.Value(), expiredTusUploads.Value()
+	h.abortStaleUploads(context.Background(), now.Add(-24*time.Hour))
+
+	assert.Equal(t, before+1, abortedUploads.Value())
+	assert.Equal(t, expiredBefore+1, expiredTusUploads.Value())
+	mockClient.AssertExpectations(t)
+	emptyClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "AbortMultipartUpload", mock.Anything, "testbucket", "fresh", "up3")
+}
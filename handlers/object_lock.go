@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// bypassGovernanceHeader lets a DELETE remove a version under governance
+// retention.
+const bypassGovernanceHeader = "X-Bypass-Governance-Retention"
+
+// maxRetentionDays bounds default retention periods at 100 years.
+const maxRetentionDays = 36500
+
+type lockConfiguration struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode,omitempty"`
+	Days    uint   `json:"days,omitempty"`
+	Years   uint   `json:"years,omitempty"`
+}
+
+type retentionRequest struct {
+	Mode        string    `json:"mode"`
+	RetainUntil time.Time `json:"retainUntil"`
+	// BypassGovernance allows shortening or removing governance retention.
+	BypassGovernance bool `json:"bypassGovernance,omitempty"`
+}
+
+type legalHold struct {
+	Status string `json:"status"`
+}
+
+// respondLocked writes an error response if err is MinIO refusing a request
+// because of object locking.
+func respondLocked(w http.ResponseWriter, err error) bool {
+	resp := minio.ToErrorResponse(err)
+	message := strings.ToLower(resp.Message)
+	switch {
+	case resp.Code == "InvalidBucketState",
+		resp.Code == "ObjectLockConfigurationNotFoundError",
+		strings.Contains(message, "missing objectlockconfiguration"):
+		http.Error(w, "Object locking is not enabled for this bucket", http.StatusConflict)
+	// MinIO reports WORM protection, S3 an AccessDenied mentioning object lock.
+	case strings.Contains(message, "worm protected") || strings.Contains(message, "object lock"):
+		http.Error(w, "Object is protected by a retention period or legal hold", http.StatusForbidden)
+	default:
+		return false
+	}
+	return true
+}
+
+// HandlePutObjectLock sets the default retention applied to new objects in a
+// bucket created with object locking. An empty mode removes it.
+func (h *Handler) HandlePutObjectLock(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	log := h.logger.WithField("bucket", bucketName)
+
+	var req lockConfiguration
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		mode     *minio.RetentionMode
+		validity *uint
+		unit     *minio.ValidityUnit
+	)
+	if req.Mode != "" || req.Days != 0 || req.Years != 0 {
+		m := minio.RetentionMode(strings.ToUpper(req.Mode))
+		if !m.IsValid() {
+			http.Error(w, "Mode must be GOVERNANCE or COMPLIANCE", http.StatusBadRequest)
+			return
+		}
+		if (req.Days == 0) == (req.Years == 0) {
+			http.Error(w, "Exactly one of days and years is required", http.StatusBadRequest)
+			return
+		}
+		if req.Days > maxRetentionDays || req.Years > maxRetentionDays/365 {
+			http.Error(w, fmt.Sprintf("Retention must not exceed %d days", maxRetentionDays), http.StatusBadRequest)
+			return
+		}
+		u, v := minio.Days, req.Days
+		if req.Years != 0 {
+			u, v = minio.Years, req.Years
+		}
+		req.Mode = string(m)
+		mode, validity, unit = &m, &v, &u
+	}
+
+	clients, ok := h.bucketClients(w, r, bucketName, log)
+	if !ok {
+		return
+	}
+	for _, client := range clients {
+		if err := client.SetObjectLockConfig(r.Context(), bucketName, mode, validity, unit); err != nil {
+			if h.respondUnavailable(w, err) || respondLocked(w, err) {
+				return
+			}
+			log.WithError(err).Error("Failed to set object lock configuration")
+			http.Error(w, "Failed to set object lock configuration", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"mode":  req.Mode,
+		"days":  req.Days,
+		"years": req.Years,
+	}).Info("Changed default retention")
+	req.Enabled = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// HandleGetObjectLock reports whether a bucket has object locking and its
+// default retention.
+func (h *Handler) HandleGetObjectLock(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	log := h.logger.WithField("bucket", bucketName)
+
+	clients, ok := h.bucketClients(w, r, bucketName, log)
+	if !ok {
+		return
+	}
+	var resp lockConfiguration
+	enabled, mode, validity, unit, err := clients[0].GetObjectLockConfig(r.Context(), bucketName)
+	if err != nil && minio.ToErrorResponse(err).Code != "ObjectLockConfigurationNotFoundError" {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		log.WithError(err).Error("Failed to get object lock configuration")
+		http.Error(w, "Failed to get object lock configuration", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		resp.Enabled = enabled == "Enabled"
+		if mode != nil && validity != nil && unit != nil {
+			resp.Mode = string(*mode)
+			if *unit == minio.Years {
+				resp.Years = *validity
+			} else {
+				resp.Days = *validity
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandlePutObjectRetention protects an object version until a date.
+func (h *Handler) HandlePutObjectRetention(w http.ResponseWriter, r *http.Request) {
+	var req retentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	mode := minio.RetentionMode(strings.ToUpper(req.Mode))
+	if !mode.IsValid() {
+		http.Error(w, "Mode must be GOVERNANCE or COMPLIANCE", http.StatusBadRequest)
+		return
+	}
+	if !req.RetainUntil.After(time.Now()) {
+		http.Error(w, "retainUntil must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	ref = requestVersion(r, ref)
+
+	retainUntil := req.RetainUntil.UTC()
+	err := ref.client.PutObjectRetention(r.Context(), ref.bucket, ref.id, minio.PutObjectRetentionOptions{
+		GovernanceBypass: req.BypassGovernance,
+		Mode:             &mode,
+		RetainUntilDate:  &retainUntil,
+		VersionID:        ref.versionID,
+	})
+	if err != nil {
+		h.respondLockError(w, ref, err, "Failed to set object retention")
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"bucket":      ref.bucket,
+		"id":          ref.id,
+		"mode":        mode,
+		"retainUntil": retainUntil,
+	}).Info("Changed object retention")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retentionRequest{Mode: string(mode), RetainUntil: retainUntil})
+}
+
+// HandleGetObjectRetention returns the retention of an object version.
+func (h *Handler) HandleGetObjectRetention(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	ref = requestVersion(r, ref)
+
+	mode, retainUntil, err := ref.client.GetObjectRetention(r.Context(), ref.bucket, ref.id, ref.versionID)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+			http.Error(w, "Object has no retention", http.StatusNotFound)
+			return
+		}
+		h.respondLockError(w, ref, err, "Failed to get object retention")
+		return
+	}
+
+	var resp retentionRequest
+	if mode != nil {
+		resp.Mode = string(*mode)
+	}
+	if retainUntil != nil {
+		resp.RetainUntil = retainUntil.UTC()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandlePutObjectLegalHold places or lifts a legal hold on an object version.
+func (h *Handler) HandlePutObjectLegalHold(w http.ResponseWriter, r *http.Request) {
+	var req legalHold
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	status := minio.LegalHoldStatus(strings.ToUpper(req.Status))
+	if !status.IsValid() {
+		http.Error(w, "Status must be ON or OFF", http.StatusBadRequest)
+		return
+	}
+
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	ref = requestVersion(r, ref)
+
+	err := ref.client.PutObjectLegalHold(r.Context(), ref.bucket, ref.id, minio.PutObjectLegalHoldOptions{
+		VersionID: ref.versionID,
+		Status:    &status,
+	})
+	if err != nil {
+		h.respondLockError(w, ref, err, "Failed to set legal hold")
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+		"status": status,
+	}).Info("Changed legal hold")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(legalHold{Status: string(status)})
+}
+
+// HandleGetObjectLegalHold returns the legal hold status of an object
+// version.
+func (h *Handler) HandleGetObjectLegalHold(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	ref = requestVersion(r, ref)
+
+	resp := legalHold{Status: string(minio.LegalHoldDisabled)}
+	status, err := ref.client.GetObjectLegalHold(r.Context(), ref.bucket, ref.id, minio.GetObjectLegalHoldOptions{VersionID: ref.versionID})
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchObjectLockConfiguration" {
+		h.respondLockError(w, ref, err, "Failed to get legal hold")
+		return
+	}
+	if err == nil && status != nil {
+		resp.Status = string(*status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) respondLockError(w http.ResponseWriter, ref objectRef, err error, message string) {
+	if h.respondUnavailable(w, err) || respondLocked(w, err) {
+		return
+	}
+	if objectNotFound(err) {
+		http.Error(w, "Object not found", http.StatusNotFound)
+		return
+	}
+	h.logger.WithError(err).WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+	}).Error(message)
+	http.Error(w, message, http.StatusInternalServerError)
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestObjectLock(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	governance := minio.Governance
+	thirty := uint(30)
+	days := minio.Days
+	legalHoldOn := minio.LegalHoldEnabled
+	retainUntil := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	retainUntilJSON := retainUntil.Format(time.RFC3339)
+	wormErr := minio.ErrorResponse{Code: "InvalidRequest", Message: "Object is WORM protected and cannot be overwritten"}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		headers        map[string]string
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "Set default retention",
+			method: "PUT",
+			url:    "/buckets/mybucket/object-lock",
+			body:   `{"mode":"governance","days":30}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("SetObjectLockConfig", mock.Anything, "mybucket", &governance, &thirty, &days).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"enabled":true,"mode":"GOVERNANCE","days":30}` + "\n",
+		},
+		{
+			name:   "Clear default retention",
+			method: "PUT",
+			url:    "/buckets/mybucket/object-lock",
+			body:   `{}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("SetObjectLockConfig", mock.Anything, "mybucket", (*minio.RetentionMode)(nil), (*uint)(nil), (*minio.ValidityUnit)(nil)).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"enabled":true}` + "\n",
+		},
+		{
+			name:   "Default retention on a bucket without object locking",
+			method: "PUT",
+			url:    "/buckets/mybucket/object-lock",
+			body:   `{"mode":"COMPLIANCE","years":1}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("SetObjectLockConfig", mock.Anything, "mybucket", mock.Anything, mock.Anything, mock.Anything).
+					Return(minio.ErrorResponse{Code: "InvalidBucketState"})
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   "Object locking is not enabled for this bucket\n",
+		},
+		{
+			name:           "Invalid retention mode",
+			method:         "PUT",
+			url:            "/buckets/mybucket/object-lock",
+			body:           `{"mode":"forever","days":1}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Mode must be GOVERNANCE or COMPLIANCE\n",
+		},
+		{
+			name:           "Both days and years",
+			method:         "PUT",
+			url:            "/buckets/mybucket/object-lock",
+			body:           `{"mode":"GOVERNANCE","days":1,"years":1}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Exactly one of days and years is required\n",
+		},
+		{
+			name:   "Get object lock configuration",
+			method: "GET",
+			url:    "/buckets/mybucket/object-lock",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObjectLockConfig", mock.Anything, "mybucket").Return("Enabled", &governance, &thirty, &days, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"enabled":true,"mode":"GOVERNANCE","days":30}` + "\n",
+		},
+		{
+			name:   "Get object lock configuration of an unlocked bucket",
+			method: "GET",
+			url:    "/buckets/mybucket/object-lock",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObjectLockConfig", mock.Anything, "mybucket").
+					Return("", nil, nil, nil, minio.ErrorResponse{Code: "ObjectLockConfigurationNotFoundError"})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"enabled":false}` + "\n",
+		},
+		{
+			name:   "Set object retention",
+			method: "PUT",
+			url:    "/buckets/mybucket/objects/abc/retention?versionId=v1",
+			body:   `{"mode":"GOVERNANCE","retainUntil":"` + retainUntilJSON + `"}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PutObjectRetention", mock.Anything, "mybucket", "abc", mock.MatchedBy(func(opts minio.PutObjectRetentionOptions) bool {
+					return *opts.Mode == minio.Governance && opts.RetainUntilDate.Equal(retainUntil) && opts.VersionID == "v1" && !opts.GovernanceBypass
+				})).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"mode":"GOVERNANCE","retainUntil":"` + retainUntilJSON + `"}` + "\n",
+		},
+		{
+			name:   "Shorten compliance retention",
+			method: "PUT",
+			url:    "/buckets/mybucket/objects/abc/retention",
+			body:   `{"mode":"COMPLIANCE","retainUntil":"` + retainUntilJSON + `"}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PutObjectRetention", mock.Anything, "mybucket", "abc", mock.Anything).Return(wormErr)
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Object is protected by a retention period or legal hold\n",
+		},
+		{
+			name:           "Retention in the past",
+			method:         "PUT",
+			url:            "/buckets/mybucket/objects/abc/retention",
+			body:           `{"mode":"COMPLIANCE","retainUntil":"2020-01-01T00:00:00Z"}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "retainUntil must be in the future\n",
+		},
+		{
+			name:   "Get object retention",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc/retention",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObjectRetention", mock.Anything, "mybucket", "abc", "").Return(&governance, &retainUntil, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"mode":"GOVERNANCE","retainUntil":"` + retainUntilJSON + `"}` + "\n",
+		},
+		{
+			name:   "Get retention of an unprotected object",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc/retention",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObjectRetention", mock.Anything, "mybucket", "abc", "").
+					Return(nil, nil, minio.ErrorResponse{Code: "NoSuchObjectLockConfiguration"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Object has no retention\n",
+		},
+		{
+			name:   "Place a legal hold",
+			method: "PUT",
+			url:    "/buckets/mybucket/objects/abc/legal-hold",
+			body:   `{"status":"on"}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PutObjectLegalHold", mock.Anything, "mybucket", "abc", minio.PutObjectLegalHoldOptions{Status: &legalHoldOn}).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ON"}` + "\n",
+		},
+		{
+			name:   "Legal hold on a bucket without object locking",
+			method: "PUT",
+			url:    "/buckets/mybucket/objects/abc/legal-hold",
+			body:   `{"status":"ON"}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PutObjectLegalHold", mock.Anything, "mybucket", "abc", mock.Anything).
+					Return(minio.ErrorResponse{Code: "InvalidRequest", Message: "Bucket is missing ObjectLockConfiguration"})
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   "Object locking is not enabled for this bucket\n",
+		},
+		{
+			name:           "Invalid legal hold status",
+			method:         "PUT",
+			url:            "/buckets/mybucket/objects/abc/legal-hold",
+			body:           `{"status":"maybe"}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Status must be ON or OFF\n",
+		},
+		{
+			name:   "Get legal hold",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc/legal-hold",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObjectLegalHold", mock.Anything, "mybucket", "abc", minio.GetObjectLegalHoldOptions{}).Return(&legalHoldOn, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ON"}` + "\n",
+		},
+		{
+			name:   "Delete a locked version",
+			method: "DELETE",
+			url:    "/buckets/mybucket/objects/abc?versionId=v1",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("RemoveObject", mock.Anything, "mybucket", "abc", minio.RemoveObjectOptions{VersionID: "v1"}).Return(wormErr)
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Object is protected by a retention period or legal hold\n",
+		},
+		{
+			name:    "Delete bypassing governance retention",
+			method:  "DELETE",
+			url:     "/buckets/mybucket/objects/abc?versionId=v1",
+			headers: map[string]string{"X-Bypass-Governance-Retention": "true"},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("RemoveObject", mock.Anything, "mybucket", "abc", minio.RemoveObjectOptions{VersionID: "v1", GovernanceBypass: true}).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "mybucket").Return(true, nil).Maybe()
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Get("/buckets/{bucketName}/object-lock", h.HandleGetObjectLock)
+			r.Put("/buckets/{bucketName}/object-lock", h.HandlePutObjectLock)
+			r.Route("/buckets/{bucketName}/objects", func(r chi.Router) {
+				r.Delete("/{id}", h.HandleDeleteObject)
+				r.Get("/{id}/retention", h.HandleGetObjectRetention)
+				r.Put("/{id}/retention", h.HandlePutObjectRetention)
+				r.Get("/{id}/legal-hold", h.HandleGetObjectLegalHold)
+				r.Put("/{id}/legal-hold", h.HandlePutObjectLegalHold)
+			})
+
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLockedBucketBookkeeping(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	// Upload markers go to the internal bucket, which is created without
+	// object locking, so default retention of a locked bucket never applies
+	// to them.
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+	mockClient.On("NewMultipartUpload", mock.Anything, "mybucket", "abc", mock.Anything).Return("up1", nil)
+	mockClient.On("BucketExists", mock.Anything, internalBucket).Return(false, nil)
+	mockClient.On("MakeBucket", mock.Anything, internalBucket, minio.MakeBucketOptions{}).Return(nil)
+	mockClient.On("PutObject", mock.Anything, internalBucket, multipartMarker("mybucket", "abc", "up1"), mock.Anything, int64(0), mock.Anything).
+		Return(minio.UploadInfo{}, nil)
+
+	h := NewHandler(nil, logger)
+	h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Post("/buckets/{bucketName}/objects/{id}/uploads", h.HandleCreateMultipartUpload)
+
+	req, _ := http.NewRequest("POST", "/buckets/mybucket/objects/abc/uploads", nil)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "PutObject", mock.Anything, "mybucket", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
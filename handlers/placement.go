@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+// internalBucket holds the gateway's own bookkeeping on every instance, such
+// as multipart upload markers, tus upload state and share link counters. It
+// is hidden from the API, so user buckets only ever contain user objects, and
+// it is created without versioning or object locking, so bookkeeping is never
+// retained by the settings of a user bucket.
+const internalBucket = "gateway-internal"
+
+// objectRef identifies an object and the instance that stores it.
+type objectRef struct {
+	client minio_adapter.MinioClientInterface
+	bucket string
+	id     string
+	// versionID selects a version of the object, the latest if empty.
+	versionID string
+}
+
+// placementKey returns the key an object is placed by. Regular buckets live
+// on a single instance chosen by bucket name, while the default bucket exists
+// on every instance and its objects are spread by ID.
+func (h *Handler) placementKey(bucketName, id string) string {
+	if bucketName == h.defaultBucket {
+		return id
+	}
+	return bucketName
+}
+
+// hostingClients returns the clients of every instance that hosts bucketName:
+// all of them for the default bucket, the owning instance otherwise.
+func (h *Handler) hostingClients(bucketName string) ([]minio_adapter.MinioClientInterface, error) {
+	if bucketName != h.defaultBucket {
+		client, err := h.getMinioClient(bucketName)
+		if err != nil {
+			return nil, err
+		}
+		return []minio_adapter.MinioClientInterface{client}, nil
+	}
+
+	var clients []minio_adapter.MinioClientInterface
+	for _, ic := range h.getAllMinioClients() {
+		if ic.Err != nil {
+			return nil, ic.Err
+		}
+		clients = append(clients, ic.Client)
+	}
+	if len(clients) == 0 {
+		return nil, minio_adapter.ErrNoInstances
+	}
+	return clients, nil
+}
+
+// resolveObject validates the object ID from the route and locates the
+// instance and bucket serving it, writing an error response on failure.
+// Routes without a bucketName parameter address the default bucket.
+func (h *Handler) resolveObject(w http.ResponseWriter, r *http.Request) (objectRef, bool) {
+	bucketName := chi.URLParam(r, "bucketName")
+	if bucketName == "" {
+		bucketName = h.defaultBucket
+	}
+	id := chi.URLParam(r, "id")
+
+	if err := validateID(id); err != nil {
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"bucket": bucketName,
+			"id":     id,
+		}).Error("Invalid ID")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return objectRef{}, false
+	}
+
+	return h.locate(w, r, bucketName, id)
+}
+
+// locate finds the instance serving id in bucketName and makes sure the
+// bucket exists there, writing an error response on failure.
+func (h *Handler) locate(w http.ResponseWriter, r *http.Request, bucketName, id string) (objectRef, bool) {
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": bucketName,
+		"id":     id,
+	})
+	if bucketName == internalBucket {
+		http.Error(w, "Bucket not found", http.StatusNotFound)
+		return objectRef{}, false
+	}
+
+	minioClient, err := h.getMinioClient(h.placementKey(bucketName, id))
+	if err != nil {
+		log.WithError(err).Error("Failed to get MinIO client")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return objectRef{}, false
+	}
+
+	if bucketName == h.defaultBucket {
+		err = h.ensureDefaultBucket(r.Context(), minioClient)
+		if err != nil {
+			if h.respondUnavailable(w, err) {
+				return objectRef{}, false
+			}
+			log.WithError(err).Error("Failed to create default bucket")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return objectRef{}, false
+		}
+		return objectRef{client: minioClient, bucket: bucketName, id: id}, true
+	}
+
+	exists, err := minioClient.BucketExists(r.Context(), bucketName)
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return objectRef{}, false
+		}
+		log.WithError(err).Error("Failed to check bucket existence")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return objectRef{}, false
+	}
+	if !exists {
+		log.Error("Bucket does not exist")
+		http.Error(w, "Bucket not found", http.StatusNotFound)
+		return objectRef{}, false
+	}
+
+	return objectRef{client: minioClient, bucket: bucketName, id: id}, true
+}
+
+// ensureDefaultBucket creates the default bucket on the instance behind
+// client the first time that instance is used.
+func (h *Handler) ensureDefaultBucket(ctx context.Context, client minio_adapter.MinioClientInterface) error {
+	return h.ensureBucket(ctx, client, h.defaultBucket)
+}
+
+// ensureInternalBucket creates the internal bucket on the instance behind
+// client before bookkeeping is first written there.
+func (h *Handler) ensureInternalBucket(ctx context.Context, client minio_adapter.MinioClientInterface) error {
+	return h.ensureBucket(ctx, client, internalBucket)
+}
+
+// ensuredBucket is a bucket known to exist on the instance behind client.
+type ensuredBucket struct {
+	client minio_adapter.MinioClientInterface
+	bucket string
+}
+
+func (h *Handler) ensureBucket(ctx context.Context, client minio_adapter.MinioClientInterface, bucketName string) error {
+	key := ensuredBucket{client: client, bucket: bucketName}
+	if _, ok := h.ensuredBuckets.Load(key); ok {
+		return nil
+	}
+
+	exists, err := client.BucketExists(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
+		if err != nil && minio.ToErrorResponse(err).Code != "BucketAlreadyOwnedByYou" {
+			return err
+		}
+		h.logger.WithField("bucket", bucketName).Info("Created bucket")
+	}
+
+	h.ensuredBuckets.Store(key, struct{}{})
+	return nil
+}
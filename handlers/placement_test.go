@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestFlatObjectAPI(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	minioInstances := []minio_adapter.MinioInstance{
+		{Endpoint: "localhost:9000", AccessKey: "test", SecretKey: "test"},
+	}
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "flat").Return(false, nil).Once()
+	mockClient.On("MakeBucket", mock.Anything, "flat", mock.Anything).Return(nil).Once()
+	mockClient.On("PutObject", mock.Anything, "flat", "abc123", mock.Anything, int64(-1), mock.Anything).
+		Return(minio.UploadInfo{}, nil).Once()
+
+	mockObject := new(mocks.MockMinioObject)
+	mockObject.On("Stat").Return(minio.ObjectInfo{ContentType: "text/plain", Size: 4}, nil)
+	mockObject.On("Read", mock.Anything).Run(func(args mock.Arguments) {
+		copy(args.Get(0).([]byte), "test")
+	}).Return(4, io.EOF)
+	mockObject.On("Close").Return(nil)
+	mockClient.On("GetObject", mock.Anything, "flat", "abc123", mock.Anything).Return(mockObject, nil).Once()
+
+	h := NewHandler(minioInstances, logger, WithDefaultBucket("flat"))
+	var placementKeys []string
+	h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+		placementKeys = append(placementKeys, id)
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Put("/object/{id}", h.HandlePutObject)
+	r.Get("/object/{id}", h.HandleGetObject)
+
+	req, _ := http.NewRequest("PUT", "/object/abc123", bytes.NewBufferString("test"))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, _ = http.NewRequest("GET", "/object/abc123", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "test", rr.Body.String())
+
+	req, _ = http.NewRequest("GET", "/object/invalid_id!", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Objects are placed by ID and the bucket is only created once per instance.
+	assert.Equal(t, []string{"abc123", "abc123"}, placementKeys)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDefaultBucketPlacement(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	h := NewHandler(nil, logger)
+
+	assert.Equal(t, "abc123", h.placementKey(DefaultBucketName, "abc123"))
+	assert.Equal(t, "mybucket", h.placementKey("mybucket", "abc123"))
+}
+
+func TestDefaultBucketIsReserved(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	h := NewHandler(nil, logger)
+
+	r := chi.NewRouter()
+	r.Post("/buckets", h.HandleCreateBucket)
+	r.Delete("/buckets/{bucketName}", h.HandleDeleteBucket)
+
+	req, _ := http.NewRequest("POST", "/buckets", bytes.NewBufferString(`{"bucketName":"objects"}`))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "Bucket name is reserved\n", rr.Body.String())
+
+	req, _ = http.NewRequest("DELETE", "/buckets/objects", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestInternalBucketIsHidden(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	h := NewHandler(nil, logger)
+
+	r := chi.NewRouter()
+	r.Post("/buckets", h.HandleCreateBucket)
+	r.Delete("/buckets/{bucketName}", h.HandleDeleteBucket)
+	r.Get("/buckets/{bucketName}/objects/{id}", h.HandleGetObject)
+
+	req, _ := http.NewRequest("POST", "/buckets", bytes.NewBufferString(`{"bucketName":"`+internalBucket+`"}`))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	req, _ = http.NewRequest("DELETE", "/buckets/"+internalBucket+"?force=true", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	req, _ = http.NewRequest("GET", "/buckets/"+internalBucket+"/objects/abc123", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+const (
+	// DefaultPresignMaxExpiry is the longest a presigned URL stays valid
+	// unless configured otherwise.
+	DefaultPresignMaxExpiry = time.Hour
+	// maxPresignExpiry is the limit of S3 signature V4.
+	maxPresignExpiry     = 7 * 24 * time.Hour
+	defaultPresignExpiry = 15 * time.Minute
+	// instancePlaceholder in the public base URL is replaced by the ID of the
+	// instance a URL was signed for.
+	instancePlaceholder = "{instance}"
+)
+
+type presignRequest struct {
+	Method string `json:"method"`
+	// ExpiresIn is the lifetime of the URL in seconds.
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+type presignResponse struct {
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WithPresign limits the lifetime of presigned URLs to maxExpiry and, if
+// publicBaseURL is set, rewrites them to point there instead of at the
+// instance. The signature covers the original host, so whatever serves
+// publicBaseURL must forward requests with the instance's Host header.
+func WithPresign(maxExpiry time.Duration, publicBaseURL string) Option {
+	return func(h *Handler) {
+		h.presignMaxExpiry = min(maxExpiry, maxPresignExpiry)
+		h.presignBaseURL = strings.TrimSuffix(publicBaseURL, "/")
+	}
+}
+
+// HandlePresignObject issues a presigned URL for reading or writing an object
+// directly on the instance that owns it.
+func (h *Handler) HandlePresignObject(w http.ResponseWriter, r *http.Request) {
+	req := presignRequest{Method: http.MethodGet}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Method = strings.ToUpper(req.Method)
+	if req.Method != http.MethodGet && req.Method != http.MethodPut {
+		http.Error(w, "Method must be GET or PUT", http.StatusBadRequest)
+		return
+	}
+	expiry := min(defaultPresignExpiry, h.presignMaxExpiry)
+	if req.ExpiresIn != 0 {
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+		if req.ExpiresIn < 1 || expiry > h.presignMaxExpiry {
+			http.Error(w, fmt.Sprintf("expiresIn must be between 1 and %d seconds", int64(h.presignMaxExpiry/time.Second)), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+		"method": req.Method,
+	})
+	// Uploads through a presigned URL bypass the gateway and its quota.
+	if req.Method == http.MethodPut && h.quotas != nil {
+		if _, limited := h.quotas.limit(ref.bucket); limited {
+			http.Error(w, "Presigned uploads are not allowed in buckets with a quota", http.StatusForbidden)
+			return
+		}
+	}
+
+	var (
+		signed *url.URL
+		err    error
+	)
+	if req.Method == http.MethodGet {
+		_, err = ref.client.StatObject(r.Context(), ref.bucket, ref.id, minio.StatObjectOptions{})
+		if err == nil {
+			signed, err = ref.client.PresignedGetObject(r.Context(), ref.bucket, ref.id, expiry, nil)
+		}
+	} else {
+		signed, err = ref.client.PresignedPutObject(r.Context(), ref.bucket, ref.id, expiry)
+	}
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			http.Error(w, "Object not found", http.StatusNotFound)
+			return
+		}
+		log.WithError(err).Error("Failed to presign URL")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	public, err := h.publicURL(signed, ref.client)
+	if err != nil {
+		log.WithError(err).Error("Failed to rewrite presigned URL")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(presignResponse{
+		URL:       public.String(),
+		Method:    req.Method,
+		ExpiresAt: time.Now().Add(expiry).UTC().Truncate(time.Second),
+	})
+}
+
+// publicURL moves a URL signed by client onto the public base URL, keeping
+// its path and query.
+func (h *Handler) publicURL(signed *url.URL, client minio_adapter.MinioClientInterface) (*url.URL, error) {
+	if h.presignBaseURL == "" {
+		return signed, nil
+	}
+	base := h.presignBaseURL
+	if strings.Contains(base, instancePlaceholder) {
+		base = strings.ReplaceAll(base, instancePlaceholder, url.PathEscape(h.instanceIDOf(client)))
+	}
+	public, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	public.Path += signed.Path
+	public.RawPath = ""
+	public.RawQuery = signed.RawQuery
+	return public, nil
+}
+
+// instanceIDOf returns the ID of the instance client talks to.
+func (h *Handler) instanceIDOf(client minio_adapter.MinioClientInterface) string {
+	for _, ic := range h.getAllMinioClients() {
+		if ic.Client == client {
+			return instanceID(ic.Instance)
+		}
+	}
+	return ""
+}
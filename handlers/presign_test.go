@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestHandlePresignObject(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	signed, _ := url.Parse("http://172.18.0.3:9000/testbucket/abc123?X-Amz-Signature=abc")
+
+	tests := []struct {
+		name           string
+		body           string
+		baseURL        string
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedURL    string
+		expectedExpiry time.Duration
+		expectedBody   string
+	}{
+		{
+			name: "GET with the default expiry",
+			body: `{}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, nil)
+				m.On("PresignedGetObject", mock.Anything, "testbucket", "abc123", 15*time.Minute, url.Values(nil)).Return(signed, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedURL:    signed.String(),
+			expectedExpiry: 15 * time.Minute,
+		},
+		{
+			name: "PUT with an explicit expiry",
+			body: `{"method":"put","expiresIn":600}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PresignedPutObject", mock.Anything, "testbucket", "abc123", 10*time.Minute).Return(signed, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedURL:    signed.String(),
+			expectedExpiry: 10 * time.Minute,
+		},
+		{
+			name:    "Public base URL",
+			body:    `{"method":"PUT"}`,
+			baseURL: "https://files.example.com/minio/{instance}/",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PresignedPutObject", mock.Anything, "testbucket", "abc123", 15*time.Minute).Return(signed, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedURL:    "https://files.example.com/minio/minio1/testbucket/abc123?X-Amz-Signature=abc",
+			expectedExpiry: 15 * time.Minute,
+		},
+		{
+			name: "Missing object",
+			body: `{"method":"GET"}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Object not found",
+		},
+		{
+			name:           "Expiry above the maximum",
+			body:           `{"expiresIn":3601}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "expiresIn must be between 1 and 3600 seconds",
+		},
+		{
+			name:           "Unsupported method",
+			body:           `{"method":"DELETE"}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Method must be GET or PUT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil).Maybe()
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger, WithPresign(time.Hour, tt.baseURL))
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+			h.getAllMinioClients = func() []minio_adapter.InstanceClient {
+				return []minio_adapter.InstanceClient{
+					{Instance: minio_adapter.MinioInstance{ID: "minio0"}, Client: new(mocks.MockMinioClient)},
+					{Instance: minio_adapter.MinioInstance{ID: "minio1"}, Client: mockClient},
+				}
+			}
+
+			r := chi.NewRouter()
+			r.Post("/buckets/{bucketName}/objects/{id}/presign", h.HandlePresignObject)
+
+			req, _ := http.NewRequest("POST", "/buckets/testbucket/objects/abc123/presign", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedURL != "" {
+				var resp presignResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedURL, resp.URL)
+				assert.WithinDuration(t, time.Now().Add(tt.expectedExpiry), resp.ExpiresAt, 2*time.Second)
+			} else {
+				assert.Equal(t, tt.expectedBody, strings.TrimSpace(rr.Body.String()))
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+// defaultQuotaBucket is the quota spec entry applying to buckets without
+// their own entry.
+const defaultQuotaBucket = "*"
+
+var (
+	errQuotaExceeded = quotaExceededError{}
+
+	quotaRejections = expvar.NewInt("quota_rejected_uploads")
+)
+
+type quotaExceededError struct{}
+
+func (quotaExceededError) Error() string {
+	return "bucket quota exceeded"
+}
+
+// Is keeps uploads cut off by the quota from counting against the instance
+// they were streamed to.
+func (quotaExceededError) Is(target error) bool {
+	return target == minio_adapter.ErrInvalidInput
+}
+
+// Quota limits what a bucket may hold. Zero means unlimited.
+type Quota struct {
+	MaxBytes   int64
+	MaxObjects int64
+}
+
+// ParseQuotas parses a comma separated list of bucket:maxBytes:maxObjects
+// entries. Empty limits are unlimited, and the bucket * applies to every
+// bucket without an entry of its own.
+func ParseQuotas(spec string) (map[string]Quota, error) {
+	quotas := make(map[string]Quota)
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("quota %q must have the form bucket:maxBytes:maxObjects", entry)
+		}
+		var (
+			quota  Quota
+			limits = []*int64{&quota.MaxBytes, &quota.MaxObjects}
+		)
+		for i, value := range parts[1:] {
+			if value == "" {
+				continue
+			}
+			limit, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || limit < 0 {
+				return nil, fmt.Errorf("quota %q has an invalid limit %q", entry, value)
+			}
+			*limits[i] = limit
+		}
+		if _, ok := quotas[parts[0]]; ok {
+			return nil, fmt.Errorf("duplicate quota for bucket %q", parts[0])
+		}
+		quotas[parts[0]] = quota
+	}
+	return quotas, nil
+}
+
+// WithQuotas limits the size and object count of buckets. Usage is counted
+// by the gateway as objects are uploaded and deleted through it, and
+// corrected by RunQuotaReconciler.
+func WithQuotas(quotas map[string]Quota) Option {
+	return func(h *Handler) {
+		h.quotas = &quotaTracker{
+			limits:  quotas,
+			usage:   make(map[string]*trackedUsage),
+			pending: make(map[string]*quotaReservation),
+		}
+	}
+}
+
+type bucketUsage struct {
+	Bytes   int64
+	Objects int64
+}
+
+// trackedUsage is the usage of a bucket with a quota.
+type trackedUsage struct {
+	// stored is what a listing of the bucket found, adjusted by the uploads
+	// and deletes through the gateway since.
+	stored bucketUsage
+	// reserved is held by uploads still in flight, which listings do not
+	// see yet.
+	reserved bucketUsage
+	// stale is set once deletes the gateway did not count have made stored
+	// wrong, so the bucket is listed again before the next upload.
+	stale bool
+}
+
+func (u *trackedUsage) total() bucketUsage {
+	return bucketUsage{
+		Bytes:   u.stored.Bytes + u.reserved.Bytes,
+		Objects: u.stored.Objects + u.reserved.Objects,
+	}
+}
+
+// quotaTracker keeps the usage of buckets with a quota. A bucket's usage is
+// loaded by listing it the first time it is written to.
+type quotaTracker struct {
+	limits map[string]Quota
+
+	mu    sync.Mutex
+	usage map[string]*trackedUsage
+	// pending holds the reservations of uploads spanning several requests,
+	// by the key of their upload state.
+	pending map[string]*quotaReservation
+}
+
+func (t *quotaTracker) limit(bucketName string) (Quota, bool) {
+	quota, ok := t.limits[bucketName]
+	if !ok {
+		quota, ok = t.limits[defaultQuotaBucket]
+	}
+	return quota, ok && (quota.MaxBytes > 0 || quota.MaxObjects > 0)
+}
+
+func (t *quotaTracker) loaded(bucketName string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage, ok := t.usage[bucketName]
+	return ok && !usage.stale
+}
+
+// set replaces the stored usage of a bucket by what a listing found. Uploads
+// finishing while the bucket was listed may be counted twice or not at all
+// until it is listed again.
+func (t *quotaTracker) set(bucketName string, stored bucketUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if usage, ok := t.usage[bucketName]; ok {
+		usage.stored = stored
+		usage.stale = false
+		return
+	}
+	t.usage[bucketName] = &trackedUsage{stored: stored}
+}
+
+// invalidate has a bucket listed again before its next upload, keeping what
+// uploads in flight hold.
+func (t *quotaTracker) invalidate(bucketName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if usage, ok := t.usage[bucketName]; ok {
+		usage.stale = true
+	}
+}
+
+// forget drops a bucket that no longer exists, along with the reservations
+// of its uploads.
+func (t *quotaTracker) forget(bucketName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.usage, bucketName)
+	for key, res := range t.pending {
+		if res.bucketName == bucketName {
+			delete(t.pending, key)
+		}
+	}
+}
+
+// hold keeps res until the upload stored under key completes or is aborted.
+// If the upload already holds a reservation, res is released instead.
+func (t *quotaTracker) hold(key string, res *quotaReservation) {
+	if t == nil || res == nil {
+		return
+	}
+	t.mu.Lock()
+	_, exists := t.pending[key]
+	if !exists {
+		t.pending[key] = res
+	}
+	t.mu.Unlock()
+	if exists {
+		res.release()
+	}
+}
+
+// held returns the reservation kept for the upload under key, nil if there
+// is none.
+func (t *quotaTracker) held(key string) *quotaReservation {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pending[key]
+}
+
+// take returns and drops the reservation kept for the upload under key, nil
+// if there is none.
+func (t *quotaTracker) take(key string) *quotaReservation {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := t.pending[key]
+	delete(t.pending, key)
+	return res
+}
+
+func (t *quotaTracker) buckets() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.usage))
+	for name := range t.usage {
+		names = append(names, name)
+	}
+	return names
+}
+
+// add changes the stored usage of a loaded bucket.
+func (t *quotaTracker) add(bucketName string, bytes, objects int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if usage, ok := t.usage[bucketName]; ok {
+		usage.stored.Bytes += bytes
+		usage.stored.Objects += objects
+	}
+}
+
+// reserve holds the bytes and objects of res in its bucket unless that would
+// exceed quota, and sets what res may still write. A bucket forgotten since
+// it was loaded holds nothing.
+func (t *quotaTracker) reserve(res *quotaReservation, quota Quota) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res.remaining = -1
+	usage, ok := t.usage[res.bucketName]
+	if !ok {
+		return nil
+	}
+	total := usage.total()
+	if quota.MaxObjects > 0 && res.objects > 0 && total.Objects+res.objects > quota.MaxObjects {
+		return errQuotaExceeded
+	}
+	if quota.MaxBytes > 0 && res.bytes > 0 && total.Bytes+res.bytes > quota.MaxBytes {
+		return errQuotaExceeded
+	}
+	usage.reserved.Bytes += res.bytes
+	usage.reserved.Objects += res.objects
+	res.usage = usage
+	if quota.MaxBytes > 0 {
+		// Untracked writes can leave a bucket over its quota.
+		res.remaining = max(quota.MaxBytes-total.Bytes-res.bytes, 0)
+	}
+	return nil
+}
+
+// reservePart adds a part of a multipart upload to res unless that would
+// exceed quota. A part uploaded again replaces the earlier one. It returns
+// the size the part had before, to put back if the upload fails.
+func (t *quotaTracker) reservePart(res *quotaReservation, quota Quota, partNumber int, size int64) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	previous := res.parts[partNumber]
+	delta := size - previous
+	if res.usage != nil && t.usage[res.bucketName] == res.usage {
+		if quota.MaxBytes > 0 && delta > 0 && res.usage.total().Bytes+delta > quota.MaxBytes {
+			return previous, errQuotaExceeded
+		}
+		res.usage.reserved.Bytes += delta
+	}
+	if res.parts == nil {
+		res.parts = make(map[int]int64)
+	}
+	res.parts[partNumber] = size
+	res.size += delta
+	res.bytes += delta
+	return previous, nil
+}
+
+// partsSize returns the size of the listed parts of a multipart upload.
+func (t *quotaTracker) partsSize(res *quotaReservation, partNumbers []int) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var size int64
+	for _, partNumber := range partNumbers {
+		size += res.parts[partNumber]
+	}
+	return size
+}
+
+// settle drops what res holds in flight, adding stored bytes and objects to
+// the stored usage instead. Nothing changes if the bucket was forgotten or
+// reloaded since res was reserved.
+func (t *quotaTracker) settle(res *quotaReservation, stored bucketUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if res.usage == nil || t.usage[res.bucketName] != res.usage {
+		return
+	}
+	res.usage.reserved.Bytes -= res.bytes
+	res.usage.reserved.Objects -= res.objects
+	res.usage.stored.Bytes += stored.Bytes
+	res.usage.stored.Objects += stored.Objects
+	res.usage = nil
+}
+
+// quotaReservation is the share of a bucket's quota held by an upload. A nil
+// reservation stands for a bucket without quota.
+type quotaReservation struct {
+	tracker    *quotaTracker
+	bucketName string
+	// usage is where the reservation is held, nil once it was settled.
+	usage *trackedUsage
+	// size is the Content-Length of the upload, -1 if unknown. For
+	// multipart uploads it is the size of the parts so far.
+	size    int64
+	bytes   int64
+	objects int64
+	// parts has the size of every part of a multipart upload.
+	parts map[int]int64
+	// remaining is what uploads of unknown length may still write, -1 if
+	// unlimited.
+	remaining int64
+}
+
+// limit fails reads of body past the bytes the reservation left in the
+// bucket, for uploads without a Content-Length.
+func (res *quotaReservation) limit(body io.Reader) io.Reader {
+	if res == nil || res.size >= 0 || res.remaining < 0 {
+		return body
+	}
+	return &quotaReader{r: body, remaining: res.remaining}
+}
+
+// commit moves the reservation to the stored usage of the bucket, with the
+// reserved size replaced by the size actually stored.
+func (res *quotaReservation) commit(stored int64) {
+	if res == nil {
+		return
+	}
+	res.tracker.settle(res, bucketUsage{Bytes: res.bytes + stored - max(res.size, 0), Objects: res.objects})
+}
+
+func (res *quotaReservation) release() {
+	if res == nil {
+		return
+	}
+	res.tracker.settle(res, bucketUsage{})
+}
+
+type quotaReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > q.remaining+1 {
+		p = p[:q.remaining+1]
+	}
+	n, err := q.r.Read(p)
+	if int64(n) > q.remaining {
+		return int(q.remaining), errQuotaExceeded
+	}
+	q.remaining -= int64(n)
+	return n, err
+}
+
+// reserveQuota checks that an upload of size bytes to ref fits the quota of
+// the bucket and reserves it, writing an error response if it does not. A
+// size of -1 is unknown. Uploads
+// replacing an object only need room for the difference, unless the bucket
+// is versioned and keeps the old version. Concurrent uploads
+// without a Content-Length may overshoot the quota until the next
+// reconciliation.
+func (h *Handler) reserveQuota(w http.ResponseWriter, r *http.Request, ref objectRef, size int64) (*quotaReservation, bool) {
+	if h.quotas == nil {
+		return nil, true
+	}
+	quota, ok := h.quotas.limit(ref.bucket)
+	if !ok {
+		return nil, true
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+	})
+
+	if quota.MaxBytes > 0 && size > quota.MaxBytes {
+		quotaRejections.Add(1)
+		log.WithField("size", size).Info("Rejected upload larger than the bucket quota")
+		http.Error(w, fmt.Sprintf("Object exceeds the bucket quota of %d bytes", quota.MaxBytes), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if err := h.loadUsage(r.Context(), ref.bucket); err != nil {
+		if h.respondUnavailable(w, err) {
+			return nil, false
+		}
+		log.WithError(err).Error("Failed to load bucket usage")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	res := &quotaReservation{tracker: h.quotas, bucketName: ref.bucket, size: size, bytes: max(size, 0), objects: 1}
+	if !h.knownVersioned(ref.bucket) {
+		current, exists, ok := h.statForWrite(w, r, ref)
+		if !ok {
+			return nil, false
+		}
+		if exists {
+			res.bytes -= current.Size
+			res.objects = 0
+		}
+	}
+	if err := h.quotas.reserve(res, quota); err != nil {
+		quotaRejections.Add(1)
+		log.WithField("size", size).Info("Rejected upload exceeding the bucket quota")
+		http.Error(w, "Bucket quota exceeded", http.StatusInsufficientStorage)
+		return nil, false
+	}
+	return res, true
+}
+
+// loadUsage lists a bucket the first time its usage is needed.
+func (h *Handler) loadUsage(ctx context.Context, bucketName string) error {
+	if h.quotas.loaded(bucketName) {
+		return nil
+	}
+	usage, err := h.listUsage(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	if !h.quotas.loaded(bucketName) {
+		h.quotas.set(bucketName, usage)
+	}
+	return nil
+}
+
+// listUsage adds up the objects of a bucket on every instance hosting it.
+// Noncurrent versions take up space and count as objects of their own,
+// delete markers do not count.
+func (h *Handler) listUsage(ctx context.Context, bucketName string) (bucketUsage, error) {
+	var usage bucketUsage
+	clients, err := h.hostingClients(bucketName)
+	if err != nil {
+		return usage, err
+	}
+	for _, client := range clients {
+		for object := range client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Recursive: true, WithVersions: true}) {
+			if object.Err != nil {
+				return usage, object.Err
+			}
+			if object.IsDeleteMarker {
+				continue
+			}
+			usage.Bytes += object.Size
+			usage.Objects++
+		}
+	}
+	return usage, nil
+}
+
+// trackDelete frees the quota held by an object or version about to be
+// deleted. It returns the function to call once the delete succeeded.
+// Deleting without a version on a versioned bucket only adds a delete marker,
+// which frees nothing and needs no lookup.
+func (h *Handler) trackDelete(ctx context.Context, ref objectRef) func() {
+	noop := func() {}
+	if h.quotas == nil || !h.quotas.loaded(ref.bucket) {
+		return noop
+	}
+	if ref.versionID == "" && h.knownVersioned(ref.bucket) {
+		return noop
+	}
+	info, err := ref.client.StatObject(ctx, ref.bucket, ref.id, minio.StatObjectOptions{VersionID: ref.versionID})
+	if err != nil || info.IsDeleteMarker {
+		return noop
+	}
+	return func() {
+		h.quotas.add(ref.bucket, -info.Size, -1)
+	}
+}
+
+// RunQuotaReconciler recounts the usage of buckets with a quota every
+// interval until ctx is done, correcting drift from writes made to MinIO
+// directly and from multi-request uploads whose reservations were lost with a
+// restart.
+func (h *Handler) RunQuotaReconciler(ctx context.Context, interval time.Duration) {
+	if h.quotas == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.reconcileQuotas(ctx)
+		}
+	}
+}
+
+func (h *Handler) reconcileQuotas(ctx context.Context) {
+	for _, bucketName := range h.quotas.buckets() {
+		log := h.logger.WithField("bucket", bucketName)
+		usage, err := h.listUsage(ctx, bucketName)
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchBucket" {
+				h.quotas.forget(bucketName)
+				continue
+			}
+			log.WithError(err).Warn("Failed to reconcile bucket usage")
+			continue
+		}
+		h.quotas.set(bucketName, usage)
+		log.WithFields(logrus.Fields{
+			"bytes":   usage.Bytes,
+			"objects": usage.Objects,
+		}).Debug("Reconciled bucket usage")
+	}
+}
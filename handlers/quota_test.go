@@ -0,0 +1,656 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestParseQuotas(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected map[string]Quota
+		err      string
+	}{
+		{
+			name: "Valid",
+			spec: "debug:1024:10, *::100",
+			expected: map[string]Quota{
+				"debug": {MaxBytes: 1024, MaxObjects: 10},
+				"*":     {MaxObjects: 100},
+			},
+		},
+		{name: "Missing limit", spec: "debug:1024", err: `quota "debug:1024" must have the form bucket:maxBytes:maxObjects`},
+		{name: "Invalid limit", spec: "debug:1G:10", err: `quota "debug:1G:10" has an invalid limit "1G"`},
+		{name: "Negative limit", spec: "debug:-1:10", err: `quota "debug:-1:10" has an invalid limit "-1"`},
+		{name: "Duplicate bucket", spec: "debug:1:1,debug:2:2", err: `duplicate quota for bucket "debug"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotas, err := ParseQuotas(tt.spec)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, quotas)
+		})
+	}
+}
+
+func TestQuotaReader(t *testing.T) {
+	_, err := io.ReadAll(&quotaReader{r: strings.NewReader("hello"), remaining: 5})
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(&quotaReader{r: strings.NewReader("hello"), remaining: 4})
+	assert.ErrorIs(t, err, errQuotaExceeded)
+	assert.Equal(t, "hell", string(data))
+}
+
+func TestHandlePutObjectQuota(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	// The bucket holds two objects and 6 bytes, the quota is 10 bytes and
+	// three objects.
+	listing := []minio.ObjectInfo{
+		{Key: "a", Size: 2},
+		{Key: "b", Size: 4},
+	}
+	quotas := map[string]Quota{"testbucket": {MaxBytes: 10, MaxObjects: 3}}
+
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		chunked        bool
+		versioned      bool
+		quotas         map[string]Quota
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+		expectedUsage  *bucketUsage
+	}{
+		{
+			name: "Fits the quota",
+			id:   "c",
+			body: "1234",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+				m.On("PutObject", mock.Anything, "testbucket", "c", mock.Anything, int64(-1), mock.Anything).Return(minio.UploadInfo{Size: 4}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedUsage:  &bucketUsage{Bytes: 10, Objects: 3},
+		},
+		{
+			name:           "Larger than the quota",
+			id:             "c",
+			body:           strings.Repeat("x", 11),
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   "Object exceeds the bucket quota of 10 bytes\n",
+		},
+		{
+			name: "Bucket full",
+			id:   "c",
+			body: "12345",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusInsufficientStorage,
+			expectedBody:   "Bucket quota exceeded\n",
+			expectedUsage:  &bucketUsage{Bytes: 6, Objects: 2},
+		},
+		{
+			name:   "Too many objects",
+			id:     "c",
+			body:   "1",
+			quotas: map[string]Quota{"*": {MaxObjects: 2}},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusInsufficientStorage,
+			expectedBody:   "Bucket quota exceeded\n",
+		},
+		{
+			name: "Overwrite only needs room for the difference",
+			id:   "b",
+			body: "12345678",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "b", mock.Anything).Return(minio.ObjectInfo{Key: "b", Size: 4}, nil)
+				m.On("PutObject", mock.Anything, "testbucket", "b", mock.Anything, int64(-1), mock.Anything).Return(minio.UploadInfo{Size: 8}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedUsage:  &bucketUsage{Bytes: 10, Objects: 2},
+		},
+		{
+			name:      "Overwrite in a versioned bucket keeps the old version",
+			id:        "b",
+			body:      "1",
+			versioned: true,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PutObject", mock.Anything, "testbucket", "b", mock.Anything, int64(-1), mock.Anything).Return(minio.UploadInfo{Size: 1, VersionID: "v2"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedUsage:  &bucketUsage{Bytes: 7, Objects: 3},
+		},
+		{
+			name:    "Upload of unknown length overflowing the quota",
+			id:      "c",
+			body:    "12345",
+			chunked: true,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+				m.On("PutObject", mock.Anything, "testbucket", "c", mock.Anything, int64(-1), mock.Anything).
+					Run(func(args mock.Arguments) {
+						_, err := io.ReadAll(args.Get(3).(io.Reader))
+						assert.ErrorIs(t, err, errQuotaExceeded)
+					}).
+					Return(minio.UploadInfo{}, errQuotaExceeded)
+			},
+			expectedStatus: http.StatusInsufficientStorage,
+			expectedBody:   "Bucket quota exceeded\n",
+			expectedUsage:  &bucketUsage{Bytes: 6, Objects: 2},
+		},
+		{
+			name:   "Bucket without quota",
+			id:     "c",
+			body:   strings.Repeat("x", 11),
+			quotas: map[string]Quota{"other": {MaxBytes: 1}},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PutObject", mock.Anything, "testbucket", "c", mock.Anything, int64(-1), mock.Anything).Return(minio.UploadInfo{Size: 11}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+			mockClient.On("ListObjects", mock.Anything, "testbucket", minio.ListObjectsOptions{Recursive: true, WithVersions: true}).Return(listing).Maybe()
+			tt.setupMock(mockClient)
+
+			limits := quotas
+			if tt.quotas != nil {
+				limits = tt.quotas
+			}
+			h := NewHandler(nil, logger, WithQuotas(limits))
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+			h.noteVersioning("testbucket", tt.versioned)
+
+			r := chi.NewRouter()
+			r.Put("/buckets/{bucketName}/objects/{id}", h.HandlePutObject)
+
+			req, _ := http.NewRequest("PUT", "/buckets/testbucket/objects/"+tt.id, bytes.NewBufferString(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			if tt.expectedUsage != nil {
+				assert.Equal(t, &trackedUsage{stored: *tt.expectedUsage}, h.quotas.usage["testbucket"])
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestQuotaExceededKeepsBreakerClosed(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("ListObjects", mock.Anything, "testbucket", mock.Anything).Return([]minio.ObjectInfo{{Key: "a", Size: 6}})
+	mockClient.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+	// Every upload also checks the bucket and stats the object, so a quarter
+	// of the calls fail if quota rejections count.
+	breaker := minio_adapter.NewCircuitBreaker("node", minio_adapter.CircuitBreakerConfig{
+		Window:         time.Minute,
+		MinRequests:    4,
+		FailureRate:    0.25,
+		OpenTimeout:    time.Minute,
+		HalfOpenProbes: 1,
+	}, nil)
+	client := minio_adapter.NewCircuitBreakerClient(&uploadClient{MockMinioClient: mockClient}, breaker)
+
+	h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"testbucket": {MaxBytes: 10}}))
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return client, nil
+	}
+
+	r := chi.NewRouter()
+	r.Put("/buckets/{bucketName}/objects/{id}", h.HandlePutObject)
+
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest("PUT", "/buckets/testbucket/objects/c", strings.NewReader("12345"))
+		req.ContentLength = -1
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+	}
+	assert.Equal(t, minio_adapter.StateClosed, breaker.State())
+}
+
+func TestHandleDeleteObjectQuota(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name          string
+		url           string
+		versioned     bool
+		setupMock     func(*mocks.MockMinioClient)
+		expectedUsage bucketUsage
+	}{
+		{
+			name: "Frees the object",
+			url:  "/buckets/testbucket/objects/a",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "a", minio.StatObjectOptions{}).Return(minio.ObjectInfo{Key: "a", Size: 2}, nil).Once()
+				m.On("RemoveObject", mock.Anything, "testbucket", "a", minio.RemoveObjectOptions{}).Return(nil)
+			},
+			expectedUsage: bucketUsage{Bytes: 4, Objects: 1},
+		},
+		{
+			name:      "Delete marker frees nothing",
+			url:       "/buckets/testbucket/objects/a",
+			versioned: true,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("RemoveObjectsWithResult", mock.Anything, "testbucket", []string{"a"}, minio.RemoveObjectsOptions{}).
+					Return([]minio.RemoveObjectResult{{ObjectName: "a", DeleteMarker: true, DeleteMarkerVersionID: "v2"}})
+			},
+			expectedUsage: bucketUsage{Bytes: 6, Objects: 2},
+		},
+		{
+			name:      "Frees a deleted version",
+			url:       "/buckets/testbucket/objects/a?versionId=v1",
+			versioned: true,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "a", minio.StatObjectOptions{VersionID: "v1"}).Return(minio.ObjectInfo{Key: "a", Size: 2}, nil).Once()
+				m.On("RemoveObject", mock.Anything, "testbucket", "a", minio.RemoveObjectOptions{VersionID: "v1"}).Return(nil)
+			},
+			expectedUsage: bucketUsage{Bytes: 4, Objects: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"testbucket": {MaxBytes: 10}}))
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+			h.quotas.set("testbucket", bucketUsage{Bytes: 6, Objects: 2})
+			h.noteVersioning("testbucket", tt.versioned)
+
+			r := chi.NewRouter()
+			r.Delete("/buckets/{bucketName}/objects/{id}", h.HandleDeleteObject)
+
+			req, _ := http.NewRequest("DELETE", tt.url, nil)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			assert.Equal(t, &trackedUsage{stored: tt.expectedUsage}, h.quotas.usage["testbucket"])
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestReconcileQuotas(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	a, b := new(mocks.MockMinioClient), new(mocks.MockMinioClient)
+	a.On("ListObjects", mock.Anything, "objects", minio.ListObjectsOptions{Recursive: true, WithVersions: true}).Return([]minio.ObjectInfo{{Key: "x", Size: 3}, {Key: "w", IsDeleteMarker: true}})
+	b.On("ListObjects", mock.Anything, "objects", minio.ListObjectsOptions{Recursive: true, WithVersions: true}).Return([]minio.ObjectInfo{{Key: "y", Size: 5}, {Key: "z", Size: 1}})
+	single := new(mocks.MockMinioClient)
+	single.On("ListObjects", mock.Anything, "removed", minio.ListObjectsOptions{Recursive: true, WithVersions: true}).
+		Return([]minio.ObjectInfo{{Err: minio.ErrorResponse{Code: "NoSuchBucket"}}})
+
+	h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"*": {MaxBytes: 100}}))
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return single, nil
+	}
+	h.getAllMinioClients = func() []minio_adapter.InstanceClient {
+		return []minio_adapter.InstanceClient{{Client: a}, {Client: b}}
+	}
+	h.quotas.set("objects", bucketUsage{Bytes: 50, Objects: 7})
+	h.quotas.set("removed", bucketUsage{Bytes: 1, Objects: 1})
+	// An upload in flight is not listed yet and keeps its reservation.
+	inFlight := &quotaReservation{tracker: h.quotas, bucketName: "objects", size: 4, bytes: 4, objects: 1}
+	assert.NoError(t, h.quotas.reserve(inFlight, Quota{MaxBytes: 100}))
+
+	h.reconcileQuotas(context.Background())
+
+	assert.Equal(t, map[string]*trackedUsage{"objects": {
+		stored:   bucketUsage{Bytes: 9, Objects: 3},
+		reserved: bucketUsage{Bytes: 4, Objects: 1},
+	}}, h.quotas.usage)
+
+	inFlight.commit(4)
+	assert.Equal(t, bucketUsage{Bytes: 13, Objects: 4}, h.quotas.usage["objects"].stored)
+	assert.Equal(t, bucketUsage{}, h.quotas.usage["objects"].reserved)
+}
+
+func TestMultipartUploadQuota(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	const marker = "multipart/testbucket/c/up1"
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("ListObjects", mock.Anything, "testbucket", minio.ListObjectsOptions{Recursive: true, WithVersions: true}).
+		Return([]minio.ObjectInfo{{Key: "a", Size: 2}, {Key: "b", Size: 4}})
+	mockClient.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+	mockClient.On("NewMultipartUpload", mock.Anything, "testbucket", "c", mock.Anything).Return("up1", nil)
+	mockClient.On("BucketExists", mock.Anything, internalBucket).Return(true, nil)
+	mockClient.On("PutObject", mock.Anything, internalBucket, marker, mock.Anything, int64(0), mock.Anything).Return(minio.UploadInfo{}, nil)
+	mockClient.On("PutObjectPart", mock.Anything, "testbucket", "c", "up1", 1, mock.Anything, mock.Anything, mock.Anything).
+		Return(minio.ObjectPart{PartNumber: 1}, nil)
+	mockClient.On("CompleteMultipartUpload", mock.Anything, "testbucket", "c", "up1", mock.Anything, mock.Anything).Return(minio.UploadInfo{}, nil)
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, marker, mock.Anything).Return(nil)
+
+	h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"testbucket": {MaxBytes: 10, MaxObjects: 3}}))
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Route("/buckets/{bucketName}/objects", func(r chi.Router) {
+		r.Post("/{id}/uploads", h.HandleCreateMultipartUpload)
+		r.Put("/{id}/uploads/{uploadId}/parts/{partNumber}", h.HandleUploadPart)
+		r.Post("/{id}/uploads/{uploadId}/complete", h.HandleCompleteMultipartUpload)
+	})
+
+	steps := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedUsage  trackedUsage
+	}{
+		{
+			name:           "Create reserves the object",
+			method:         "POST",
+			path:           "/buckets/testbucket/objects/c/uploads",
+			expectedStatus: http.StatusCreated,
+			expectedUsage:  trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 2}, reserved: bucketUsage{Objects: 1}},
+		},
+		{
+			name:           "Part within the quota",
+			method:         "PUT",
+			path:           "/buckets/testbucket/objects/c/uploads/up1/parts/1",
+			body:           "123",
+			expectedStatus: http.StatusOK,
+			expectedUsage:  trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 2}, reserved: bucketUsage{Bytes: 3, Objects: 1}},
+		},
+		{
+			name:           "Part exceeding the quota",
+			method:         "PUT",
+			path:           "/buckets/testbucket/objects/c/uploads/up1/parts/2",
+			body:           "12",
+			expectedStatus: http.StatusInsufficientStorage,
+			expectedUsage:  trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 2}, reserved: bucketUsage{Bytes: 3, Objects: 1}},
+		},
+		{
+			name:           "Part uploaded again replaces the earlier one",
+			method:         "PUT",
+			path:           "/buckets/testbucket/objects/c/uploads/up1/parts/1",
+			body:           "1234",
+			expectedStatus: http.StatusOK,
+			expectedUsage:  trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 2}, reserved: bucketUsage{Bytes: 4, Objects: 1}},
+		},
+		{
+			name:           "Complete stores the parts",
+			method:         "POST",
+			path:           "/buckets/testbucket/objects/c/uploads/up1/complete",
+			body:           `{"parts":[{"partNumber":1,"etag":"p1"}]}`,
+			expectedStatus: http.StatusOK,
+			expectedUsage:  trackedUsage{stored: bucketUsage{Bytes: 10, Objects: 3}},
+		},
+	}
+
+	for _, step := range steps {
+		req, _ := http.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, step.expectedStatus, rr.Code, step.name)
+		assert.Equal(t, &step.expectedUsage, h.quotas.usage["testbucket"], step.name)
+	}
+	assert.Nil(t, h.quotas.held(marker))
+	mockClient.AssertExpectations(t)
+}
+
+func TestTusUploadQuota(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	idMetadata := "id " + base64.StdEncoding.EncodeToString([]byte("c"))
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("ListObjects", mock.Anything, "testbucket", minio.ListObjectsOptions{Recursive: true, WithVersions: true}).
+		Return([]minio.ObjectInfo{{Key: "a", Size: 6}})
+	mockClient.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+	mockClient.On("BucketExists", mock.Anything, internalBucket).Return(true, nil)
+	mockClient.On("PutObject", mock.Anything, internalBucket, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(minio.UploadInfo{}, nil)
+
+	h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"testbucket": {MaxBytes: 10}}))
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Route("/buckets/{bucketName}/uploads", func(r chi.Router) {
+		r.Post("/", h.HandleTusCreate)
+		r.Delete("/{uploadId}", h.HandleTusDelete)
+	})
+
+	create := func(length string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/buckets/testbucket/uploads", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", length)
+		req.Header.Set("Upload-Metadata", idMetadata)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := create("5")
+	assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+
+	rr = create("4")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, &trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 1}, reserved: bucketUsage{Bytes: 4, Objects: 1}}, h.quotas.usage["testbucket"])
+
+	// Terminating the upload frees its reservation.
+	location := rr.Header().Get("Location")
+	uploadID := location[strings.LastIndex(location, "/")+1:]
+	infoKey := tusInfoKey("testbucket", uploadID)
+	mockClient.On("GetObject", mock.Anything, internalBucket, infoKey, mock.Anything).
+		Return(&readerObject{Reader: strings.NewReader(`{"objectId":"c","length":4}`)}, nil)
+	mockClient.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: tusChunkPrefix("testbucket", uploadID), Recursive: true}).
+		Return([]minio.ObjectInfo{})
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, infoKey, mock.Anything).Return(nil)
+
+	req, _ := http.NewRequest("DELETE", location, nil)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, &trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 1}}, h.quotas.usage["testbucket"])
+	mockClient.AssertExpectations(t)
+}
+
+func TestCopyObjectQuota(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("StatObject", mock.Anything, "testbucket", "a", mock.Anything).Return(minio.ObjectInfo{Key: "a", Size: 5}, nil)
+	mockClient.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+
+	h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"testbucket": {MaxBytes: 10}}))
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+	h.quotas.set("testbucket", bucketUsage{Bytes: 6, Objects: 2})
+
+	r := chi.NewRouter()
+	r.Post("/buckets/{bucketName}/objects/{id}/copy", h.HandleCopyObject)
+
+	req, _ := http.NewRequest("POST", "/buckets/testbucket/objects/a/copy", strings.NewReader(`{"id":"c"}`))
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+	assert.Equal(t, &trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 2}}, h.quotas.usage["testbucket"])
+	mockClient.AssertExpectations(t)
+}
+
+func TestPresignUploadQuota(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+
+	h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"testbucket": {MaxBytes: 10}}))
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Post("/buckets/{bucketName}/objects/{id}/presign", h.HandlePresignObject)
+
+	req, _ := http.NewRequest("POST", "/buckets/testbucket/objects/a/presign", strings.NewReader(`{"method":"PUT"}`))
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "Presigned uploads are not allowed in buckets with a quota\n", rr.Body.String())
+}
+
+func TestBatchDeleteQuota(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil).Maybe()
+	mockClient.On("RemoveObjects", mock.Anything, "testbucket", []string{"a"}, mock.Anything).Return(nil)
+
+	h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"testbucket": {MaxBytes: 10}}))
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+	h.quotas.set("testbucket", bucketUsage{Bytes: 6, Objects: 2})
+
+	r := chi.NewRouter()
+	r.Post("/buckets/{bucketName}/objects:delete", h.HandleBatchDelete)
+
+	req, _ := http.NewRequest("POST", "/buckets/testbucket/objects:delete", strings.NewReader(`{"ids":["a"]}`))
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	// The next upload lists the bucket again.
+	assert.False(t, h.quotas.loaded("testbucket"))
+	mockClient.AssertExpectations(t)
+}
+
+func TestTusUploadQuotaAfterRestart(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	const uploadID = "0123456789abcdef0123456789abcdef"
+	infoKey := tusInfoKey("testbucket", uploadID)
+	chunkKey := tusChunkKey("testbucket", uploadID, 0)
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("BucketExists", mock.Anything, internalBucket).Return(true, nil).Maybe()
+	mockClient.On("GetObject", mock.Anything, internalBucket, infoKey, mock.Anything).
+		Return(&readerObject{Reader: strings.NewReader(`{"objectId":"c","length":4}`)}, nil)
+	mockClient.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: tusChunkPrefix("testbucket", uploadID), Recursive: true}).
+		Return([]minio.ObjectInfo{})
+	mockClient.On("StatObject", mock.Anything, "testbucket", "c", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+	mockClient.On("PutObject", mock.Anything, internalBucket, chunkKey, mock.Anything, int64(2), mock.Anything).Return(minio.UploadInfo{}, nil)
+
+	h := NewHandler(nil, logger, WithQuotas(map[string]Quota{"testbucket": {MaxBytes: 10}}))
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+	h.quotas.set("testbucket", bucketUsage{Bytes: 6, Objects: 1})
+
+	r := chi.NewRouter()
+	r.Patch("/buckets/{bucketName}/uploads/{uploadId}", h.HandleTusPatch)
+
+	req, _ := http.NewRequest("PATCH", "/buckets/testbucket/uploads/"+uploadID, strings.NewReader("12"))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "0")
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	// The upload created before the restart reserves its length again.
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, &trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 1}, reserved: bucketUsage{Bytes: 4, Objects: 1}}, h.quotas.usage["testbucket"])
+
+	// Abandoned, it is removed by the janitor, which frees the reservation.
+	mockClient.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: tusKeyPrefix, Recursive: true}).
+		Return([]minio.ObjectInfo{
+			{Key: chunkKey, LastModified: time.Now().Add(-48 * time.Hour)},
+			{Key: infoKey, LastModified: time.Now().Add(-48 * time.Hour)},
+		})
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, chunkKey, mock.Anything).Return(nil)
+	mockClient.On("RemoveObject", mock.Anything, internalBucket, infoKey, mock.Anything).Return(nil)
+
+	h.removeStaleTusUploadsOn(context.Background(), mockClient, time.Now().Add(-24*time.Hour), logger.WithField("instance", "node-1"))
+
+	assert.Equal(t, &trackedUsage{stored: bucketUsage{Bytes: 6, Objects: 1}}, h.quotas.usage["testbucket"])
+	mockClient.AssertExpectations(t)
+}
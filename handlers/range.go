@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRanges caps the number of ranges served from a single request. Requests
+// asking for more are answered with the whole object.
+const maxRanges = 16
+
+var (
+	errInvalidRange        = errors.New("invalid range")
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+type byteRange struct {
+	start, length int64
+}
+
+func (br byteRange) end() int64 {
+	return br.start + br.length - 1
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.end(), size)
+}
+
+// parseRange parses a Range header against an object of the given size.
+// Ranges that lie entirely past the end of the object are dropped, and
+// errRangeNotSatisfiable is returned if none are left.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var br byteRange
+		if first == "" {
+			// Suffix range: the final N bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			br = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errInvalidRange
+				}
+			}
+			if start >= size {
+				continue
+			}
+			if end >= size {
+				end = size - 1
+			}
+			br = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, br)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errRangeNotSatisfiable
+	}
+	return ranges, nil
+}
+
+// serveRanges answers a GET carrying a Range header. It reports false, without
+// writing anything, when the header should be ignored and the whole object
+// served instead.
+func (h *Handler) serveRanges(w http.ResponseWriter, r *http.Request, ref objectRef) bool {
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+		"range":  r.Header.Get("Range"),
+	})
+
+	info, err := ref.client.StatObject(r.Context(), ref.bucket, ref.id, minio.StatObjectOptions{VersionID: ref.versionID})
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return true
+		}
+		if objectNotFound(err) {
+			http.Error(w, "Object not found", http.StatusNotFound)
+			return true
+		}
+		log.WithError(err).Error("Failed to stat object")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+	if expired(info, time.Now()) {
+		http.Error(w, "Object not found", http.StatusNotFound)
+		return true
+	}
+
+	if status := evaluatePreconditions(r, info, true); status != 0 {
+		respondPrecondition(w, info, status)
+		return true
+	}
+
+	ranges, err := parseRange(r.Header.Get("Range"), info.Size)
+	if errors.Is(err, errRangeNotSatisfiable) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+	if err != nil || len(ranges) > maxRanges {
+		return false
+	}
+
+	setObjectHeaders(w, info)
+	if len(ranges) == 1 {
+		h.serveSingleRange(w, r, ref, info, ranges[0], log)
+	} else {
+		h.serveMultipartRanges(w, r, ref, info, ranges, log)
+	}
+	return true
+}
+
+func (h *Handler) serveSingleRange(w http.ResponseWriter, r *http.Request, ref objectRef, info minio.ObjectInfo, br byteRange, log *logrus.Entry) {
+	object, err := h.openRange(r, ref, br)
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		log.WithError(err).Error("Failed to get object range")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer object.Close()
+
+	w.Header().Set("Content-Range", br.contentRange(info.Size))
+	w.Header().Set("Content-Length", strconv.FormatInt(br.length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if _, err := io.CopyN(w, object, br.length); err != nil {
+		log.WithError(err).Error("Failed to stream object range")
+	}
+}
+
+// serveMultipartRanges writes a multipart/byteranges body, fetching every
+// range from MinIO as the previous one finishes streaming.
+func (h *Handler) serveMultipartRanges(w http.ResponseWriter, r *http.Request, ref objectRef, info minio.ObjectInfo, ranges []byteRange, log *logrus.Entry) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusPartialContent)
+
+	for _, br := range ranges {
+		object, err := h.openRange(r, ref, br)
+		if err != nil {
+			// The status line is already out, all we can do is cut the body short.
+			log.WithError(err).Error("Failed to get object range")
+			return
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {info.ContentType},
+			"Content-Range": {br.contentRange(info.Size)},
+		})
+		if err == nil {
+			_, err = io.CopyN(part, object, br.length)
+		}
+		object.Close()
+		if err != nil {
+			log.WithError(err).Error("Failed to stream object range")
+			return
+		}
+	}
+	mw.Close()
+}
+
+func (h *Handler) openRange(r *http.Request, ref objectRef, br byteRange) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{VersionID: ref.versionID}
+	if err := opts.SetRange(br.start, br.end()); err != nil {
+		return nil, err
+	}
+	object, err := h.getObject(r.Context(), ref.client, ref.bucket, ref.id, opts)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
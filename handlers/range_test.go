@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+type readerObject struct {
+	*strings.Reader
+	info minio.ObjectInfo
+}
+
+func (o *readerObject) Stat() (minio.ObjectInfo, error) { return o.info, nil }
+func (o *readerObject) Close() error                    { return nil }
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header   string
+		size     int64
+		expected []byteRange
+		err      error
+	}{
+		{"bytes=0-4", 10, []byteRange{{0, 5}}, nil},
+		{"bytes=5-", 10, []byteRange{{5, 5}}, nil},
+		{"bytes=-3", 10, []byteRange{{7, 3}}, nil},
+		{"bytes=-30", 10, []byteRange{{0, 10}}, nil},
+		{"bytes=8-20", 10, []byteRange{{8, 2}}, nil},
+		{"bytes=0-1, 4-5", 10, []byteRange{{0, 2}, {4, 2}}, nil},
+		{"bytes=0-1,20-30", 10, []byteRange{{0, 2}}, nil},
+		{"bytes=10-", 10, nil, errRangeNotSatisfiable},
+		{"bytes=-0", 10, nil, errRangeNotSatisfiable},
+		{"bytes=0-", 0, nil, errRangeNotSatisfiable},
+		{"bytes=5-2", 10, nil, errInvalidRange},
+		{"bytes=a-b", 10, nil, errInvalidRange},
+		{"items=0-1", 10, nil, errInvalidRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			ranges, err := parseRange(tt.header, tt.size)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.expected, ranges)
+		})
+	}
+}
+
+func TestHandleGetObjectRange(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	const content = "0123456789"
+	info := minio.ObjectInfo{Size: int64(len(content)), ContentType: "text/plain", ETag: "abc"}
+
+	withRange := func(header string) interface{} {
+		return mock.MatchedBy(func(opts minio.GetObjectOptions) bool {
+			return opts.Header().Get("Range") == header
+		})
+	}
+	serveRange := func(m *mocks.MockMinioClient, header string, start, end int) {
+		m.On("GetObject", mock.Anything, "testbucket", "abc123", withRange(header)).
+			Return(&readerObject{Reader: strings.NewReader(content[start:end]), info: info}, nil)
+	}
+
+	tests := []struct {
+		name            string
+		rangeHeader     string
+		setupMock       func(*mocks.MockMinioClient)
+		expectedStatus  int
+		expectedBody    string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:        "Single range",
+			rangeHeader: "bytes=2-5",
+			setupMock: func(m *mocks.MockMinioClient) {
+				serveRange(m, "bytes=2-5", 2, 6)
+			},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   "2345",
+			expectedHeaders: map[string]string{
+				"Content-Range":  "bytes 2-5/10",
+				"Content-Length": "4",
+				"Accept-Ranges":  "bytes",
+			},
+		},
+		{
+			name:        "Suffix range",
+			rangeHeader: "bytes=-3",
+			setupMock: func(m *mocks.MockMinioClient) {
+				serveRange(m, "bytes=7-9", 7, 10)
+			},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   "789",
+			expectedHeaders: map[string]string{
+				"Content-Range": "bytes 7-9/10",
+			},
+		},
+		{
+			name:           "Unsatisfiable range",
+			rangeHeader:    "bytes=20-30",
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusRequestedRangeNotSatisfiable,
+			expectedBody:   "Requested range not satisfiable\n",
+			expectedHeaders: map[string]string{
+				"Content-Range": "bytes */10",
+			},
+		},
+		{
+			name:        "Malformed range is ignored",
+			rangeHeader: "bytes=oops",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader(content), info: info}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   content,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+			mockClient.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(info, nil)
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Get("/buckets/{bucketName}/objects/{id}", h.HandleGetObject)
+
+			req, _ := http.NewRequest("GET", "/buckets/testbucket/objects/abc123", nil)
+			req.Header.Set("Range", tt.rangeHeader)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedBody, rr.Body.String())
+			for key, value := range tt.expectedHeaders {
+				assert.Equal(t, value, rr.Header().Get(key), key)
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Multiple ranges", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+		mockClient.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(info, nil)
+		serveRange(mockClient, "bytes=0-1", 0, 2)
+		serveRange(mockClient, "bytes=8-9", 8, 10)
+
+		h := NewHandler(nil, logger)
+		h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+			return mockClient, nil
+		}
+
+		r := chi.NewRouter()
+		r.Get("/buckets/{bucketName}/objects/{id}", h.HandleGetObject)
+
+		req, _ := http.NewRequest("GET", "/buckets/testbucket/objects/abc123", nil)
+		req.Header.Set("Range", "bytes=0-1,-2")
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusPartialContent, rr.Code)
+		mediaType, params, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/byteranges", mediaType)
+
+		mr := multipart.NewReader(rr.Body, params["boundary"])
+		var ranges, bodies []string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			body, _ := io.ReadAll(part)
+			ranges = append(ranges, part.Header.Get("Content-Range"))
+			bodies = append(bodies, string(body))
+		}
+		assert.Equal(t, []string{"bytes 0-1/10", "bytes 8-9/10"}, ranges)
+		assert.Equal(t, []string{"01", "89"}, bodies)
+		mockClient.AssertExpectations(t)
+	})
+}
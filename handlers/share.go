@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	"github.com/spacelift-io/homework-object-storage/share"
+)
+
+const (
+	defaultShareExpiry = 24 * time.Hour
+	maxShareExpiry     = 30 * 24 * time.Hour
+	// shareCounterPrefix holds the download counter of every share link with
+	// a download limit in the internal bucket, named by the bucket of the
+	// shared object and the link's nonce.
+	shareCounterPrefix = "shares/"
+	// shareDownloadsKey is the metadata key the counter is kept in.
+	shareDownloadsKey = "Downloads"
+	// shareResumeETagKey and shareResumeOffsetKey keep where the last
+	// interrupted download of a link stopped.
+	shareResumeETagKey   = "Resume-Etag"
+	shareResumeOffsetKey = "Resume-Offset"
+	// maxShareClaimAttempts bounds the retries when concurrent downloads race
+	// to update the same counter.
+	maxShareClaimAttempts = 5
+)
+
+var (
+	errShareExhausted  = errors.New("share link download limit reached")
+	errShareContention = errors.New("share link counter is contended")
+	errShareRefused    = errors.New("share link download was refused")
+)
+
+type shareRequest struct {
+	// ExpiresIn is the lifetime of the link in seconds.
+	ExpiresIn    int64  `json:"expiresIn"`
+	MaxDownloads int    `json:"maxDownloads"`
+	AllowedCIDR  string `json:"allowedCidr"`
+}
+
+type shareResponse struct {
+	URL       string    `json:"url"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WithShareSigner enables share links signed by signer.
+func WithShareSigner(signer *share.Signer) Option {
+	return func(h *Handler) {
+		h.shareSigner = signer
+	}
+}
+
+// HandleCreateShare mints a link through which the object can be downloaded
+// without any other credentials.
+func (h *Handler) HandleCreateShare(w http.ResponseWriter, r *http.Request) {
+	if h.shareSigner == nil {
+		http.Error(w, "Share links are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	expiry := defaultShareExpiry
+	if req.ExpiresIn != 0 {
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+		if req.ExpiresIn < 1 || expiry > maxShareExpiry {
+			http.Error(w, fmt.Sprintf("expiresIn must be between 1 and %d seconds", int64(maxShareExpiry/time.Second)), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.MaxDownloads < 0 {
+		http.Error(w, "maxDownloads must not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.AllowedCIDR != "" {
+		if _, _, err := net.ParseCIDR(req.AllowedCIDR); err != nil {
+			http.Error(w, "Invalid allowedCidr", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+	})
+
+	_, err := ref.client.StatObject(r.Context(), ref.bucket, ref.id, minio.StatObjectOptions{})
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			http.Error(w, "Object not found", http.StatusNotFound)
+			return
+		}
+		log.WithError(err).Error("Failed to stat object")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(expiry).UTC().Truncate(time.Second)
+	claims := share.Claims{
+		Bucket:       ref.bucket,
+		ID:           ref.id,
+		ExpiresAt:    expiresAt.Unix(),
+		MaxDownloads: req.MaxDownloads,
+		AllowedCIDR:  req.AllowedCIDR,
+	}
+	if claims.MaxDownloads > 0 {
+		claims.Nonce, err = share.NewNonce()
+	}
+	var token string
+	if err == nil {
+		token, err = h.shareSigner.Sign(claims)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to sign share link")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	log.WithField("expiresAt", expiresAt).Info("Created share link")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shareResponse{
+		URL:       fmt.Sprintf("%s://%s/share/%s", scheme, r.Host, token),
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// HandleShareDownload serves the object a share link points to. Downloads
+// count against the link's download limit, if it has one.
+func (h *Handler) HandleShareDownload(w http.ResponseWriter, r *http.Request) {
+	if h.shareSigner == nil {
+		http.Error(w, "Share links are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	claims, err := h.shareSigner.Verify(chi.URLParam(r, "token"), time.Now())
+	switch {
+	case errors.Is(err, share.ErrExpired):
+		http.Error(w, "Share link expired", http.StatusGone)
+		return
+	case err != nil:
+		http.Error(w, "Invalid share link", http.StatusForbidden)
+		return
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": claims.Bucket,
+		"id":     claims.ID,
+	})
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !claims.AllowsIP(net.ParseIP(host)) {
+		log.WithField("remoteAddr", r.RemoteAddr).Warn("Share link used from outside its allowed range")
+		http.Error(w, "Share link not valid from this address", http.StatusForbidden)
+		return
+	}
+
+	ref, ok := h.locate(w, r, claims.Bucket, claims.ID)
+	if !ok {
+		return
+	}
+
+	if claims.MaxDownloads > 0 {
+		h.serveLimitedShare(w, r, ref, claims, log)
+		return
+	}
+
+	h.serveObject(w, r, ref)
+}
+
+// serveLimitedShare serves the object of a link with a download limit. Only
+// a response that starts sending the object counts as a download. A range
+// request picking up exactly where a counted download of the same object
+// stopped continues that download and is not counted again.
+func (h *Handler) serveLimitedShare(w http.ResponseWriter, r *http.Request, ref objectRef, claims share.Claims, log *logrus.Entry) {
+	respondError := func(w http.ResponseWriter, err error) {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errShareExhausted):
+			http.Error(w, "Share link download limit reached", http.StatusGone)
+		case errors.Is(err, errShareContention):
+			http.Error(w, "Share link is busy, retry later", http.StatusServiceUnavailable)
+		default:
+			log.WithError(err).Error("Failed to count share link download")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+
+	counter, err := h.loadShareCounter(r.Context(), ref, claims)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	// Whether a range continues a download is only known from the response.
+	if counter.downloads >= claims.MaxDownloads && (counter.resumeETag == "" || r.Header.Get("Range") == "") {
+		respondError(w, errShareExhausted)
+		return
+	}
+
+	dw := &shareDownloadWriter{
+		ResponseWriter: w,
+		resumeETag:     counter.resumeETag,
+		resumeOffset:   counter.resumeOffset,
+		charge: func() error {
+			return h.updateShareCounter(r.Context(), ref, claims, &counter, func(c *shareCounter) error {
+				if c.downloads >= claims.MaxDownloads {
+					return errShareExhausted
+				}
+				c.downloads++
+				return nil
+			})
+		},
+		refuse: respondError,
+	}
+	h.serveObject(dw, r, ref)
+	if offset, ok := dw.resumable(); ok {
+		// The client is likely gone, the point it reached is kept regardless.
+		err := h.updateShareCounter(context.WithoutCancel(r.Context()), ref, claims, nil, func(c *shareCounter) error {
+			c.resumeETag, c.resumeOffset = dw.etag, offset
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).Warn("Failed to keep the progress of a share link download")
+		}
+	}
+}
+
+// shareCounter is the download count of a share link and the ETag of the
+// object it is kept in, empty if there is none yet. resumeETag and
+// resumeOffset are the object and offset a counted download stopped at
+// before the end of the object.
+type shareCounter struct {
+	downloads    int
+	resumeETag   string
+	resumeOffset int64
+	etag         string
+}
+
+func shareCounterKey(bucketName, nonce string) string {
+	return shareCounterPrefix + bucketName + "/" + nonce
+}
+
+func (h *Handler) loadShareCounter(ctx context.Context, ref objectRef, claims share.Claims) (shareCounter, error) {
+	info, err := ref.client.StatObject(ctx, internalBucket, shareCounterKey(ref.bucket, claims.Nonce), minio.StatObjectOptions{})
+	if err != nil {
+		// The internal bucket is only created with the first counter.
+		if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" || code == "NoSuchBucket" {
+			return shareCounter{}, nil
+		}
+		return shareCounter{}, err
+	}
+	downloads, _ := strconv.Atoi(info.UserMetadata[shareDownloadsKey])
+	resumeOffset, _ := strconv.ParseInt(info.UserMetadata[shareResumeOffsetKey], 10, 64)
+	return shareCounter{
+		downloads:    downloads,
+		resumeETag:   info.UserMetadata[shareResumeETagKey],
+		resumeOffset: resumeOffset,
+		etag:         info.ETag,
+	}, nil
+}
+
+// updateShareCounter applies update to the counter of a link. The counter
+// lives in the internal bucket of the instance serving the object and is
+// updated with a conditional write starting from counter, or from a fresh
+// read if nil, so concurrent downloads cannot exceed the limit. The counter
+// expires with the link and is then removed by the expiry sweeper.
+func (h *Handler) updateShareCounter(ctx context.Context, ref objectRef, claims share.Claims, counter *shareCounter, update func(*shareCounter) error) error {
+	if err := h.ensureInternalBucket(ctx, ref.client); err != nil {
+		return err
+	}
+	key := shareCounterKey(ref.bucket, claims.Nonce)
+	for attempt := 0; attempt < maxShareClaimAttempts; attempt++ {
+		if counter == nil || attempt > 0 {
+			current, err := h.loadShareCounter(ctx, ref, claims)
+			if err != nil {
+				return err
+			}
+			counter = &current
+		}
+		next := *counter
+		if err := update(&next); err != nil {
+			return err
+		}
+
+		opts := minio.PutObjectOptions{}
+		if counter.etag != "" {
+			opts.SetMatchETag(counter.etag)
+		} else {
+			opts.SetMatchETagExcept("*")
+		}
+		opts.UserMetadata = map[string]string{
+			shareDownloadsKey: strconv.Itoa(next.downloads),
+			expiresAtKey:      strconv.FormatInt(claims.ExpiresAt, 10),
+		}
+		if next.resumeETag != "" {
+			opts.UserMetadata[shareResumeETagKey] = next.resumeETag
+			opts.UserMetadata[shareResumeOffsetKey] = strconv.FormatInt(next.resumeOffset, 10)
+		}
+		// The state is also the body so that every value has its own ETag.
+		body := fmt.Sprintf("%d %s %d", next.downloads, next.resumeETag, next.resumeOffset)
+		_, err := ref.client.PutObject(ctx, internalBucket, key, strings.NewReader(body), int64(len(body)), opts)
+		if err == nil {
+			*counter = next
+			return nil
+		}
+		if minio.ToErrorResponse(err).Code != "PreconditionFailed" {
+			return err
+		}
+	}
+	return errShareContention
+}
+
+// shareDownloadWriter counts a download when the object is about to be sent,
+// so failed lookups and precondition responses are free. If the download
+// cannot be counted, the response is replaced by the error. A partial
+// response starting at resumeOffset of the object with resumeETag is not
+// counted.
+type shareDownloadWriter struct {
+	http.ResponseWriter
+	resumeETag   string
+	resumeOffset int64
+	charge       func() error
+	refuse       func(http.ResponseWriter, error)
+
+	wroteHeader bool
+	sending     bool
+	refused     bool
+	// etag, start and size describe the object and the offset the response
+	// starts at. start is -1 for responses of several ranges.
+	etag    string
+	start   int64
+	size    int64
+	written int64
+}
+
+func (d *shareDownloadWriter) WriteHeader(status int) {
+	if d.wroteHeader {
+		return
+	}
+	d.wroteHeader = true
+	if status == http.StatusOK || status == http.StatusPartialContent {
+		header := d.Header()
+		d.etag = strings.Trim(header.Get("ETag"), `"`)
+		d.start, d.size = responseSpan(status, header)
+		continued := status == http.StatusPartialContent && d.resumeETag != "" &&
+			d.etag == d.resumeETag && d.start > 0 && d.start == d.resumeOffset
+		if !continued {
+			if err := d.charge(); err != nil {
+				d.refused = true
+				for key := range header {
+					delete(header, key)
+				}
+				d.refuse(d.ResponseWriter, err)
+				return
+			}
+		}
+		d.sending = true
+	}
+	d.ResponseWriter.WriteHeader(status)
+}
+
+func (d *shareDownloadWriter) Write(p []byte) (int, error) {
+	if !d.wroteHeader {
+		d.WriteHeader(http.StatusOK)
+	}
+	if d.refused {
+		return 0, errShareRefused
+	}
+	n, err := d.ResponseWriter.Write(p)
+	d.written += int64(n)
+	return n, err
+}
+
+// resumable returns the offset the response stopped at, if it sent part of
+// the object and stopped before its end.
+func (d *shareDownloadWriter) resumable() (int64, bool) {
+	if !d.sending || d.start < 0 || d.etag == "" || d.written == 0 {
+		return 0, false
+	}
+	offset := d.start + d.written
+	return offset, offset < d.size
+}
+
+// responseSpan returns the offset a response of the object starts at and
+// the size of the object, with a start of -1 if the response is not a
+// single span of the object.
+func responseSpan(status int, header http.Header) (int64, int64) {
+	if status == http.StatusOK {
+		size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if err != nil {
+			return -1, 0
+		}
+		return 0, size
+	}
+	var start, end, size int64
+	if _, err := fmt.Sscanf(header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return -1, 0
+	}
+	return start, size
+}
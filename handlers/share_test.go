@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+	"github.com/spacelift-io/homework-object-storage/share"
+)
+
+func testShareSigner(t *testing.T) *share.Signer {
+	signer, err := share.NewSigner([]share.Key{{ID: "test", Secret: []byte(strings.Repeat("k", 32))}})
+	require.NoError(t, err)
+	return signer
+}
+
+func TestHandleCreateShare(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	signer := testShareSigner(t)
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedClaims share.Claims
+		expectedBody   string
+	}{
+		{
+			name: "Limited link",
+			body: `{"expiresIn":60,"maxDownloads":2,"allowedCidr":"10.0.0.0/8"}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedClaims: share.Claims{KeyID: "test", Bucket: "testbucket", ID: "abc123", MaxDownloads: 2, AllowedCIDR: "10.0.0.0/8"},
+		},
+		{
+			name: "Missing object",
+			body: `{}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Object not found",
+		},
+		{
+			name:           "Invalid CIDR",
+			body:           `{"allowedCidr":"10.0.0.1"}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid allowedCidr",
+		},
+		{
+			name:           "Expiry above the maximum",
+			body:           `{"expiresIn":2592001}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "expiresIn must be between 1 and 2592000 seconds",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil).Maybe()
+			mockClient.On("BucketExists", mock.Anything, internalBucket).Return(true, nil).Maybe()
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger, WithShareSigner(signer))
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Post("/buckets/{bucketName}/objects/{id}/share", h.HandleCreateShare)
+
+			req, _ := http.NewRequest("POST", "http://gateway:3000/buckets/testbucket/objects/abc123/share", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				assert.Equal(t, tt.expectedBody, strings.TrimSpace(rr.Body.String()))
+				return
+			}
+			var resp shareResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, "http://gateway:3000/share/"+resp.Token, resp.URL)
+			claims, err := signer.Verify(resp.Token, time.Now())
+			require.NoError(t, err)
+			assert.Equal(t, resp.ExpiresAt.Unix(), claims.ExpiresAt)
+			assert.NotEmpty(t, claims.Nonce)
+			claims.ExpiresAt, claims.Nonce = 0, ""
+			assert.Equal(t, tt.expectedClaims, claims)
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleShareDownload(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	signer := testShareSigner(t)
+
+	sign := func(claims share.Claims) string {
+		claims.Bucket, claims.ID = "testbucket", "abc123"
+		if claims.ExpiresAt == 0 {
+			claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+		}
+		token, err := signer.Sign(claims)
+		require.NoError(t, err)
+		return token
+	}
+	serveObject := func(m *mocks.MockMinioClient) {
+		m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+			Return(&readerObject{Reader: strings.NewReader("hello"), info: minio.ObjectInfo{Size: 5, ContentType: "text/plain"}}, nil)
+	}
+	counterKey := shareCounterKey("testbucket", "n1")
+	resumeAt := func(etag string, offset int64, downloads int) map[string]string {
+		return map[string]string{
+			shareDownloadsKey:    strconv.Itoa(downloads),
+			shareResumeETagKey:   etag,
+			shareResumeOffsetKey: strconv.FormatInt(offset, 10),
+		}
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		remoteAddr     string
+		headers        map[string]string
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Unlimited link",
+			token:          sign(share.Claims{}),
+			setupMock:      serveObject,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "hello",
+		},
+		{
+			name:  "First download of a limited link",
+			token: sign(share.Claims{MaxDownloads: 2, Nonce: "n1"}),
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"})
+				m.On("PutObject", mock.Anything, internalBucket, counterKey, mock.Anything, mock.Anything, mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+					// The counter is swept once the link has expired.
+					return opts.UserMetadata[shareDownloadsKey] == "1" && opts.UserMetadata[expiresAtKey] != ""
+				})).Return(minio.UploadInfo{}, nil)
+				serveObject(m)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "hello",
+		},
+		{
+			name:  "Concurrent download wins the race",
+			token: sign(share.Claims{MaxDownloads: 2, Nonce: "n1"}),
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e0", UserMetadata: map[string]string{shareDownloadsKey: "0"}}, nil).Once()
+				m.On("PutObject", mock.Anything, internalBucket, counterKey, mock.Anything, mock.Anything, mock.Anything).
+					Return(minio.UploadInfo{}, minio.ErrorResponse{Code: "PreconditionFailed"}).Once()
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e1", UserMetadata: map[string]string{shareDownloadsKey: "1"}}, nil).Once()
+				m.On("PutObject", mock.Anything, internalBucket, counterKey, mock.Anything, mock.Anything, mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+					return opts.UserMetadata[shareDownloadsKey] == "2"
+				})).Return(minio.UploadInfo{}, nil).Once()
+				serveObject(m)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "hello",
+		},
+		{
+			name:  "Download limit reached",
+			token: sign(share.Claims{MaxDownloads: 2, Nonce: "n1"}),
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e2", UserMetadata: map[string]string{shareDownloadsKey: "2"}}, nil)
+			},
+			expectedStatus: http.StatusGone,
+			expectedBody:   "Share link download limit reached\n",
+		},
+		{
+			name:  "Missing object is not counted",
+			token: sign(share.Claims{MaxDownloads: 2, Nonce: "n1"}),
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchBucket"})
+				m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(nil, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Object not found\n",
+		},
+		{
+			name:    "Range continuation is not counted",
+			token:   sign(share.Claims{MaxDownloads: 1, Nonce: "n1"}),
+			headers: map[string]string{"Range": "bytes=2-"},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e1", UserMetadata: resumeAt("obj", 2, 1)}, nil)
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{Size: 5, ETag: "obj"}, nil)
+				m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("llo")}, nil)
+			},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   "llo",
+		},
+		{
+			name:    "Suffix range is counted",
+			token:   sign(share.Claims{MaxDownloads: 2, Nonce: "n1"}),
+			headers: map[string]string{"Range": "bytes=-5"},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e1", UserMetadata: resumeAt("obj", 2, 1)}, nil)
+				m.On("PutObject", mock.Anything, internalBucket, counterKey, mock.Anything, mock.Anything, mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+					return opts.UserMetadata[shareDownloadsKey] == "2"
+				})).Return(minio.UploadInfo{}, nil)
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{Size: 5, ETag: "obj"}, nil)
+				m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("hello")}, nil)
+			},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   "hello",
+		},
+		{
+			name:    "Range elsewhere in the object is refused at the limit",
+			token:   sign(share.Claims{MaxDownloads: 1, Nonce: "n1"}),
+			headers: map[string]string{"Range": "bytes=1-"},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e1", UserMetadata: resumeAt("obj", 2, 1)}, nil)
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{Size: 5, ETag: "obj"}, nil)
+				m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("ello")}, nil).Maybe()
+			},
+			expectedStatus: http.StatusGone,
+			expectedBody:   "Share link download limit reached\n",
+		},
+		{
+			name:    "Range of a changed object is refused at the limit",
+			token:   sign(share.Claims{MaxDownloads: 1, Nonce: "n1"}),
+			headers: map[string]string{"Range": "bytes=2-"},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e1", UserMetadata: resumeAt("obj", 2, 1)}, nil)
+				m.On("StatObject", mock.Anything, "testbucket", "abc123", mock.Anything).Return(minio.ObjectInfo{Size: 5, ETag: "new"}, nil)
+				m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("llo")}, nil).Maybe()
+			},
+			expectedStatus: http.StatusGone,
+			expectedBody:   "Share link download limit reached\n",
+		},
+		{
+			name:  "Interrupted download keeps the offset it reached",
+			token: sign(share.Claims{MaxDownloads: 2, Nonce: "n1"}),
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e0", UserMetadata: map[string]string{shareDownloadsKey: "0"}}, nil).Once()
+				m.On("PutObject", mock.Anything, internalBucket, counterKey, mock.Anything, mock.Anything, mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+					return opts.UserMetadata[shareDownloadsKey] == "1"
+				})).Return(minio.UploadInfo{}, nil).Once()
+				// The object ends before its advertised size.
+				m.On("GetObject", mock.Anything, "testbucket", "abc123", mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("he"), info: minio.ObjectInfo{Size: 5, ETag: "obj"}}, nil)
+				m.On("StatObject", mock.Anything, internalBucket, counterKey, mock.Anything).
+					Return(minio.ObjectInfo{ETag: "e1", UserMetadata: map[string]string{shareDownloadsKey: "1"}}, nil).Once()
+				m.On("PutObject", mock.Anything, internalBucket, counterKey, mock.Anything, mock.Anything, mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+					return opts.UserMetadata[shareDownloadsKey] == "1" &&
+						opts.UserMetadata[shareResumeETagKey] == "obj" && opts.UserMetadata[shareResumeOffsetKey] == "2"
+				})).Return(minio.UploadInfo{}, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "he",
+		},
+		{
+			name:           "Expired link",
+			token:          sign(share.Claims{ExpiresAt: time.Now().Add(-time.Minute).Unix()}),
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusGone,
+			expectedBody:   "Share link expired\n",
+		},
+		{
+			name:           "Forged link",
+			token:          sign(share.Claims{}) + "x",
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Invalid share link\n",
+		},
+		{
+			name:           "Client outside the allowed range",
+			token:          sign(share.Claims{AllowedCIDR: "10.0.0.0/8"}),
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Share link not valid from this address\n",
+		},
+		{
+			name:           "Client inside the allowed range",
+			token:          sign(share.Claims{AllowedCIDR: "10.0.0.0/8"}),
+			remoteAddr:     "10.1.2.3:54321",
+			setupMock:      serveObject,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil).Maybe()
+			mockClient.On("BucketExists", mock.Anything, internalBucket).Return(true, nil).Maybe()
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger, WithShareSigner(signer))
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Get("/share/{token}", h.HandleShareDownload)
+
+			req, _ := http.NewRequest("GET", "/share/"+tt.token, nil)
+			req.RemoteAddr = "203.0.113.7:54321"
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedBody, rr.Body.String())
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
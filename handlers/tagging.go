@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"github.com/sirupsen/logrus"
+)
+
+// objectTaggingHeader carries the tags of an uploaded object, URL query
+// encoded like key1=value1&key2=value2.
+const objectTaggingHeader = "X-Object-Tagging"
+
+type objectTags struct {
+	Tags map[string]string `json:"tags"`
+}
+
+// parseTaggingHeader parses the tags of an upload request. The error is meant
+// for the client.
+func parseTaggingHeader(r *http.Request) (map[string]string, error) {
+	value := r.Header.Get(objectTaggingHeader)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := tags.ParseObjectTags(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s header: %v", objectTaggingHeader, err)
+	}
+	return parsed.ToMap(), nil
+}
+
+// tagCondition requires a tag. Without a value only the key must be present.
+type tagCondition struct {
+	key, value string
+	anyValue   bool
+}
+
+// tagFilter selects listed objects having every tag in it.
+type tagFilter []tagCondition
+
+// parseTagFilter parses tag query parameters of the form key=value or key.
+func parseTagFilter(values []string) (tagFilter, error) {
+	var filter tagFilter
+	for _, value := range values {
+		key, tagValue, found := strings.Cut(value, "=")
+		if key == "" {
+			return nil, fmt.Errorf("Invalid tag filter %q", value)
+		}
+		filter = append(filter, tagCondition{key: key, value: tagValue, anyValue: !found})
+	}
+	return filter, nil
+}
+
+// matches reports whether an object with the given tags passes every filter.
+func (f tagFilter) matches(objectTags map[string]string) bool {
+	for _, cond := range f {
+		value, ok := objectTags[cond.key]
+		if !ok || (!cond.anyValue && value != cond.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// HandleGetObjectTags returns the tags of an object.
+func (h *Handler) HandleGetObjectTags(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	ref = requestVersion(r, ref)
+
+	t, err := ref.client.GetObjectTagging(r.Context(), ref.bucket, ref.id, minio.GetObjectTaggingOptions{VersionID: ref.versionID})
+	if err != nil {
+		h.respondTaggingError(w, ref, err, "Failed to get object tags")
+		return
+	}
+
+	resp := objectTags{Tags: map[string]string{}}
+	if t != nil {
+		resp.Tags = t.ToMap()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandlePutObjectTags replaces the tags of an object.
+func (h *Handler) HandlePutObjectTags(w http.ResponseWriter, r *http.Request) {
+	var req objectTags
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	t, err := tags.NewTags(req.Tags, true)
+	if err != nil {
+		http.Error(w, "Invalid tags: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	ref = requestVersion(r, ref)
+
+	err = ref.client.PutObjectTagging(r.Context(), ref.bucket, ref.id, t, minio.PutObjectTaggingOptions{VersionID: ref.versionID})
+	if err != nil {
+		h.respondTaggingError(w, ref, err, "Failed to set object tags")
+		return
+	}
+
+	resp := objectTags{Tags: t.ToMap()}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleDeleteObjectTags removes every tag of an object.
+func (h *Handler) HandleDeleteObjectTags(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	ref = requestVersion(r, ref)
+
+	err := ref.client.RemoveObjectTagging(r.Context(), ref.bucket, ref.id, minio.RemoveObjectTaggingOptions{VersionID: ref.versionID})
+	if err != nil {
+		h.respondTaggingError(w, ref, err, "Failed to delete object tags")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) respondTaggingError(w http.ResponseWriter, ref objectRef, err error, message string) {
+	if h.respondUnavailable(w, err) {
+		return
+	}
+	if objectNotFound(err) {
+		http.Error(w, "Object not found", http.StatusNotFound)
+		return
+	}
+	h.logger.WithError(err).WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+	}).Error(message)
+	http.Error(w, message, http.StatusInternalServerError)
+}
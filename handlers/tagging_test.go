@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestTagFilter(t *testing.T) {
+	filter, err := parseTagFilter([]string{"project=alpha", "class", "empty="})
+	assert.NoError(t, err)
+
+	assert.True(t, filter.matches(map[string]string{"project": "alpha", "class": "cold", "empty": ""}))
+	assert.False(t, filter.matches(map[string]string{"project": "alpha", "empty": ""}))
+	assert.False(t, filter.matches(map[string]string{"project": "beta", "class": "cold", "empty": ""}))
+	assert.False(t, filter.matches(nil))
+	assert.True(t, tagFilter(nil).matches(nil))
+
+	_, err = parseTagFilter([]string{"=alpha"})
+	assert.Error(t, err)
+}
+
+func TestObjectTags(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	projectTags, _ := tags.NewTags(map[string]string{"project": "alpha"}, true)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		setupMock      func(*mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "Get tags",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc/tags",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObjectTagging", mock.Anything, "mybucket", "abc", minio.GetObjectTaggingOptions{}).Return(projectTags, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"tags":{"project":"alpha"}}` + "\n",
+		},
+		{
+			name:   "Get tags of a version",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc/tags?versionId=v1",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObjectTagging", mock.Anything, "mybucket", "abc", minio.GetObjectTaggingOptions{VersionID: "v1"}).
+					Return(tags.NewTags(nil, true))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"tags":{}}` + "\n",
+		},
+		{
+			name:   "Get tags of a missing object",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc/tags",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObjectTagging", mock.Anything, "mybucket", "abc", mock.Anything).
+					Return(nil, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Object not found\n",
+		},
+		{
+			name:   "Put tags",
+			method: "PUT",
+			url:    "/buckets/mybucket/objects/abc/tags",
+			body:   `{"tags":{"project":"alpha"}}`,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("PutObjectTagging", mock.Anything, "mybucket", "abc", projectTags, minio.PutObjectTaggingOptions{}).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"tags":{"project":"alpha"}}` + "\n",
+		},
+		{
+			name:           "Put too many tags",
+			method:         "PUT",
+			url:            "/buckets/mybucket/objects/abc/tags",
+			body:           `{"tags":{"a":"1","b":"2","c":"3","d":"4","e":"5","f":"6","g":"7","h":"8","i":"9","j":"10","k":"11"}}`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Put invalid body",
+			method:         "PUT",
+			url:            "/buckets/mybucket/objects/abc/tags",
+			body:           `{`,
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid request body\n",
+		},
+		{
+			name:   "Delete tags",
+			method: "DELETE",
+			url:    "/buckets/mybucket/objects/abc/tags",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("RemoveObjectTagging", mock.Anything, "mybucket", "abc", minio.RemoveObjectTaggingOptions{}).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "mybucket").Return(true, nil).Maybe()
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Get("/buckets/{bucketName}/objects/{id}/tags", h.HandleGetObjectTags)
+			r.Put("/buckets/{bucketName}/objects/{id}/tags", h.HandlePutObjectTags)
+			r.Delete("/buckets/{bucketName}/objects/{id}/tags", h.HandleDeleteObjectTags)
+
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+	// tusKeyPrefix holds the state of every upload in progress in the
+	// internal bucket: an info document and the chunks received so far, named
+	// after their offset.
+	tusKeyPrefix = "tus/"
+)
+
+// tusSubChunkSize bounds the chunks a PATCH is stored in, and so what is lost
+// when a PATCH is interrupted: only the bytes of a sub-chunk that could not be
+// stored.
+var tusSubChunkSize = 8 << 20
+
+// tusUpload is the info document of an upload.
+type tusUpload struct {
+	// ObjectID is the object the upload is assembled into.
+	ObjectID string `json:"objectId"`
+	Length   int64  `json:"length"`
+	// Metadata is the Upload-Metadata header the upload was created with.
+	Metadata string `json:"metadata,omitempty"`
+}
+
+type tusChunk struct {
+	key  string
+	size int64
+}
+
+func tusInfoKey(bucketName, uploadID string) string {
+	return tusKeyPrefix + bucketName + "/" + uploadID + "/info"
+}
+
+func tusChunkPrefix(bucketName, uploadID string) string {
+	return tusKeyPrefix + bucketName + "/" + uploadID + "/chunks/"
+}
+
+func tusChunkKey(bucketName, uploadID string, offset int64) string {
+	return fmt.Sprintf("%s%020d", tusChunkPrefix(bucketName, uploadID), offset)
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma separated
+// keys, each optionally followed by a space and a base64 value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkTusResumable rejects requests speaking a tus version we do not support.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) HandleTusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTusCreate starts an upload. The object it is assembled into is named
+// by the id key of Upload-Metadata.
+func (h *Handler) HandleTusCreate(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	bucketName := chi.URLParam(r, "bucketName")
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateID(metadata["id"]); err != nil || metadata["id"] == "" {
+		http.Error(w, "Upload-Metadata must name a valid object id", http.StatusBadRequest)
+		return
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate upload ID")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	ref, ok := h.locate(w, r, bucketName, uploadID)
+	if !ok {
+		return
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket":   bucketName,
+		"uploadId": uploadID,
+		"id":       metadata["id"],
+	})
+
+	// The whole length is reserved up front, as the chunks take up space
+	// in the internal bucket until the object is assembled.
+	var reservation *quotaReservation
+	if h.quotas != nil {
+		target, ok := h.locate(w, r, bucketName, metadata["id"])
+		if !ok {
+			return
+		}
+		if reservation, ok = h.reserveQuota(w, r, target, length); !ok {
+			return
+		}
+	}
+
+	upload := tusUpload{ObjectID: metadata["id"], Length: length, Metadata: r.Header.Get("Upload-Metadata")}
+	info, _ := json.Marshal(upload)
+	err = h.ensureInternalBucket(r.Context(), ref.client)
+	if err == nil {
+		_, err = ref.client.PutObject(r.Context(), internalBucket, tusInfoKey(bucketName, uploadID), bytes.NewReader(info), int64(len(info)),
+			minio.PutObjectOptions{ContentType: "application/json"})
+	}
+	if err != nil {
+		reservation.release()
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		log.WithError(err).Error("Failed to create upload")
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	if length == 0 {
+		if err := h.assembleTusUpload(r.Context(), ref, upload, nil); err != nil {
+			reservation.release()
+			if h.respondUnavailable(w, err) {
+				return
+			}
+			log.WithError(err).Error("Failed to assemble upload")
+			http.Error(w, "Failed to assemble upload", http.StatusInternalServerError)
+			return
+		}
+		reservation.commit(0)
+	} else {
+		h.quotas.hold(tusInfoKey(bucketName, uploadID), reservation)
+	}
+
+	log.Info("Created tus upload")
+	w.Header().Set("Location", "/buckets/"+bucketName+"/uploads/"+uploadID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// resolveTusUpload locates an upload from the route and loads its state,
+// writing an error response on failure.
+func (h *Handler) resolveTusUpload(w http.ResponseWriter, r *http.Request) (objectRef, tusUpload, []tusChunk, bool) {
+	bucketName := chi.URLParam(r, "bucketName")
+	uploadID := chi.URLParam(r, "uploadId")
+	if validateID(uploadID) != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return objectRef{}, tusUpload{}, nil, false
+	}
+	ref, ok := h.locate(w, r, bucketName, uploadID)
+	if !ok {
+		return objectRef{}, tusUpload{}, nil, false
+	}
+
+	upload, chunks, err := h.loadTusUpload(r.Context(), ref)
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return objectRef{}, tusUpload{}, nil, false
+		}
+		// The internal bucket is only created with the first upload.
+		if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" || code == "NoSuchBucket" {
+			http.Error(w, "Upload not found", http.StatusNotFound)
+			return objectRef{}, tusUpload{}, nil, false
+		}
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"bucket":   bucketName,
+			"uploadId": uploadID,
+		}).Error("Failed to load upload")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return objectRef{}, tusUpload{}, nil, false
+	}
+	return ref, upload, chunks, true
+}
+
+func (h *Handler) loadTusUpload(ctx context.Context, ref objectRef) (tusUpload, []tusChunk, error) {
+	var upload tusUpload
+	object, err := ref.client.GetObject(ctx, internalBucket, tusInfoKey(ref.bucket, ref.id), minio.GetObjectOptions{})
+	if err != nil {
+		return upload, nil, err
+	}
+	defer object.Close()
+	if err := json.NewDecoder(object).Decode(&upload); err != nil {
+		return upload, nil, err
+	}
+
+	// Chunk keys encode their zero padded offset, so listing order is upload order.
+	var chunks []tusChunk
+	for entry := range ref.client.ListObjects(ctx, internalBucket, minio.ListObjectsOptions{Prefix: tusChunkPrefix(ref.bucket, ref.id), Recursive: true}) {
+		if entry.Err != nil {
+			return upload, nil, entry.Err
+		}
+		chunks = append(chunks, tusChunk{key: entry.Key, size: entry.Size})
+	}
+	return upload, chunks, nil
+}
+
+func tusOffset(chunks []tusChunk) int64 {
+	var offset int64
+	for _, chunk := range chunks {
+		offset += chunk.size
+	}
+	return offset
+}
+
+func (h *Handler) HandleTusHead(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	_, upload, chunks, ok := h.resolveTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(tusOffset(chunks), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleTusPatch appends the request body to an upload and assembles the
+// object once all of it has arrived. A PATCH without data at the final offset retries a
+// failed assembly.
+func (h *Handler) HandleTusPatch(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	ref, upload, chunks, ok := h.resolveTusUpload(w, r)
+	if !ok {
+		return
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket":   ref.bucket,
+		"uploadId": ref.id,
+		"offset":   offset,
+	})
+
+	// Reservations are only kept in memory, an upload resumed after a
+	// restart reserves its length again.
+	if h.quotas != nil && h.quotas.held(tusInfoKey(ref.bucket, ref.id)) == nil {
+		if _, limited := h.quotas.limit(ref.bucket); limited {
+			target, ok := h.locate(w, r, ref.bucket, upload.ObjectID)
+			if !ok {
+				return
+			}
+			reservation, ok := h.reserveQuota(w, r, target, upload.Length)
+			if !ok {
+				return
+			}
+			h.quotas.hold(tusInfoKey(ref.bucket, ref.id), reservation)
+		}
+	}
+
+	if current := tusOffset(chunks); offset != current {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(current, 10))
+		http.Error(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+		return
+	}
+	remaining := upload.Length - offset
+	if r.ContentLength > remaining {
+		http.Error(w, "Chunk exceeds Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	if remaining > 0 {
+		chunks, offset, ok = h.storeTusChunks(w, r, ref, chunks, offset, remaining, log)
+		if !ok {
+			return
+		}
+	}
+
+	if offset == upload.Length {
+		if err := h.assembleTusUpload(r.Context(), ref, upload, chunks); err != nil {
+			if h.respondUnavailable(w, err) {
+				return
+			}
+			log.WithError(err).Error("Failed to assemble upload")
+			http.Error(w, "Failed to assemble upload", http.StatusInternalServerError)
+			return
+		}
+		h.quotas.take(tusInfoKey(ref.bucket, ref.id)).commit(upload.Length)
+		log.WithField("id", upload.ObjectID).Info("Completed tus upload")
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeTusChunks stores up to remaining bytes of the request body as chunks
+// of at most tusSubChunkSize bytes, advancing the offset after each one, so an
+// interrupted PATCH keeps every byte that was received. It returns the chunks
+// and offset afterwards, writing an error response on failure.
+func (h *Handler) storeTusChunks(w http.ResponseWriter, r *http.Request, ref objectRef, chunks []tusChunk, offset, remaining int64, log *logrus.Entry) ([]tusChunk, int64, bool) {
+	// What was received is stored even if the client has gone away.
+	ctx := context.WithoutCancel(r.Context())
+	body := io.LimitReader(r.Body, remaining)
+	buf := make([]byte, min(int64(tusSubChunkSize), remaining))
+	for {
+		n, readErr := readSubChunk(body, buf)
+		if n > 0 {
+			key := tusChunkKey(ref.bucket, ref.id, offset)
+			opts := minio.PutObjectOptions{}
+			// Two clients resuming from the same offset must not both succeed.
+			opts.SetMatchETagExcept("*")
+			if _, err := ref.client.PutObject(ctx, internalBucket, key, bytes.NewReader(buf[:n]), int64(n), opts); err != nil {
+				w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+				if h.respondUnavailable(w, err) {
+					return nil, 0, false
+				}
+				if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+					http.Error(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+					return nil, 0, false
+				}
+				log.WithError(err).Error("Failed to store chunk")
+				http.Error(w, "Failed to store chunk", http.StatusInternalServerError)
+				return nil, 0, false
+			}
+			chunks = append(chunks, tusChunk{key: key, size: int64(n)})
+			offset += int64(n)
+		}
+		switch {
+		case readErr == io.EOF:
+			return chunks, offset, true
+		case readErr != nil:
+			log.WithError(readErr).WithField("received", offset).Info("Tus upload interrupted")
+			w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+			http.Error(w, "Failed to read chunk", http.StatusBadRequest)
+			return nil, 0, false
+		}
+	}
+}
+
+// readSubChunk fills buf from r. Unlike io.ReadFull it keeps the error of r,
+// so a body cut short is not mistaken for its end.
+func readSubChunk(r io.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// assembleTusUpload streams the chunks of a complete upload into the final
+// object and then drops the upload state.
+func (h *Handler) assembleTusUpload(ctx context.Context, ref objectRef, upload tusUpload, chunks []tusChunk) error {
+	target, err := h.getMinioClient(h.placementKey(ref.bucket, upload.ObjectID))
+	if err != nil {
+		return err
+	}
+	if ref.bucket == h.defaultBucket {
+		if err := h.ensureDefaultBucket(ctx, target); err != nil {
+			return err
+		}
+	}
+
+	opts := minio.PutObjectOptions{}
+	if metadata, err := parseUploadMetadata(upload.Metadata); err == nil {
+		opts.ContentType = metadata["filetype"]
+	}
+	body := &chunkReader{ctx: ctx, client: ref.client, chunks: chunks}
+	defer body.Close()
+	if _, err := target.PutObject(ctx, ref.bucket, upload.ObjectID, body, upload.Length, opts); err != nil {
+		return err
+	}
+
+	h.removeTusUpload(ctx, ref, chunks)
+	return nil
+}
+
+func (h *Handler) HandleTusDelete(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	ref, _, chunks, ok := h.resolveTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	h.removeTusUpload(r.Context(), ref, chunks)
+	h.quotas.take(tusInfoKey(ref.bucket, ref.id)).release()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeTusUpload deletes the state of an upload, info document last so a
+// partly removed upload can still be found and terminated again.
+func (h *Handler) removeTusUpload(ctx context.Context, ref objectRef, chunks []tusChunk) {
+	keys := make([]string, 0, len(chunks)+1)
+	for _, chunk := range chunks {
+		keys = append(keys, chunk.key)
+	}
+	keys = append(keys, tusInfoKey(ref.bucket, ref.id))
+	for _, key := range keys {
+		if err := ref.client.RemoveObject(ctx, internalBucket, key, minio.RemoveObjectOptions{}); err != nil {
+			h.logger.WithError(err).WithFields(logrus.Fields{
+				"bucket": ref.bucket,
+				"key":    key,
+			}).Warn("Failed to remove tus upload state")
+			return
+		}
+	}
+}
+
+// chunkReader reads the chunks of an upload back to back from the internal
+// bucket, opening each one only when the previous one is exhausted.
+type chunkReader struct {
+	ctx     context.Context
+	client  minio_adapter.MinioClientInterface
+	chunks  []tusChunk
+	current minio_adapter.MinioObject
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			object, err := c.client.GetObject(c.ctx, internalBucket, c.chunks[0].key, minio.GetObjectOptions{})
+			if err != nil {
+				return 0, err
+			}
+			c.current, c.chunks = object, c.chunks[1:]
+		}
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current != nil {
+		return c.current.Close()
+	}
+	return nil
+}
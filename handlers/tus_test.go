@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	metadata, err := parseUploadMetadata("id " + base64.StdEncoding.EncodeToString([]byte("abc123")) + ",is_confidential")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"id": "abc123", "is_confidential": ""}, metadata)
+
+	_, err = parseUploadMetadata("id !!!")
+	assert.EqualError(t, err, "invalid value for id")
+}
+
+func TestTusUploads(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	const uploadID = "0123456789abcdef0123456789abcdef"
+	idMetadata := "id " + base64.StdEncoding.EncodeToString([]byte("abc123"))
+	info := `{"objectId":"abc123","length":10,"metadata":"` + idMetadata + `"}`
+	infoKey := tusInfoKey("testbucket", uploadID)
+	chunkPrefix := tusChunkPrefix("testbucket", uploadID)
+	chunkKey := func(offset int64) string { return tusChunkKey("testbucket", uploadID, offset) }
+
+	withState := func(m *mocks.MockMinioClient, chunks ...minio.ObjectInfo) {
+		m.On("GetObject", mock.Anything, internalBucket, infoKey, mock.Anything).
+			Return(&readerObject{Reader: strings.NewReader(info)}, nil).Once()
+		m.On("ListObjects", mock.Anything, internalBucket, minio.ListObjectsOptions{Prefix: chunkPrefix, Recursive: true}).Return(chunks)
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		headers         map[string]string
+		body            string
+		setupMock       func(*mocks.MockMinioClient)
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name:           "Missing Tus-Resumable",
+			method:         "HEAD",
+			path:           "/buckets/testbucket/uploads/" + uploadID,
+			headers:        map[string]string{"Tus-Resumable": ""},
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:    "Create",
+			method:  "POST",
+			path:    "/buckets/testbucket/uploads",
+			headers: map[string]string{"Upload-Length": "10", "Upload-Metadata": idMetadata},
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("BucketExists", mock.Anything, internalBucket).Return(true, nil)
+				m.On("PutObject", mock.Anything, internalBucket, mock.MatchedBy(func(key string) bool {
+					return strings.HasPrefix(key, tusKeyPrefix) && strings.HasSuffix(key, "/info")
+				}), mock.Anything, mock.Anything, mock.Anything).Return(minio.UploadInfo{}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Create with invalid object id",
+			method:         "POST",
+			path:           "/buckets/testbucket/uploads",
+			headers:        map[string]string{"Upload-Length": "10", "Upload-Metadata": "id " + base64.StdEncoding.EncodeToString([]byte("not/valid"))},
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Head reports the offset",
+			method: "HEAD",
+			path:   "/buckets/testbucket/uploads/" + uploadID,
+			setupMock: func(m *mocks.MockMinioClient) {
+				withState(m, minio.ObjectInfo{Key: chunkKey(0), Size: 4})
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Upload-Offset":   "4",
+				"Upload-Length":   "10",
+				"Upload-Metadata": idMetadata,
+				"Cache-Control":   "no-store",
+			},
+		},
+		{
+			name:    "Patch at the wrong offset",
+			method:  "PATCH",
+			path:    "/buckets/testbucket/uploads/" + uploadID,
+			headers: map[string]string{"Upload-Offset": "0", "Content-Type": "application/offset+octet-stream"},
+			body:    "456789",
+			setupMock: func(m *mocks.MockMinioClient) {
+				withState(m, minio.ObjectInfo{Key: chunkKey(0), Size: 4})
+			},
+			expectedStatus:  http.StatusConflict,
+			expectedHeaders: map[string]string{"Upload-Offset": "4"},
+		},
+		{
+			name:           "Patch with the wrong content type",
+			method:         "PATCH",
+			path:           "/buckets/testbucket/uploads/" + uploadID,
+			headers:        map[string]string{"Upload-Offset": "0", "Content-Type": "text/plain"},
+			setupMock:      func(m *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:    "Final patch assembles the object",
+			method:  "PATCH",
+			path:    "/buckets/testbucket/uploads/" + uploadID,
+			headers: map[string]string{"Upload-Offset": "4", "Content-Type": "application/offset+octet-stream"},
+			body:    "456789",
+			setupMock: func(m *mocks.MockMinioClient) {
+				withState(m, minio.ObjectInfo{Key: chunkKey(0), Size: 4})
+				m.On("PutObject", mock.Anything, internalBucket, chunkKey(4), mock.Anything, int64(6), mock.Anything).
+					Return(minio.UploadInfo{Size: 6}, nil)
+				m.On("GetObject", mock.Anything, internalBucket, chunkKey(0), mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("0123")}, nil)
+				m.On("GetObject", mock.Anything, internalBucket, chunkKey(4), mock.Anything).
+					Return(&readerObject{Reader: strings.NewReader("456789")}, nil)
+				m.On("PutObject", mock.Anything, "testbucket", "abc123", mock.Anything, int64(10), mock.Anything).
+					Run(func(args mock.Arguments) {
+						content, _ := io.ReadAll(args.Get(3).(io.Reader))
+						assert.Equal(t, "0123456789", string(content))
+					}).Return(minio.UploadInfo{Size: 10}, nil)
+				m.On("RemoveObject", mock.Anything, internalBucket, chunkKey(0), mock.Anything).Return(nil)
+				m.On("RemoveObject", mock.Anything, internalBucket, chunkKey(4), mock.Anything).Return(nil)
+				m.On("RemoveObject", mock.Anything, internalBucket, infoKey, mock.Anything).Return(nil)
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedHeaders: map[string]string{"Upload-Offset": "10"},
+		},
+		{
+			name:   "Terminate",
+			method: "DELETE",
+			path:   "/buckets/testbucket/uploads/" + uploadID,
+			setupMock: func(m *mocks.MockMinioClient) {
+				withState(m, minio.ObjectInfo{Key: chunkKey(0), Size: 4})
+				m.On("RemoveObject", mock.Anything, internalBucket, chunkKey(0), mock.Anything).Return(nil)
+				m.On("RemoveObject", mock.Anything, internalBucket, infoKey, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Unknown upload",
+			method: "HEAD",
+			path:   "/buckets/testbucket/uploads/" + uploadID,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObject", mock.Anything, internalBucket, infoKey, mock.Anything).Return(nil, minio.ErrorResponse{Code: "NoSuchKey"})
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "No upload on the instance yet",
+			method: "HEAD",
+			path:   "/buckets/testbucket/uploads/" + uploadID,
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObject", mock.Anything, internalBucket, infoKey, mock.Anything).Return(nil, minio.ErrorResponse{Code: "NoSuchBucket"})
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil).Maybe()
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+
+			r := chi.NewRouter()
+			r.Route("/buckets/{bucketName}/uploads", func(r chi.Router) {
+				r.Post("/", h.HandleTusCreate)
+				r.Head("/{uploadId}", h.HandleTusHead)
+				r.Patch("/{uploadId}", h.HandleTusPatch)
+				r.Delete("/{uploadId}", h.HandleTusDelete)
+			})
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "1.0.0", rr.Header().Get("Tus-Resumable"))
+			for key, value := range tt.expectedHeaders {
+				assert.Equal(t, value, rr.Header().Get(key), key)
+			}
+			if tt.expectedStatus == http.StatusCreated {
+				assert.Regexp(t, "^/buckets/testbucket/uploads/[0-9a-f]{32}$", rr.Header().Get("Location"))
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTusPatchKeepsReceivedBytes(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	subChunkSize := tusSubChunkSize
+	tusSubChunkSize = 4
+	t.Cleanup(func() { tusSubChunkSize = subChunkSize })
+
+	const uploadID = "0123456789abcdef0123456789abcdef"
+	info := `{"objectId":"abc123","length":10}`
+	chunkKey := func(offset int64) string { return tusChunkKey("testbucket", uploadID, offset) }
+	var stored []string
+	store := func(args mock.Arguments) {
+		data, _ := io.ReadAll(args.Get(3).(io.Reader))
+		stored = append(stored, string(data))
+	}
+
+	mockClient := new(mocks.MockMinioClient)
+	mockClient.On("BucketExists", mock.Anything, "testbucket").Return(true, nil)
+	mockClient.On("GetObject", mock.Anything, internalBucket, tusInfoKey("testbucket", uploadID), mock.Anything).
+		Return(&readerObject{Reader: strings.NewReader(info)}, nil)
+	mockClient.On("ListObjects", mock.Anything, internalBucket, mock.Anything).Return([]minio.ObjectInfo{})
+	mockClient.On("PutObject", mock.Anything, internalBucket, chunkKey(0), mock.Anything, int64(4), mock.Anything).
+		Run(store).Return(minio.UploadInfo{Size: 4}, nil)
+	mockClient.On("PutObject", mock.Anything, internalBucket, chunkKey(4), mock.Anything, int64(2), mock.Anything).
+		Run(store).Return(minio.UploadInfo{Size: 2}, nil)
+
+	h := NewHandler(nil, logger)
+	h.getMinioClient = func(string) (minio_adapter.MinioClientInterface, error) {
+		return mockClient, nil
+	}
+
+	r := chi.NewRouter()
+	r.Patch("/buckets/{bucketName}/uploads/{uploadId}", h.HandleTusPatch)
+
+	// The client goes away after sending six bytes.
+	body := io.MultiReader(strings.NewReader("abcdef"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	req, _ := http.NewRequest("PATCH", "/buckets/testbucket/uploads/"+uploadID, body)
+	req.ContentLength = -1
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Offset", "0")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "6", rr.Header().Get("Upload-Offset"))
+	assert.Equal(t, []string{"abcd", "ef"}, stored)
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+// versionIDHeader carries the version an object request read, wrote or
+// deleted, on buckets with versioning.
+const versionIDHeader = "X-Version-Id"
+
+type versioningStatus struct {
+	Status string `json:"status"`
+}
+
+type versionEntry struct {
+	VersionID      string    `json:"versionId"`
+	ETag           string    `json:"etag,omitempty"`
+	Size           int64     `json:"size"`
+	LastModified   time.Time `json:"lastModified"`
+	IsLatest       bool      `json:"isLatest"`
+	IsDeleteMarker bool      `json:"isDeleteMarker"`
+}
+
+type listVersionsResponse struct {
+	Versions []versionEntry `json:"versions"`
+}
+
+// objectNotFound reports whether err means the object, or the version asked
+// for, does not exist.
+func objectNotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NoSuchVersion"
+}
+
+// requestVersion selects the version named by the versionId query parameter.
+func requestVersion(r *http.Request, ref objectRef) objectRef {
+	ref.versionID = r.URL.Query().Get("versionId")
+	return ref
+}
+
+// noteVersioning records whether versioning is enabled on a bucket, as seen
+// by a request that went through the gateway.
+func (h *Handler) noteVersioning(bucketName string, enabled bool) {
+	h.versionedBuckets.Store(bucketName, enabled)
+}
+
+// knownVersioned reports whether versioning was last seen enabled on a
+// bucket. Buckets not seen since the gateway started are not.
+func (h *Handler) knownVersioned(bucketName string) bool {
+	enabled, ok := h.versionedBuckets.Load(bucketName)
+	return ok && enabled.(bool)
+}
+
+// removeObject deletes the object or version ref names and returns the
+// version of the delete marker it created, if any. RemoveObject does not
+// report delete markers, so on buckets known to be versioned a delete
+// without a version goes through DeleteObjects instead.
+func (h *Handler) removeObject(ctx context.Context, ref objectRef, opts minio.RemoveObjectOptions) (string, error) {
+	if ref.versionID != "" || !h.knownVersioned(ref.bucket) {
+		return "", ref.client.RemoveObject(ctx, ref.bucket, ref.id, opts)
+	}
+	objectsCh := make(chan minio.ObjectInfo, 1)
+	objectsCh <- minio.ObjectInfo{Key: ref.id}
+	close(objectsCh)
+
+	var (
+		markerVersionID string
+		err             error
+	)
+	for result := range ref.client.RemoveObjectsWithResult(ctx, ref.bucket, objectsCh, minio.RemoveObjectsOptions{GovernanceBypass: opts.GovernanceBypass}) {
+		if result.Err != nil {
+			err = result.Err
+			continue
+		}
+		if result.DeleteMarker {
+			markerVersionID = result.DeleteMarkerVersionID
+		}
+	}
+	return markerVersionID, err
+}
+
+// setDeletedVersion reports the version a DELETE removed, or the delete
+// marker it created.
+func setDeletedVersion(w http.ResponseWriter, ref objectRef, markerVersionID string) {
+	switch {
+	case ref.versionID != "":
+		w.Header().Set(versionIDHeader, ref.versionID)
+	case markerVersionID != "":
+		w.Header().Set(versionIDHeader, markerVersionID)
+		w.Header().Set("X-Delete-Marker", "true")
+	}
+}
+
+// bucketClients returns the clients of every instance hosting bucketName,
+// writing an error response if the bucket does not exist or an instance is
+// unreachable.
+func (h *Handler) bucketClients(w http.ResponseWriter, r *http.Request, bucketName string, log *logrus.Entry) ([]minio_adapter.MinioClientInterface, bool) {
+	if bucketName == internalBucket {
+		http.Error(w, "Bucket not found", http.StatusNotFound)
+		return nil, false
+	}
+	clients, err := h.hostingClients(bucketName)
+	if err != nil {
+		log.WithError(err).Error("Failed to get MinIO client")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	for _, client := range clients {
+		if bucketName == h.defaultBucket {
+			err = h.ensureDefaultBucket(r.Context(), client)
+		} else {
+			var exists bool
+			exists, err = client.BucketExists(r.Context(), bucketName)
+			if err == nil && !exists {
+				http.Error(w, "Bucket not found", http.StatusNotFound)
+				return nil, false
+			}
+		}
+		if err != nil {
+			if h.respondUnavailable(w, err) {
+				return nil, false
+			}
+			log.WithError(err).Error("Failed to check bucket existence")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+	return clients, true
+}
+
+// HandlePutBucketVersioning enables or suspends versioning of a bucket on
+// every instance hosting it.
+func (h *Handler) HandlePutBucketVersioning(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	log := h.logger.WithField("bucket", bucketName)
+
+	var req versioningStatus
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.WithError(err).Error("Failed to decode request")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	config := minio.BucketVersioningConfiguration{Status: req.Status}
+	switch req.Status {
+	case minio.Enabled, minio.Suspended:
+	default:
+		http.Error(w, "Status must be Enabled or Suspended", http.StatusBadRequest)
+		return
+	}
+
+	clients, ok := h.bucketClients(w, r, bucketName, log)
+	if !ok {
+		return
+	}
+	for _, client := range clients {
+		if err := client.SetBucketVersioning(r.Context(), bucketName, config); err != nil {
+			if h.respondUnavailable(w, err) {
+				return
+			}
+			log.WithError(err).Error("Failed to set bucket versioning")
+			http.Error(w, "Failed to set bucket versioning", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.noteVersioning(bucketName, req.Status == minio.Enabled)
+	log.WithField("status", req.Status).Info("Changed bucket versioning")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// HandleGetBucketVersioning reports the versioning status of a bucket. The
+// status is empty if versioning was never enabled.
+func (h *Handler) HandleGetBucketVersioning(w http.ResponseWriter, r *http.Request) {
+	bucketName := chi.URLParam(r, "bucketName")
+	log := h.logger.WithField("bucket", bucketName)
+
+	clients, ok := h.bucketClients(w, r, bucketName, log)
+	if !ok {
+		return
+	}
+	config, err := clients[0].GetBucketVersioning(r.Context(), bucketName)
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		log.WithError(err).Error("Failed to get bucket versioning")
+		http.Error(w, "Failed to get bucket versioning", http.StatusInternalServerError)
+		return
+	}
+
+	h.noteVersioning(bucketName, config.Status == minio.Enabled)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versioningStatus{Status: config.Status})
+}
+
+// HandleListObjectVersions lists every version of an object, newest first.
+func (h *Handler) HandleListObjectVersions(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket": ref.bucket,
+		"id":     ref.id,
+	})
+
+	resp := listVersionsResponse{Versions: []versionEntry{}}
+	ctx, cancel := context.WithCancel(r.Context())
+	ch := ref.client.ListObjects(ctx, ref.bucket, minio.ListObjectsOptions{Prefix: ref.id, WithVersions: true})
+	defer func() {
+		cancel()
+		for range ch {
+		}
+	}()
+
+	for object := range ch {
+		if object.Err != nil {
+			if h.respondUnavailable(w, object.Err) {
+				return
+			}
+			log.WithError(object.Err).Error("Failed to list object versions")
+			http.Error(w, "Failed to list object versions", http.StatusInternalServerError)
+			return
+		}
+		// The prefix also matches longer IDs, which are listed after the
+		// versions of ref.id.
+		if object.Key != ref.id {
+			if object.Key > ref.id {
+				break
+			}
+			continue
+		}
+		resp.Versions = append(resp.Versions, versionEntry{
+			VersionID:      object.VersionID,
+			ETag:           object.ETag,
+			Size:           object.Size,
+			LastModified:   object.LastModified,
+			IsLatest:       object.IsLatest,
+			IsDeleteMarker: object.IsDeleteMarker,
+		})
+	}
+	if len(resp.Versions) == 0 {
+		http.Error(w, "Object not found", http.StatusNotFound)
+		return
+	}
+	sort.SliceStable(resp.Versions, func(i, j int) bool {
+		return resp.Versions[i].LastModified.After(resp.Versions[j].LastModified)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleRestoreObjectVersion makes a copy of an older version the latest
+// version of the object. The version restored from is kept.
+func (h *Handler) HandleRestoreObjectVersion(w http.ResponseWriter, r *http.Request) {
+	ref, ok := h.resolveObject(w, r)
+	if !ok {
+		return
+	}
+	versionID := chi.URLParam(r, "versionId")
+	log := h.logger.WithFields(logrus.Fields{
+		"bucket":    ref.bucket,
+		"id":        ref.id,
+		"versionId": versionID,
+	})
+
+	info, err := ref.client.CopyObject(r.Context(),
+		minio.CopyDestOptions{Bucket: ref.bucket, Object: ref.id},
+		minio.CopySrcOptions{Bucket: ref.bucket, Object: ref.id, VersionID: versionID})
+	if err != nil {
+		if h.respondUnavailable(w, err) {
+			return
+		}
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchKey", "NoSuchVersion":
+			http.Error(w, "Version not found", http.StatusNotFound)
+		case "InvalidArgument", "InvalidRequest", "MethodNotAllowed":
+			http.Error(w, "Version cannot be restored", http.StatusBadRequest)
+		default:
+			log.WithError(err).Error("Failed to restore object version")
+			http.Error(w, "Failed to restore object version", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.WithField("newVersionId", info.VersionID).Info("Restored object version")
+	if info.VersionID != "" {
+		w.Header().Set(versionIDHeader, info.VersionID)
+	}
+	setValidators(w, info.ETag, info.LastModified)
+	w.WriteHeader(http.StatusOK)
+}
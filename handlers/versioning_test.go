@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func TestBucketVersioning(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	enabled := minio.BucketVersioningConfiguration{Status: minio.Enabled}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		setupMocks     func(single, a, b *mocks.MockMinioClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "Enable versioning",
+			method: "PUT",
+			url:    "/buckets/mybucket/versioning",
+			body:   `{"status":"Enabled"}`,
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("SetBucketVersioning", mock.Anything, "mybucket", enabled).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"Enabled"}` + "\n",
+		},
+		{
+			name:   "Suspend versioning of the default bucket on every instance",
+			method: "PUT",
+			url:    "/buckets/objects/versioning",
+			body:   `{"status":"Suspended"}`,
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				for _, m := range []*mocks.MockMinioClient{a, b} {
+					m.On("BucketExists", mock.Anything, "objects").Return(true, nil)
+					m.On("SetBucketVersioning", mock.Anything, "objects", minio.BucketVersioningConfiguration{Status: minio.Suspended}).Return(nil)
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"Suspended"}` + "\n",
+		},
+		{
+			name:           "Invalid status",
+			method:         "PUT",
+			url:            "/buckets/mybucket/versioning",
+			body:           `{"status":"Off"}`,
+			setupMocks:     func(single, a, b *mocks.MockMinioClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Status must be Enabled or Suspended\n",
+		},
+		{
+			name:   "Bucket not found",
+			method: "PUT",
+			url:    "/buckets/missing/versioning",
+			body:   `{"status":"Enabled"}`,
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "missing").Return(false, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Bucket not found\n",
+		},
+		{
+			name:   "Get versioning status",
+			method: "GET",
+			url:    "/buckets/mybucket/versioning",
+			setupMocks: func(single, a, b *mocks.MockMinioClient) {
+				single.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+				single.On("GetBucketVersioning", mock.Anything, "mybucket").Return(enabled, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"Enabled"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			single, a, b := new(mocks.MockMinioClient), new(mocks.MockMinioClient), new(mocks.MockMinioClient)
+			tt.setupMocks(single, a, b)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+				return single, nil
+			}
+			h.getAllMinioClients = func() []minio_adapter.InstanceClient {
+				return []minio_adapter.InstanceClient{{Client: a}, {Client: b}}
+			}
+
+			r := chi.NewRouter()
+			r.Put("/buckets/{bucketName}/versioning", h.HandlePutBucketVersioning)
+			r.Get("/buckets/{bucketName}/versioning", h.HandleGetBucketVersioning)
+
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedBody, rr.Body.String())
+			single.AssertExpectations(t)
+			a.AssertExpectations(t)
+			b.AssertExpectations(t)
+		})
+	}
+}
+
+func TestObjectVersions(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	older := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	tests := []struct {
+		name            string
+		method          string
+		url             string
+		setupMock       func(*mocks.MockMinioClient)
+		expectedStatus  int
+		expectedBody    string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:   "List versions newest first",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc/versions",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("ListObjects", mock.Anything, "mybucket", minio.ListObjectsOptions{Prefix: "abc", WithVersions: true}).
+					Return([]minio.ObjectInfo{
+						{Key: "abc", VersionID: "v1", ETag: "e1", Size: 1, LastModified: older},
+						{Key: "abc", VersionID: "v2", IsLatest: true, IsDeleteMarker: true, LastModified: newer},
+						{Key: "abcd", VersionID: "v3", LastModified: newer},
+						{Key: "abce", Err: errors.New("listed past the object")},
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"versions":[` +
+				`{"versionId":"v2","size":0,"lastModified":"2024-01-02T04:04:05Z","isLatest":true,"isDeleteMarker":true},` +
+				`{"versionId":"v1","etag":"e1","size":1,"lastModified":"2024-01-02T03:04:05Z","isLatest":false,"isDeleteMarker":false}]}` + "\n",
+		},
+		{
+			name:   "List versions of a missing object",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc/versions",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("ListObjects", mock.Anything, "mybucket", mock.Anything).Return([]minio.ObjectInfo{})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Object not found\n",
+		},
+		{
+			name:   "Restore a version",
+			method: "POST",
+			url:    "/buckets/mybucket/objects/abc/versions/v1/restore",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("CopyObject", mock.Anything,
+					minio.CopyDestOptions{Bucket: "mybucket", Object: "abc"},
+					minio.CopySrcOptions{Bucket: "mybucket", Object: "abc", VersionID: "v1"}).
+					Return(minio.UploadInfo{VersionID: "v4", ETag: "e1", LastModified: newer}, nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{"X-Version-Id": "v4", "ETag": `"e1"`},
+		},
+		{
+			name:   "Restore a missing version",
+			method: "POST",
+			url:    "/buckets/mybucket/objects/abc/versions/v9/restore",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("CopyObject", mock.Anything, mock.Anything, mock.Anything).
+					Return(minio.UploadInfo{}, minio.ErrorResponse{Code: "NoSuchVersion"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Version not found\n",
+		},
+		{
+			name:   "Get a version",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc?versionId=v1",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObject", mock.Anything, "mybucket", "abc", minio.GetObjectOptions{VersionID: "v1"}).
+					Return(&readerObject{Reader: strings.NewReader("a"), info: minio.ObjectInfo{Size: 1, VersionID: "v1"}}, nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedBody:    "a",
+			expectedHeaders: map[string]string{"X-Version-Id": "v1"},
+		},
+		{
+			name:   "Get a missing version",
+			method: "GET",
+			url:    "/buckets/mybucket/objects/abc?versionId=v9",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("GetObject", mock.Anything, "mybucket", "abc", minio.GetObjectOptions{VersionID: "v9"}).
+					Return(nil, minio.ErrorResponse{Code: "NoSuchVersion"})
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Object not found\n",
+		},
+		{
+			name:   "Head a version",
+			method: "HEAD",
+			url:    "/buckets/mybucket/objects/abc?versionId=v1",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("StatObject", mock.Anything, "mybucket", "abc", minio.StatObjectOptions{VersionID: "v1"}).
+					Return(minio.ObjectInfo{Size: 1, VersionID: "v1"}, nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{"X-Version-Id": "v1"},
+		},
+		{
+			name:   "Delete a version",
+			method: "DELETE",
+			url:    "/buckets/mybucket/objects/abc?versionId=v1",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("RemoveObject", mock.Anything, "mybucket", "abc", minio.RemoveObjectOptions{VersionID: "v1"}).Return(nil)
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedHeaders: map[string]string{"X-Version-Id": "v1"},
+		},
+		{
+			name:   "Delete creates a delete marker",
+			method: "DELETE",
+			url:    "/buckets/mybucket/objects/abc",
+			setupMock: func(m *mocks.MockMinioClient) {
+				m.On("RemoveObjectsWithResult", mock.Anything, "mybucket", []string{"abc"}, minio.RemoveObjectsOptions{}).
+					Return([]minio.RemoveObjectResult{{ObjectName: "abc", DeleteMarker: true, DeleteMarkerVersionID: "v5"}})
+			},
+			expectedStatus:  http.StatusNoContent,
+			expectedHeaders: map[string]string{"X-Version-Id": "v5", "X-Delete-Marker": "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(mocks.MockMinioClient)
+			mockClient.On("BucketExists", mock.Anything, "mybucket").Return(true, nil)
+			tt.setupMock(mockClient)
+
+			h := NewHandler(nil, logger)
+			h.getMinioClient = func(id string) (minio_adapter.MinioClientInterface, error) {
+				return mockClient, nil
+			}
+			h.noteVersioning("mybucket", true)
+
+			r := chi.NewRouter()
+			r.Route("/buckets/{bucketName}/objects", func(r chi.Router) {
+				r.Get("/{id}", h.HandleGetObject)
+				r.Head("/{id}", h.HandleHeadObject)
+				r.Delete("/{id}", h.HandleDeleteObject)
+				r.Get("/{id}/versions", h.HandleListObjectVersions)
+				r.Post("/{id}/versions/{versionId}/restore", h.HandleRestoreObjectVersion)
+			})
+
+			req, _ := http.NewRequest(tt.method, tt.url, nil)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			for name, value := range tt.expectedHeaders {
+				assert.Equal(t, value, rr.Header().Get(name), name)
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job has already finished")
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Job is a snapshot of a background operation.
+type Job struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Status Status `json:"status"`
+	// Processed counts the items the job has worked through so far.
+	Processed  int64      `json:"processed"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Func does the work of a job. It should stop when ctx is cancelled and call
+// progress as items are processed.
+type Func func(ctx context.Context, progress func(n int64)) error
+
+type entry struct {
+	job    Job
+	cancel context.CancelFunc
+}
+
+// Manager runs jobs in the background and keeps their state so clients can
+// poll them. Finished jobs are forgotten after the retention period.
+type Manager struct {
+	mu        sync.Mutex
+	jobs      map[string]*entry
+	retention time.Duration
+	now       func() time.Time
+	// ctx is the parent of every job, cancelling it cancels them all.
+	ctx     context.Context
+	running sync.WaitGroup
+}
+
+func NewManager(ctx context.Context, retention time.Duration) *Manager {
+	return &Manager{
+		jobs:      make(map[string]*entry),
+		retention: retention,
+		now:       time.Now,
+		ctx:       ctx,
+	}
+}
+
+// Start runs fn in the background and returns the new job. At most one job
+// of a kind runs per target; if one is already running it is returned with
+// started set to false.
+func (m *Manager) Start(kind, target string, fn Func) (job Job, started bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	for _, e := range m.jobs {
+		if e.job.Kind == kind && e.job.Target == target && e.job.Status == StatusRunning {
+			return e.job, false, nil
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Job{}, false, err
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	e := &entry{
+		job: Job{
+			ID:        id,
+			Kind:      kind,
+			Target:    target,
+			Status:    StatusRunning,
+			CreatedAt: m.now(),
+		},
+		cancel: cancel,
+	}
+	m.jobs[id] = e
+
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		defer cancel()
+		err := fn(ctx, func(n int64) {
+			m.mu.Lock()
+			e.job.Processed += n
+			m.mu.Unlock()
+		})
+		m.finish(ctx, e, err)
+	}()
+	return e.job, true, nil
+}
+
+func (m *Manager) finish(ctx context.Context, e *entry, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	finishedAt := m.now()
+	e.job.FinishedAt = &finishedAt
+	switch {
+	case ctx.Err() != nil:
+		e.job.Status = StatusCancelled
+	case err != nil:
+		e.job.Status = StatusFailed
+		e.job.Error = err.Error()
+	default:
+		e.job.Status = StatusSucceeded
+	}
+}
+
+// Wait blocks until every running job has returned. Cancel the manager's
+// context first to have them stop.
+func (m *Manager) Wait() {
+	m.running.Wait()
+}
+
+// Get returns the current state of a job.
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return e.job, nil
+}
+
+// Cancel asks a running job to stop. The job reports StatusCancelled once
+// its work has returned.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if e.job.Status != StatusRunning {
+		return e.job, ErrFinished
+	}
+	e.cancel()
+	return e.job, nil
+}
+
+// prune drops finished jobs older than the retention period. The caller
+// must hold m.mu.
+func (m *Manager) prune() {
+	cutoff := m.now().Add(-m.retention)
+	for id, e := range m.jobs {
+		if e.job.FinishedAt != nil && e.job.FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", id), nil
+}
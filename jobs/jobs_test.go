@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wait polls the job until it is no longer running.
+func wait(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	var job Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = m.Get(id)
+		return err == nil && job.Status != StatusRunning
+	}, time.Second, time.Millisecond)
+	return job
+}
+
+func TestManager(t *testing.T) {
+	t.Run("Succeeded", func(t *testing.T) {
+		m := NewManager(context.Background(), time.Hour)
+		job, started, err := m.Start("delete-bucket", "photos", func(ctx context.Context, progress func(int64)) error {
+			progress(2)
+			progress(3)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, started)
+		assert.Equal(t, StatusRunning, job.Status)
+
+		job = wait(t, m, job.ID)
+		assert.Equal(t, StatusSucceeded, job.Status)
+		assert.Equal(t, int64(5), job.Processed)
+		assert.NotNil(t, job.FinishedAt)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		m := NewManager(context.Background(), time.Hour)
+		job, _, err := m.Start("delete-bucket", "photos", func(ctx context.Context, progress func(int64)) error {
+			return errors.New("boom")
+		})
+		require.NoError(t, err)
+
+		job = wait(t, m, job.ID)
+		assert.Equal(t, StatusFailed, job.Status)
+		assert.Equal(t, "boom", job.Error)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		m := NewManager(context.Background(), time.Hour)
+		job, _, err := m.Start("delete-bucket", "photos", func(ctx context.Context, progress func(int64)) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.NoError(t, err)
+
+		_, err = m.Cancel(job.ID)
+		assert.NoError(t, err)
+		job = wait(t, m, job.ID)
+		assert.Equal(t, StatusCancelled, job.Status)
+		assert.Empty(t, job.Error)
+
+		_, err = m.Cancel(job.ID)
+		assert.ErrorIs(t, err, ErrFinished)
+	})
+
+	t.Run("Cancelled with the manager's context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		m := NewManager(ctx, time.Hour)
+		job, _, err := m.Start("delete-bucket", "photos", func(ctx context.Context, progress func(int64)) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.NoError(t, err)
+
+		cancel()
+		m.Wait()
+		job, err = m.Get(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusCancelled, job.Status)
+	})
+
+	t.Run("One running job per target", func(t *testing.T) {
+		m := NewManager(context.Background(), time.Hour)
+		release := make(chan struct{})
+		block := func(ctx context.Context, progress func(int64)) error {
+			<-release
+			return nil
+		}
+		first, _, _ := m.Start("delete-bucket", "photos", block)
+		second, started, err := m.Start("delete-bucket", "photos", block)
+		require.NoError(t, err)
+		assert.False(t, started)
+		assert.Equal(t, first.ID, second.ID)
+
+		other, started, _ := m.Start("delete-bucket", "videos", block)
+		assert.True(t, started)
+		assert.NotEqual(t, first.ID, other.ID)
+		close(release)
+	})
+
+	t.Run("Finished jobs expire", func(t *testing.T) {
+		m := NewManager(context.Background(), time.Hour)
+		now := time.Now()
+		m.now = func() time.Time { return now }
+		job, _, _ := m.Start("delete-bucket", "photos", func(ctx context.Context, progress func(int64)) error {
+			return nil
+		})
+		wait(t, m, job.ID)
+
+		now = now.Add(2 * time.Hour)
+		_, err := m.Get(job.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Unknown job", func(t *testing.T) {
+		m := NewManager(context.Background(), time.Hour)
+		_, err := m.Get("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = m.Cancel("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,6 +18,8 @@ import (
 	"github.com/spacelift-io/homework-object-storage/docker_discovery"
 	"github.com/spacelift-io/homework-object-storage/handlers"
 	customMiddleware "github.com/spacelift-io/homework-object-storage/middleware"
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/share"
 	"golang.org/x/time/rate"
 )
 
@@ -34,17 +40,71 @@ func main() {
 	r.Use(middleware.Recoverer)
 
 	r.Use(customMiddleware.RateLimiter(rate.Limit(100), 50))
-	h := handlers.NewHandler(minioInstances, logger)
-	
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	h := handlers.NewHandler(minioInstances, logger, append(handlerOptions(logger), handlers.WithJobContext(ctx))...)
+
+	go refreshMinioInstances(ctx, h, logger, 30*time.Second)
+	go h.RunMultipartJanitor(ctx,
+		getEnvDuration(logger, "MULTIPART_JANITOR_INTERVAL", time.Hour),
+		getEnvDuration(logger, "MULTIPART_UPLOAD_MAX_AGE", 24*time.Hour))
+	go h.RunExpirySweeper(ctx, getEnvDuration(logger, "EXPIRY_SWEEP_INTERVAL", 5*time.Minute))
+	go h.RunQuotaReconciler(ctx, getEnvDuration(logger, "QUOTA_RECONCILE_INTERVAL", 10*time.Minute))
+
 	r.Get("/healthz", h.HandleHealthCheck)
+	r.Handle("/debug/vars", expvar.Handler())
+	r.Get("/share/{token}", h.HandleShareDownload)
+	r.Get("/jobs/{jobId}", h.HandleGetJob)
+	r.Delete("/jobs/{jobId}", h.HandleCancelJob)
+
+	r.Put("/object/{id}", h.HandlePutObject)
+	r.Get("/object/{id}", h.HandleGetObject)
+	r.Head("/object/{id}", h.HandleHeadObject)
 
 	r.Route("/buckets", func(r chi.Router) {
+		r.Get("/", h.HandleListBuckets)
 		r.Post("/", h.HandleCreateBucket)
 		r.Delete("/{bucketName}", h.HandleDeleteBucket)
+		r.Route("/{bucketName}/uploads", func(r chi.Router) {
+			r.Options("/", h.HandleTusOptions)
+			r.Post("/", h.HandleTusCreate)
+			r.Options("/{uploadId}", h.HandleTusOptions)
+			r.Head("/{uploadId}", h.HandleTusHead)
+			r.Patch("/{uploadId}", h.HandleTusPatch)
+			r.Delete("/{uploadId}", h.HandleTusDelete)
+		})
+		r.Put("/{bucketName}/versioning", h.HandlePutBucketVersioning)
+		r.Put("/{bucketName}/lifecycle", h.HandlePutBucketLifecycle)
+		r.Get("/{bucketName}/lifecycle", h.HandleGetBucketLifecycle)
+		r.Delete("/{bucketName}/lifecycle", h.HandleDeleteBucketLifecycle)
+		r.Get("/{bucketName}/object-lock", h.HandleGetObjectLock)
+		r.Put("/{bucketName}/object-lock", h.HandlePutObjectLock)
+		r.Get("/{bucketName}/versioning", h.HandleGetBucketVersioning)
+		r.Post("/{bucketName}/objects:delete", h.HandleBatchDelete)
 		r.Route("/{bucketName}/objects", func(r chi.Router) {
+			r.Get("/", h.HandleListObjects)
 			r.Put("/{id}", h.HandlePutObject)
 			r.Get("/{id}", h.HandleGetObject)
+			r.Head("/{id}", h.HandleHeadObject)
 			r.Delete("/{id}", h.HandleDeleteObject)
+			r.Post("/{id}/copy", h.HandleCopyObject)
+			r.Post("/{id}/move", h.HandleMoveObject)
+			r.Post("/{id}/presign", h.HandlePresignObject)
+			r.Post("/{id}/share", h.HandleCreateShare)
+			r.Get("/{id}/tags", h.HandleGetObjectTags)
+			r.Put("/{id}/tags", h.HandlePutObjectTags)
+			r.Delete("/{id}/tags", h.HandleDeleteObjectTags)
+			r.Get("/{id}/retention", h.HandleGetObjectRetention)
+			r.Put("/{id}/retention", h.HandlePutObjectRetention)
+			r.Get("/{id}/legal-hold", h.HandleGetObjectLegalHold)
+			r.Put("/{id}/legal-hold", h.HandlePutObjectLegalHold)
+			r.Get("/{id}/versions", h.HandleListObjectVersions)
+			r.Post("/{id}/versions/{versionId}/restore", h.HandleRestoreObjectVersion)
+			r.Post("/{id}/uploads", h.HandleCreateMultipartUpload)
+			r.Get("/{id}/uploads/{uploadId}/parts", h.HandleListParts)
+			r.Put("/{id}/uploads/{uploadId}/parts/{partNumber}", h.HandleUploadPart)
+			r.Post("/{id}/uploads/{uploadId}/complete", h.HandleCompleteMultipartUpload)
+			r.Delete("/{id}/uploads/{uploadId}", h.HandleAbortMultipartUpload)
 		})
 	})
 
@@ -58,6 +118,7 @@ func main() {
 		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 		<-sigint
 		logger.Info("Shutting down server")
+		stop()
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		if err := srv.Shutdown(ctx); err != nil {
@@ -69,4 +130,119 @@ func main() {
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.WithError(err).Fatal("Server error")
 	}
+	// Shutting down cancelled the running jobs, let them stop.
+	h.WaitForJobs()
+}
+
+func refreshMinioInstances(ctx context.Context, h *handlers.Handler, logger *logrus.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			minioInstances, err := docker_discovery.DiscoverMinioInstances()
+			if err != nil {
+				logger.WithError(err).Warn("Failed to refresh MinIO instances, keeping current set")
+				continue
+			}
+			h.UpdateMinioInstances(minioInstances)
+		}
+	}
+}
+
+// handlerOptions builds the optional handler features from the environment.
+func handlerOptions(logger *logrus.Logger) []handlers.Option {
+	var opts []handlers.Option
+
+	if bucketName := os.Getenv("DEFAULT_BUCKET"); bucketName != "" {
+		opts = append(opts, handlers.WithDefaultBucket(bucketName))
+	}
+
+	if percentile := getEnvFloat(logger, "HEDGE_GET_PERCENTILE", 0); percentile != 0 {
+		if percentile <= 0 || percentile >= 1 {
+			logger.WithField("value", percentile).Fatal("HEDGE_GET_PERCENTILE must be between 0 and 1")
+		}
+		config := minio_adapter.DefaultHedgeConfig()
+		config.Percentile = percentile
+		config.MaxHedgeRatio = getEnvFloat(logger, "HEDGE_MAX_RATIO", config.MaxHedgeRatio)
+		opts = append(opts, handlers.WithHedgedGets(config))
+	}
+
+	publicBaseURL := os.Getenv("PRESIGN_PUBLIC_BASE_URL")
+	if publicBaseURL != "" {
+		parsed, err := url.Parse(strings.ReplaceAll(publicBaseURL, "{instance}", "instance"))
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			logger.WithField("key", "PRESIGN_PUBLIC_BASE_URL").Warn("Ignoring invalid environment variable")
+			publicBaseURL = ""
+		}
+	}
+	opts = append(opts, handlers.WithPresign(
+		getEnvDuration(logger, "PRESIGN_MAX_EXPIRY", handlers.DefaultPresignMaxExpiry),
+		publicBaseURL,
+	))
+
+	opts = append(opts, handlers.WithShareSigner(shareSigner(logger)))
+
+	if spec := os.Getenv("BUCKET_QUOTAS"); spec != "" {
+		quotas, err := handlers.ParseQuotas(spec)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid BUCKET_QUOTAS")
+		}
+		opts = append(opts, handlers.WithQuotas(quotas))
+	}
+
+	return opts
+}
+
+// shareSigner signs share links with the keys in SHARE_KEYS. Without it links
+// are signed with a random key and stop working when the gateway restarts.
+func shareSigner(logger *logrus.Logger) *share.Signer {
+	var keys []share.Key
+	if spec := os.Getenv("SHARE_KEYS"); spec != "" {
+		parsed, err := share.ParseKeys(spec)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid SHARE_KEYS")
+		}
+		keys = parsed
+	} else {
+		logger.Warn("SHARE_KEYS is not set, share links will not survive a restart")
+		key, err := share.GenerateKey("ephemeral")
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to generate share key")
+		}
+		keys = []share.Key{key}
+	}
+	signer, err := share.NewSigner(keys)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid SHARE_KEYS")
+	}
+	return signer
+}
+
+func getEnvFloat(logger *logrus.Logger, key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logger.WithError(err).WithField("key", key).Warn("Ignoring invalid environment variable")
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvDuration(logger *logrus.Logger, key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		logger.WithField("key", key).Warn("Ignoring invalid environment variable")
+		return fallback
+	}
+	return parsed
 }
@@ -0,0 +1,648 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrInvalidInput marks errors caused by what the caller passed in, such as
+// an upload body that fails verification. They never count against an
+// instance.
+var ErrInvalidInput = errors.New("invalid input")
+
+var (
+	breakerStates      = expvar.NewMap("minio_circuit_breaker_state")
+	breakerTransitions = expvar.NewMap("minio_circuit_breaker_transitions")
+)
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type CircuitBreakerConfig struct {
+	// Window is the length of the tumbling window failures are counted in.
+	Window time.Duration
+	// MinRequests is the number of calls in a window before the failure rate is evaluated.
+	MinRequests int
+	// FailureRate in [0, 1] that trips the breaker.
+	FailureRate float64
+	// OpenTimeout is how long the breaker stays open before probing.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of concurrent calls allowed while half-open.
+	HalfOpenProbes int
+}
+
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Window:         10 * time.Second,
+		MinRequests:    10,
+		FailureRate:    0.5,
+		OpenTimeout:    5 * time.Second,
+		HalfOpenProbes: 1,
+	}
+}
+
+// StateChangeFunc is notified of every breaker transition.
+type StateChangeFunc func(name string, from, to BreakerState)
+
+type CircuitBreaker struct {
+	name          string
+	config        CircuitBreakerConfig
+	onStateChange StateChangeFunc
+	now           func() time.Time
+
+	mu          sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	// generation changes with every transition, so results of calls
+	// admitted before it are ignored.
+	generation uint64
+}
+
+func NewCircuitBreaker(name string, config CircuitBreakerConfig, onStateChange StateChangeFunc) *CircuitBreaker {
+	b := &CircuitBreaker{
+		name:          name,
+		config:        config,
+		onStateChange: onStateChange,
+		now:           time.Now,
+	}
+	b.windowStart = b.now()
+	breakerStates.Set(name, stateVar(StateClosed))
+	return b
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow reports whether a call may proceed. Every nil error must be paired
+// with exactly one Record of the returned generation.
+func (b *CircuitBreaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.config.OpenTimeout {
+			return 0, ErrCircuitOpen
+		}
+		b.transition(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probes >= b.config.HalfOpenProbes {
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+		return b.generation, nil
+	}
+
+	if now.Sub(b.windowStart) >= b.config.Window {
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	}
+	return b.generation, nil
+}
+
+// Record reports the outcome of a call admitted by Allow. Calls admitted in
+// an earlier state of the breaker are ignored.
+func (b *CircuitBreaker) Record(generation uint64, err error) {
+	failed := IsBackendFailure(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	switch b.state {
+	case StateHalfOpen:
+		b.probes--
+		if failed {
+			b.trip()
+		} else {
+			b.transition(StateClosed)
+		}
+		return
+	case StateOpen:
+		return
+	}
+
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if b.requests >= b.config.MinRequests && float64(b.failures)/float64(b.requests) >= b.config.FailureRate {
+		b.trip()
+	}
+}
+
+func (b *CircuitBreaker) trip() {
+	b.openedAt = b.now()
+	b.transition(StateOpen)
+}
+
+func (b *CircuitBreaker) transition(to BreakerState) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	b.generation++
+	b.probes = 0
+	b.windowStart = b.now()
+	b.requests, b.failures = 0, 0
+
+	breakerStates.Set(b.name, stateVar(to))
+	breakerTransitions.Add(to.String(), 1)
+	if b.onStateChange != nil {
+		b.onStateChange(b.name, from, to)
+	}
+}
+
+func stateVar(state BreakerState) *expvar.String {
+	v := new(expvar.String)
+	v.Set(state.String())
+	return v
+}
+
+// IsBackendFailure reports whether err means the instance itself is unhealthy,
+// as opposed to an ordinary S3 error such as NoSuchKey.
+func IsBackendFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrInvalidInput) {
+		return false
+	}
+	var errResp minio.ErrorResponse
+	if errors.As(err, &errResp) {
+		return errResp.StatusCode >= 500 || errResp.Code == "SlowDown"
+	}
+	return true
+}
+
+type circuitBreakerClient struct {
+	client  MinioClientInterface
+	breaker *CircuitBreaker
+}
+
+// NewCircuitBreakerClient guards every call to client with breaker.
+func NewCircuitBreakerClient(client MinioClientInterface, breaker *CircuitBreaker) MinioClientInterface {
+	return &circuitBreakerClient{client: client, breaker: breaker}
+}
+
+func (c *circuitBreakerClient) do(fn func() error) error {
+	generation, err := c.breaker.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	c.breaker.Record(generation, err)
+	return err
+}
+
+// doUpload is do for calls reading an upload from body. Failing to read the
+// body is the fault of the client sending it, not of the instance.
+func (c *circuitBreakerClient) doUpload(body *uploadBody, fn func() error) error {
+	generation, err := c.breaker.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	if err != nil && body.failed() {
+		c.breaker.Record(generation, fmt.Errorf("%w: %w", ErrInvalidInput, err))
+	} else {
+		c.breaker.Record(generation, err)
+	}
+	return err
+}
+
+func (c *circuitBreakerClient) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	return c.do(func() error {
+		return c.client.MakeBucket(ctx, bucketName, opts)
+	})
+}
+
+func (c *circuitBreakerClient) BucketExists(ctx context.Context, bucketName string) (exists bool, err error) {
+	err = c.do(func() error {
+		exists, err = c.client.BucketExists(ctx, bucketName)
+		return err
+	})
+	return exists, err
+}
+
+func (c *circuitBreakerClient) RemoveBucket(ctx context.Context, bucketName string) error {
+	return c.do(func() error {
+		return c.client.RemoveBucket(ctx, bucketName)
+	})
+}
+
+func (c *circuitBreakerClient) ListBuckets(ctx context.Context) (buckets []minio.BucketInfo, err error) {
+	err = c.do(func() error {
+		buckets, err = c.client.ListBuckets(ctx)
+		return err
+	})
+	return buckets, err
+}
+
+func (c *circuitBreakerClient) SetBucketVersioning(ctx context.Context, bucketName string, config minio.BucketVersioningConfiguration) error {
+	return c.do(func() error {
+		return c.client.SetBucketVersioning(ctx, bucketName, config)
+	})
+}
+
+func (c *circuitBreakerClient) GetBucketVersioning(ctx context.Context, bucketName string) (config minio.BucketVersioningConfiguration, err error) {
+	err = c.do(func() error {
+		config, err = c.client.GetBucketVersioning(ctx, bucketName)
+		return err
+	})
+	return config, err
+}
+
+func (c *circuitBreakerClient) SetBucketLifecycle(ctx context.Context, bucketName string, config *lifecycle.Configuration) error {
+	return c.do(func() error {
+		return c.client.SetBucketLifecycle(ctx, bucketName, config)
+	})
+}
+
+func (c *circuitBreakerClient) GetBucketLifecycle(ctx context.Context, bucketName string) (config *lifecycle.Configuration, err error) {
+	err = c.do(func() error {
+		config, err = c.client.GetBucketLifecycle(ctx, bucketName)
+		return err
+	})
+	return config, err
+}
+
+func (c *circuitBreakerClient) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (info minio.UploadInfo, err error) {
+	body := newUploadBody(reader, objectSize)
+	err = c.doUpload(body, func() error {
+		info, err = c.client.PutObject(ctx, bucketName, objectName, body.reader(), objectSize, opts)
+		return err
+	})
+	return info, err
+}
+
+// GetObject is lazy in minio-go, so the outcome is recorded on the first
+// Stat or Read of the returned object rather than when it is opened.
+func (c *circuitBreakerClient) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (MinioObject, error) {
+	generation, err := c.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+	object, err := c.client.GetObject(ctx, bucketName, objectName, opts)
+	if err != nil {
+		c.breaker.Record(generation, err)
+		return nil, err
+	}
+	return &breakerObject{MinioObject: object, breaker: c.breaker, generation: generation}, nil
+}
+
+func (c *circuitBreakerClient) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (info minio.ObjectInfo, err error) {
+	err = c.do(func() error {
+		info, err = c.client.StatObject(ctx, bucketName, objectName, opts)
+		return err
+	})
+	return info, err
+}
+
+func (c *circuitBreakerClient) CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (info minio.UploadInfo, err error) {
+	err = c.do(func() error {
+		info, err = c.client.CopyObject(ctx, dst, src)
+		return err
+	})
+	return info, err
+}
+
+func (c *circuitBreakerClient) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	return c.do(func() error {
+		return c.client.RemoveObject(ctx, bucketName, objectName, opts)
+	})
+}
+
+// ListObjects records the outcome of the first page, like forward.
+func (c *circuitBreakerClient) ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	generation, err := c.breaker.Allow()
+	if err != nil {
+		return errorListing(err)
+	}
+	return forward(ctx, c.breaker, generation, c.client.ListObjects(ctx, bucketName, opts), func(object minio.ObjectInfo) error {
+		return object.Err
+	})
+}
+
+// RemoveObjects records the first removal error, or success once every
+// object was removed. With the circuit open every object fails.
+func (c *circuitBreakerClient) RemoveObjects(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+	generation, err := c.breaker.Allow()
+	if err != nil {
+		return errorRemoval(objectsCh, err)
+	}
+	return forward(ctx, c.breaker, generation, c.client.RemoveObjects(ctx, bucketName, objectsCh, opts), func(result minio.RemoveObjectError) error {
+		return result.Err
+	})
+}
+
+// RemoveObjectsWithResult records the outcome of the first result, like
+// forward. With the circuit open every object fails.
+func (c *circuitBreakerClient) RemoveObjectsWithResult(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectResult {
+	generation, err := c.breaker.Allow()
+	if err != nil {
+		out := make(chan minio.RemoveObjectResult)
+		go func() {
+			defer close(out)
+			for result := range errorRemoval(objectsCh, err) {
+				out <- minio.RemoveObjectResult{ObjectName: result.ObjectName, ObjectVersionID: result.VersionID, Err: result.Err}
+			}
+		}()
+		return out
+	}
+	return forward(ctx, c.breaker, generation, c.client.RemoveObjectsWithResult(ctx, bucketName, objectsCh, opts), func(result minio.RemoveObjectResult) error {
+		return result.Err
+	})
+}
+
+func (c *circuitBreakerClient) GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (t *tags.Tags, err error) {
+	err = c.do(func() error {
+		t, err = c.client.GetObjectTagging(ctx, bucketName, objectName, opts)
+		return err
+	})
+	return t, err
+}
+
+func (c *circuitBreakerClient) PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error {
+	return c.do(func() error {
+		return c.client.PutObjectTagging(ctx, bucketName, objectName, otags, opts)
+	})
+}
+
+func (c *circuitBreakerClient) RemoveObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectTaggingOptions) error {
+	return c.do(func() error {
+		return c.client.RemoveObjectTagging(ctx, bucketName, objectName, opts)
+	})
+}
+
+func (c *circuitBreakerClient) SetObjectLockConfig(ctx context.Context, bucketName string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit) error {
+	return c.do(func() error {
+		return c.client.SetObjectLockConfig(ctx, bucketName, mode, validity, unit)
+	})
+}
+
+func (c *circuitBreakerClient) GetObjectLockConfig(ctx context.Context, bucketName string) (objectLock string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit, err error) {
+	err = c.do(func() error {
+		objectLock, mode, validity, unit, err = c.client.GetObjectLockConfig(ctx, bucketName)
+		return err
+	})
+	return objectLock, mode, validity, unit, err
+}
+
+func (c *circuitBreakerClient) PutObjectRetention(ctx context.Context, bucketName, objectName string, opts minio.PutObjectRetentionOptions) error {
+	return c.do(func() error {
+		return c.client.PutObjectRetention(ctx, bucketName, objectName, opts)
+	})
+}
+
+func (c *circuitBreakerClient) GetObjectRetention(ctx context.Context, bucketName, objectName, versionID string) (mode *minio.RetentionMode, retainUntilDate *time.Time, err error) {
+	err = c.do(func() error {
+		mode, retainUntilDate, err = c.client.GetObjectRetention(ctx, bucketName, objectName, versionID)
+		return err
+	})
+	return mode, retainUntilDate, err
+}
+
+func (c *circuitBreakerClient) PutObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minio.PutObjectLegalHoldOptions) error {
+	return c.do(func() error {
+		return c.client.PutObjectLegalHold(ctx, bucketName, objectName, opts)
+	})
+}
+
+func (c *circuitBreakerClient) GetObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minio.GetObjectLegalHoldOptions) (status *minio.LegalHoldStatus, err error) {
+	err = c.do(func() error {
+		status, err = c.client.GetObjectLegalHold(ctx, bucketName, objectName, opts)
+		return err
+	})
+	return status, err
+}
+
+// PresignedGetObject goes through the breaker since signing may have to look
+// up the bucket region.
+func (c *circuitBreakerClient) PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (u *url.URL, err error) {
+	err = c.do(func() error {
+		u, err = c.client.PresignedGetObject(ctx, bucketName, objectName, expires, reqParams)
+		return err
+	})
+	return u, err
+}
+
+func (c *circuitBreakerClient) PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (u *url.URL, err error) {
+	err = c.do(func() error {
+		u, err = c.client.PresignedPutObject(ctx, bucketName, objectName, expires)
+		return err
+	})
+	return u, err
+}
+
+func (c *circuitBreakerClient) NewMultipartUpload(ctx context.Context, bucketName, objectName string, opts minio.PutObjectOptions) (uploadID string, err error) {
+	err = c.do(func() error {
+		uploadID, err = c.client.NewMultipartUpload(ctx, bucketName, objectName, opts)
+		return err
+	})
+	return uploadID, err
+}
+
+func (c *circuitBreakerClient) PutObjectPart(ctx context.Context, bucketName, objectName, uploadID string, partNumber int, reader io.Reader, size int64, opts minio.PutObjectPartOptions) (part minio.ObjectPart, err error) {
+	body := newUploadBody(reader, size)
+	err = c.doUpload(body, func() error {
+		part, err = c.client.PutObjectPart(ctx, bucketName, objectName, uploadID, partNumber, body.reader(), size, opts)
+		return err
+	})
+	return part, err
+}
+
+func (c *circuitBreakerClient) ListObjectParts(ctx context.Context, bucketName, objectName, uploadID string, partNumberMarker, maxParts int) (result minio.ListObjectPartsResult, err error) {
+	err = c.do(func() error {
+		result, err = c.client.ListObjectParts(ctx, bucketName, objectName, uploadID, partNumberMarker, maxParts)
+		return err
+	})
+	return result, err
+}
+
+func (c *circuitBreakerClient) CompleteMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string, parts []minio.CompletePart, opts minio.PutObjectOptions) (info minio.UploadInfo, err error) {
+	err = c.do(func() error {
+		info, err = c.client.CompleteMultipartUpload(ctx, bucketName, objectName, uploadID, parts, opts)
+		return err
+	})
+	return info, err
+}
+
+func (c *circuitBreakerClient) AbortMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string) error {
+	return c.do(func() error {
+		return c.client.AbortMultipartUpload(ctx, bucketName, objectName, uploadID)
+	})
+}
+
+// ListIncompleteUploads records the outcome of the first page, like forward.
+func (c *circuitBreakerClient) ListIncompleteUploads(ctx context.Context, bucketName, objectPrefix string, recursive bool) <-chan minio.ObjectMultipartInfo {
+	generation, err := c.breaker.Allow()
+	if err != nil {
+		ch := make(chan minio.ObjectMultipartInfo, 1)
+		ch <- minio.ObjectMultipartInfo{Err: err}
+		close(ch)
+		return ch
+	}
+	return forward(ctx, c.breaker, generation, c.client.ListIncompleteUploads(ctx, bucketName, objectPrefix, recursive), func(upload minio.ObjectMultipartInfo) error {
+		return upload.Err
+	})
+}
+
+// forward passes the results of a streaming call on to the consumer. The
+// error of the first result, or success if there is none, is recorded before
+// it is passed on, so the breaker never waits on a consumer that stopped
+// reading. Failures after the first result are not counted. Once ctx is done
+// the remaining results are dropped.
+func forward[T any](ctx context.Context, breaker *CircuitBreaker, generation uint64, in <-chan T, errOf func(T) error) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		recorded := false
+		for item := range in {
+			if !recorded {
+				breaker.Record(generation, errOf(item))
+				recorded = true
+			}
+			select {
+			case out <- item:
+			case <-ctx.Done():
+			}
+		}
+		if !recorded {
+			breaker.Record(generation, nil)
+		}
+	}()
+	return out
+}
+
+func errorListing(err error) <-chan minio.ObjectInfo {
+	ch := make(chan minio.ObjectInfo, 1)
+	ch <- minio.ObjectInfo{Err: err}
+	close(ch)
+	return ch
+}
+
+// errorRemoval fails every object received on objectsCh with err.
+func errorRemoval(objectsCh <-chan minio.ObjectInfo, err error) <-chan minio.RemoveObjectError {
+	out := make(chan minio.RemoveObjectError)
+	go func() {
+		defer close(out)
+		for object := range objectsCh {
+			out <- minio.RemoveObjectError{ObjectName: object.Key, VersionID: object.VersionID, Err: err}
+		}
+	}()
+	return out
+}
+
+type breakerObject struct {
+	MinioObject
+	breaker    *CircuitBreaker
+	generation uint64
+	once       sync.Once
+}
+
+func (o *breakerObject) record(err error) {
+	if err == io.EOF {
+		err = nil
+	}
+	o.once.Do(func() { o.breaker.Record(o.generation, err) })
+}
+
+// uploadBody tracks reads of an upload body, to tell an instance failing
+// from the client sending the body going away.
+type uploadBody struct {
+	r    io.Reader
+	size int64
+
+	read int64
+	err  error
+}
+
+func newUploadBody(r io.Reader, size int64) *uploadBody {
+	return &uploadBody{r: r, size: size}
+}
+
+// reader returns what to upload from. Seekable bodies are held in memory or
+// on disk and passed on as they are, so minio-go can still read them in
+// parallel and rewind them for retries.
+func (b *uploadBody) reader() io.Reader {
+	if _, ok := b.r.(io.ReaderAt); ok {
+		if _, ok := b.r.(io.Seeker); ok {
+			return b.r
+		}
+	}
+	return b
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// failed reports whether the body could not be read, or ended before its
+// advertised size.
+func (b *uploadBody) failed() bool {
+	if b.err == nil {
+		return false
+	}
+	return b.err != io.EOF || (b.size >= 0 && b.read < b.size)
+}
+
+func (o *breakerObject) Read(p []byte) (int, error) {
+	n, err := o.MinioObject.Read(p)
+	o.record(err)
+	return n, err
+}
+
+func (o *breakerObject) Stat() (minio.ObjectInfo, error) {
+	info, err := o.MinioObject.Stat()
+	o.record(err)
+	return info, err
+}
+
+func (o *breakerObject) Close() error {
+	o.record(nil)
+	return o.MinioObject.Close()
+}
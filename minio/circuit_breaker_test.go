@@ -0,0 +1,206 @@
+package minio_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	minioGo "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func testBreakerConfig() minio_adapter.CircuitBreakerConfig {
+	return minio_adapter.CircuitBreakerConfig{
+		Window:         time.Minute,
+		MinRequests:    4,
+		FailureRate:    0.5,
+		OpenTimeout:    20 * time.Millisecond,
+		HalfOpenProbes: 1,
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("Opens once the failure rate is exceeded", func(t *testing.T) {
+		var transitions []string
+		breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), func(name string, from, to minio_adapter.BreakerState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		})
+
+		for _, err := range []error{nil, errors.New("connection reset"), nil, errors.New("connection reset")} {
+			record(t, breaker, err)
+		}
+
+		assert.Equal(t, minio_adapter.StateOpen, breaker.State())
+		_, err := breaker.Allow()
+		assert.ErrorIs(t, err, minio_adapter.ErrCircuitOpen)
+		assert.Equal(t, []string{"closed->open"}, transitions)
+	})
+
+	t.Run("S3 client errors do not count as failures", func(t *testing.T) {
+		breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), nil)
+
+		for i := 0; i < 10; i++ {
+			record(t, breaker, minioGo.ErrorResponse{Code: "NoSuchKey", StatusCode: 404})
+		}
+
+		assert.Equal(t, minio_adapter.StateClosed, breaker.State())
+	})
+
+	t.Run("Invalid caller input does not count as a failure", func(t *testing.T) {
+		breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), nil)
+
+		for i := 0; i < 10; i++ {
+			record(t, breaker, fmt.Errorf("upload body: %w", minio_adapter.ErrInvalidInput))
+		}
+
+		assert.Equal(t, minio_adapter.StateClosed, breaker.State())
+	})
+
+	t.Run("Half-open probe closes the circuit on success", func(t *testing.T) {
+		breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), nil)
+		for i := 0; i < 4; i++ {
+			record(t, breaker, minioGo.ErrorResponse{Code: "InternalError", StatusCode: 500})
+		}
+		assert.Equal(t, minio_adapter.StateOpen, breaker.State())
+
+		time.Sleep(30 * time.Millisecond)
+
+		generation, err := breaker.Allow()
+		assert.NoError(t, err)
+		assert.Equal(t, minio_adapter.StateHalfOpen, breaker.State())
+		_, err = breaker.Allow()
+		assert.ErrorIs(t, err, minio_adapter.ErrCircuitOpen)
+
+		breaker.Record(generation, nil)
+		assert.Equal(t, minio_adapter.StateClosed, breaker.State())
+	})
+
+	t.Run("Half-open probe failure reopens the circuit", func(t *testing.T) {
+		breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), nil)
+		for i := 0; i < 4; i++ {
+			record(t, breaker, context.DeadlineExceeded)
+		}
+		time.Sleep(30 * time.Millisecond)
+
+		record(t, breaker, context.DeadlineExceeded)
+
+		assert.Equal(t, minio_adapter.StateOpen, breaker.State())
+	})
+
+	t.Run("Calls admitted before a transition are ignored", func(t *testing.T) {
+		breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), nil)
+		stale, err := breaker.Allow()
+		assert.NoError(t, err)
+		for i := 0; i < 4; i++ {
+			record(t, breaker, context.DeadlineExceeded)
+		}
+		time.Sleep(30 * time.Millisecond)
+
+		probe, err := breaker.Allow()
+		assert.NoError(t, err)
+		// The slow call admitted while closed neither closes the circuit nor
+		// frees the probe.
+		breaker.Record(stale, nil)
+		assert.Equal(t, minio_adapter.StateHalfOpen, breaker.State())
+		_, err = breaker.Allow()
+		assert.ErrorIs(t, err, minio_adapter.ErrCircuitOpen)
+
+		breaker.Record(probe, nil)
+		assert.Equal(t, minio_adapter.StateClosed, breaker.State())
+	})
+}
+
+// record passes a call with the outcome err through breaker.
+func record(t *testing.T, breaker *minio_adapter.CircuitBreaker, err error) {
+	generation, allowErr := breaker.Allow()
+	assert.NoError(t, allowErr)
+	breaker.Record(generation, err)
+}
+
+func TestCircuitBreakerClient(t *testing.T) {
+	mockClient := new(mocks.MockMinioClient)
+	breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), nil)
+	client := minio_adapter.NewCircuitBreakerClient(mockClient, breaker)
+
+	mockClient.On("BucketExists", mock.Anything, "bucket").Return(false, errors.New("connection refused")).Times(4)
+
+	for i := 0; i < 4; i++ {
+		_, err := client.BucketExists(context.Background(), "bucket")
+		assert.EqualError(t, err, "connection refused")
+	}
+
+	_, err := client.BucketExists(context.Background(), "bucket")
+	assert.ErrorIs(t, err, minio_adapter.ErrCircuitOpen)
+
+	err = client.RemoveObject(context.Background(), "bucket", "object", minioGo.RemoveObjectOptions{})
+	assert.ErrorIs(t, err, minio_adapter.ErrCircuitOpen)
+
+	objectsCh := make(chan minioGo.ObjectInfo, 2)
+	objectsCh <- minioGo.ObjectInfo{Key: "a"}
+	objectsCh <- minioGo.ObjectInfo{Key: "b"}
+	close(objectsCh)
+	var failed []string
+	for result := range client.RemoveObjects(context.Background(), "bucket", objectsCh, minioGo.RemoveObjectsOptions{}) {
+		assert.ErrorIs(t, result.Err, minio_adapter.ErrCircuitOpen)
+		failed = append(failed, result.ObjectName)
+	}
+	assert.Equal(t, []string{"a", "b"}, failed)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestCircuitBreakerClientUploads(t *testing.T) {
+	mockClient := new(mocks.MockMinioClient)
+	breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), nil)
+	client := minio_adapter.NewCircuitBreakerClient(mockClient, breaker)
+
+	mockClient.On("PutObject", mock.Anything, "bucket", "object", mock.Anything, int64(10), mock.Anything).Run(func(args mock.Arguments) {
+		io.ReadAll(args.Get(3).(io.Reader))
+	}).Return(minioGo.UploadInfo{}, io.ErrUnexpectedEOF)
+
+	// Clients going away mid-upload are not the instance's fault.
+	bodies := []io.Reader{
+		iotest.ErrReader(errors.New("client disconnected")),
+		strings.NewReader("short"),
+		iotest.ErrReader(errors.New("client disconnected")),
+		strings.NewReader("short"),
+	}
+	for _, body := range bodies {
+		_, err := client.PutObject(context.Background(), "bucket", "object", io.MultiReader(body), 10, minioGo.PutObjectOptions{})
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	}
+
+	assert.Equal(t, minio_adapter.StateClosed, breaker.State())
+}
+
+func TestCircuitBreakerClientListings(t *testing.T) {
+	mockClient := new(mocks.MockMinioClient)
+	breaker := minio_adapter.NewCircuitBreaker("node", testBreakerConfig(), nil)
+	client := minio_adapter.NewCircuitBreakerClient(mockClient, breaker)
+	for i := 0; i < 4; i++ {
+		record(t, breaker, context.DeadlineExceeded)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	mockClient.On("ListObjects", mock.Anything, "bucket", mock.Anything).Return([]minioGo.ObjectInfo{{Key: "a"}, {Key: "b"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	objects := client.ListObjects(ctx, "bucket", minioGo.ListObjectsOptions{})
+	assert.Equal(t, "a", (<-objects).Key)
+
+	// The probe is settled by the first page, even though the rest of the
+	// listing is never read.
+	assert.Eventually(t, func() bool {
+		return breaker.State() == minio_adapter.StateClosed
+	}, time.Second, time.Millisecond)
+}
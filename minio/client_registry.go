@@ -0,0 +1,223 @@
+package minio
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+var ErrNoInstances = errors.New("no MinIO instances available")
+
+// NewTransport returns the http.Transport shared by every pooled MinIO client.
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   64,
+		MaxConnsPerHost:       256,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		// MinIO objects may be stored gzip encoded; never decode them on the fly.
+		DisableCompression: true,
+	}
+}
+
+// NewClient builds a MinIO client for instance using the given transport.
+func NewClient(instance MinioInstance, transport http.RoundTripper) (MinioClientInterface, error) {
+	client, err := minio.New(instance.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(instance.AccessKey, instance.SecretKey, ""),
+		Secure:    false,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewMinioAdapter(client), nil
+}
+
+type registrySnapshot struct {
+	instances []MinioInstance
+	clients   []MinioClientInterface
+	errs      []error
+}
+
+// ClientRegistry holds one long-lived client per MinIO instance. The set of
+// instances and their clients is swapped atomically as a whole on Update.
+type ClientRegistry struct {
+	transport *http.Transport
+	newClient func(MinioInstance, http.RoundTripper) (MinioClientInterface, error)
+
+	breakerConfig        CircuitBreakerConfig
+	onBreakerStateChange StateChangeFunc
+	retryPolicy          RetryPolicy
+
+	mu       sync.Mutex
+	snapshot atomic.Pointer[registrySnapshot]
+}
+
+type RegistryOption func(*ClientRegistry)
+
+// WithCircuitBreaker sets the breaker configuration used for every instance
+// and a callback notified of breaker state transitions.
+func WithCircuitBreaker(config CircuitBreakerConfig, onStateChange StateChangeFunc) RegistryOption {
+	return func(r *ClientRegistry) {
+		r.breakerConfig = config
+		r.onBreakerStateChange = onStateChange
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry transient backend errors.
+func WithRetryPolicy(policy RetryPolicy) RegistryOption {
+	return func(r *ClientRegistry) {
+		r.retryPolicy = policy
+	}
+}
+
+func NewClientRegistry(instances []MinioInstance, opts ...RegistryOption) *ClientRegistry {
+	r := &ClientRegistry{
+		transport:     NewTransport(),
+		newClient:     NewClient,
+		breakerConfig: DefaultCircuitBreakerConfig(),
+		retryPolicy:   DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.Update(instances)
+	return r
+}
+
+// Update rebuilds the registry for a new set of instances. Clients for
+// instances that are still present are reused. It reports whether the
+// instance set actually changed.
+func (r *ClientRegistry) Update(instances []MinioInstance) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	instances = sortedInstances(instances)
+	current := r.snapshot.Load()
+	if current != nil && sameInstances(current.instances, instances) {
+		return false
+	}
+
+	existing := make(map[MinioInstance]int)
+	if current != nil {
+		for i, instance := range current.instances {
+			existing[instance] = i
+		}
+	}
+
+	next := &registrySnapshot{
+		instances: instances,
+		clients:   make([]MinioClientInterface, len(instances)),
+		errs:      make([]error, len(instances)),
+	}
+	for i, instance := range instances {
+		if j, ok := existing[instance]; ok && current.errs[j] == nil {
+			next.clients[i] = current.clients[j]
+			continue
+		}
+		next.clients[i], next.errs[i] = r.buildClient(instance)
+	}
+
+	r.snapshot.Store(next)
+	return true
+}
+
+func (r *ClientRegistry) buildClient(instance MinioInstance) (MinioClientInterface, error) {
+	client, err := r.newClient(instance, r.transport)
+	if err != nil {
+		return nil, err
+	}
+	// Retries wrap the breaker so every attempt is accounted for and an open
+	// circuit is never retried.
+	breaker := NewCircuitBreaker(instance.Endpoint, r.breakerConfig, r.onBreakerStateChange)
+	return NewRetryClient(NewCircuitBreakerClient(client, breaker), r.retryPolicy), nil
+}
+
+// Instances returns the instance set the registry currently serves.
+func (r *ClientRegistry) Instances() []MinioInstance {
+	return append([]MinioInstance(nil), r.snapshot.Load().instances...)
+}
+
+// Len returns the number of instances in the registry.
+func (r *ClientRegistry) Len() int {
+	return len(r.snapshot.Load().instances)
+}
+
+// ClientForKey returns the client of the instance that owns key. Placement is
+// a FNV-1a hash of the key modulo the number of instances.
+func (r *ClientRegistry) ClientForKey(key string) (MinioClientInterface, error) {
+	s := r.snapshot.Load()
+	if len(s.instances) == 0 {
+		return nil, ErrNoInstances
+	}
+	index := InstanceIndex(key, len(s.instances))
+	return s.clients[index], s.errs[index]
+}
+
+// InstanceClient pairs an instance with its pooled client, or the error that
+// prevented the client from being built.
+type InstanceClient struct {
+	Instance MinioInstance
+	Client   MinioClientInterface
+	Err      error
+}
+
+// Clients returns the client of every instance in the registry.
+func (r *ClientRegistry) Clients() []InstanceClient {
+	s := r.snapshot.Load()
+	clients := make([]InstanceClient, len(s.instances))
+	for i, instance := range s.instances {
+		clients[i] = InstanceClient{Instance: instance, Client: s.clients[i], Err: s.errs[i]}
+	}
+	return clients
+}
+
+// CloseIdleConnections drops every idle pooled connection.
+func (r *ClientRegistry) CloseIdleConnections() {
+	r.transport.CloseIdleConnections()
+}
+
+// InstanceIndex maps key onto one of n instances.
+func InstanceIndex(key string, n int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(n))
+}
+
+// sortedInstances orders instances by endpoint so placement does not depend
+// on the order Docker happens to list containers in.
+func sortedInstances(instances []MinioInstance) []MinioInstance {
+	sorted := append([]MinioInstance(nil), instances...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Endpoint < sorted[j].Endpoint
+	})
+	return sorted
+}
+
+func sameInstances(a, b []MinioInstance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
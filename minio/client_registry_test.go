@@ -0,0 +1,151 @@
+package minio_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	minioGo "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+)
+
+func TestClientRegistry(t *testing.T) {
+	instances := []minio_adapter.MinioInstance{
+		{Endpoint: "10.0.0.1:9000", AccessKey: "a", SecretKey: "a"},
+		{Endpoint: "10.0.0.2:9000", AccessKey: "b", SecretKey: "b"},
+		{Endpoint: "10.0.0.3:9000", AccessKey: "c", SecretKey: "c"},
+	}
+
+	t.Run("Reuses clients across requests", func(t *testing.T) {
+		registry := minio_adapter.NewClientRegistry(instances)
+
+		first, err := registry.ClientForKey("bucket")
+		require.NoError(t, err)
+		second, err := registry.ClientForKey("bucket")
+		require.NoError(t, err)
+
+		assert.Same(t, first, second)
+		assert.Equal(t, 3, registry.Len())
+	})
+
+	t.Run("Same instance set is a no-op", func(t *testing.T) {
+		registry := minio_adapter.NewClientRegistry(instances)
+		before, _ := registry.ClientForKey("bucket")
+
+		reordered := []minio_adapter.MinioInstance{instances[2], instances[0], instances[1]}
+		assert.False(t, registry.Update(reordered))
+
+		after, _ := registry.ClientForKey("bucket")
+		assert.Same(t, before, after)
+	})
+
+	t.Run("Changed instance set is rebuilt keeping surviving clients", func(t *testing.T) {
+		registry := minio_adapter.NewClientRegistry(instances[:2])
+		clientsBefore := map[string]minio_adapter.MinioClientInterface{}
+		for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+			c, _ := registry.ClientForKey(key)
+			clientsBefore[key] = c
+		}
+
+		assert.True(t, registry.Update(instances))
+		assert.Equal(t, 3, registry.Len())
+		assert.Equal(t, sortedEndpoints(instances), sortedEndpoints(registry.Instances()))
+
+		reused := 0
+		for key, before := range clientsBefore {
+			after, err := registry.ClientForKey(key)
+			require.NoError(t, err)
+			if after == before {
+				reused++
+			}
+		}
+		assert.NotZero(t, reused)
+	})
+
+	t.Run("No instances", func(t *testing.T) {
+		registry := minio_adapter.NewClientRegistry(nil)
+
+		client, err := registry.ClientForKey("bucket")
+
+		assert.Nil(t, client)
+		assert.ErrorIs(t, err, minio_adapter.ErrNoInstances)
+	})
+}
+
+func TestInstanceIndex(t *testing.T) {
+	for _, key := range []string{"", "bucket", "testobject123"} {
+		index := minio_adapter.InstanceIndex(key, 3)
+		assert.GreaterOrEqual(t, index, 0)
+		assert.Less(t, index, 3)
+		assert.Equal(t, index, minio_adapter.InstanceIndex(key, 3))
+	}
+}
+
+func sortedEndpoints(instances []minio_adapter.MinioInstance) string {
+	endpoints := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		endpoints = append(endpoints, instance.Endpoint)
+	}
+	sort.Strings(endpoints)
+	return strings.Join(endpoints, ",")
+}
+
+func newBenchmarkServer(b *testing.B) minio_adapter.MinioInstance {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("location") {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	b.Cleanup(server.Close)
+	return minio_adapter.MinioInstance{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		AccessKey: "access",
+		SecretKey: "secret",
+	}
+}
+
+func BenchmarkPerRequestClient(b *testing.B) {
+	instance := newBenchmarkServer(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client, err := minioGo.New(instance.Endpoint, &minioGo.Options{
+			Creds:  credentials.NewStaticV4(instance.AccessKey, instance.SecretKey, ""),
+			Secure: false,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := minio_adapter.NewMinioAdapter(client).BucketExists(ctx, "bucket"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPooledClient(b *testing.B) {
+	instance := newBenchmarkServer(b)
+	registry := minio_adapter.NewClientRegistry([]minio_adapter.MinioInstance{instance})
+	b.Cleanup(registry.CloseIdleConnections)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client, err := registry.ClientForKey("bucket")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := client.BucketExists(ctx, "bucket"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
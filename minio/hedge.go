@@ -0,0 +1,209 @@
+package minio
+
+import (
+	"context"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+var hedgeStats = expvar.NewMap("minio_hedged_gets")
+
+type HedgeConfig struct {
+	// Percentile of recent first-response latencies after which a hedge is
+	// sent, as a fraction between 0 and 1.
+	Percentile float64
+	// MinDelay and MaxDelay clamp the computed hedge delay. MaxDelay is also
+	// used until enough samples have been observed.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Samples is the number of recent latencies the percentile is computed over.
+	Samples    int
+	MinSamples int
+	// MaxHedgeRatio caps hedges to this fraction of requests so that hedging
+	// cannot double the load on a struggling cluster.
+	MaxHedgeRatio float64
+}
+
+func DefaultHedgeConfig() HedgeConfig {
+	return HedgeConfig{
+		Percentile:    0.95,
+		MinDelay:      5 * time.Millisecond,
+		MaxDelay:      500 * time.Millisecond,
+		Samples:       1000,
+		MinSamples:    50,
+		MaxHedgeRatio: 0.05,
+	}
+}
+
+// Hedger issues GetObject against a second replica when the first has not
+// responded within a latency percentile, keeping whichever answers first.
+type Hedger struct {
+	config HedgeConfig
+	budget *retryBudget
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	// delay is the percentile of samples, recomputed every MinSamples
+	// observations rather than on every read.
+	delay       time.Duration
+	unaccounted int
+}
+
+func NewHedger(config HedgeConfig) *Hedger {
+	return &Hedger{
+		config:  config,
+		budget:  &retryBudget{tokens: 1, ratio: config.MaxHedgeRatio, burst: 1},
+		samples: make([]time.Duration, 0, config.Samples),
+		delay:   config.MaxDelay,
+	}
+}
+
+// Delay returns how long to wait for the primary before hedging.
+func (h *Hedger) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+func (h *Hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < h.config.Samples {
+		h.samples = append(h.samples, latency)
+	} else {
+		h.samples[h.next] = latency
+		h.next = (h.next + 1) % len(h.samples)
+	}
+	h.unaccounted++
+	if len(h.samples) >= h.config.MinSamples && h.unaccounted >= max(h.config.MinSamples, 1) {
+		h.delay = h.percentile()
+		h.unaccounted = 0
+	}
+}
+
+// percentile computes the hedge delay from the samples. The caller holds mu.
+func (h *Hedger) percentile() time.Duration {
+	sorted := append([]time.Duration(nil), h.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := min(max(int(h.config.Percentile*float64(len(sorted)-1)), 0), len(sorted)-1)
+	delay := sorted[index]
+	if delay < h.config.MinDelay {
+		return h.config.MinDelay
+	}
+	if delay > h.config.MaxDelay {
+		return h.config.MaxDelay
+	}
+	return delay
+}
+
+type hedgeResult struct {
+	attempt int
+	object  MinioObject
+	latency time.Duration
+	err     error
+}
+
+// GetObject reads from replicas[0] and, if it is slow to respond, from
+// replicas[1]. With a single replica there is nowhere to hedge to, as a second
+// request to a slow instance would only add to its load, so the read is
+// only timed. The returned object is already statted.
+func (h *Hedger) GetObject(ctx context.Context, replicas []MinioClientInterface, bucketName, objectName string, opts minio.GetObjectOptions) (MinioObject, error) {
+	if len(replicas) < 2 {
+		began := time.Now()
+		object, err := replicas[0].GetObject(ctx, bucketName, objectName, opts)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := object.Stat(); err != nil {
+			object.Close()
+			return nil, err
+		}
+		h.observe(time.Since(began))
+		return object, nil
+	}
+
+	h.budget.deposit()
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+
+	start := func(client MinioClientInterface) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		began := time.Now()
+		go func() {
+			object, err := client.GetObject(attemptCtx, bucketName, objectName, opts)
+			if err == nil {
+				if _, err = object.Stat(); err != nil {
+					object.Close()
+					object = nil
+				}
+			}
+			results <- hedgeResult{attempt: attempt, object: object, latency: time.Since(began), err: err}
+		}()
+	}
+
+	start(replicas[0])
+	inFlight := 1
+
+	timer := time.NewTimer(h.Delay())
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if inFlight == 1 && firstErr == nil && h.budget.withdraw() {
+				hedgeStats.Add("hedged", 1)
+				start(replicas[1])
+				inFlight++
+			}
+		case result := <-results:
+			inFlight--
+			if result.err == nil {
+				h.observe(result.latency)
+				if result.attempt > 0 {
+					hedgeStats.Add("hedge_won", 1)
+				}
+				for attempt, cancel := range cancels {
+					if attempt != result.attempt {
+						cancel()
+					}
+				}
+				go drain(results, inFlight)
+				return &hedgedObject{MinioObject: result.object, cancel: cancels[result.attempt]}, nil
+			}
+			cancels[result.attempt]()
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if inFlight == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// drain closes objects opened by attempts that lost the race.
+func drain(results <-chan hedgeResult, inFlight int) {
+	for ; inFlight > 0; inFlight-- {
+		if result := <-results; result.object != nil {
+			result.object.Close()
+		}
+	}
+}
+
+type hedgedObject struct {
+	MinioObject
+	cancel context.CancelFunc
+}
+
+func (o *hedgedObject) Close() error {
+	defer o.cancel()
+	return o.MinioObject.Close()
+}
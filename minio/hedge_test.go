@@ -0,0 +1,193 @@
+package minio_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	minioGo "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func testHedgeConfig() minio_adapter.HedgeConfig {
+	return minio_adapter.HedgeConfig{
+		Percentile:    0.9,
+		MinDelay:      time.Millisecond,
+		MaxDelay:      20 * time.Millisecond,
+		Samples:       10,
+		MinSamples:    1,
+		MaxHedgeRatio: 1,
+	}
+}
+
+func statObject(info minioGo.ObjectInfo, err error) *mocks.MockMinioObject {
+	object := new(mocks.MockMinioObject)
+	object.On("Stat").Return(info, err)
+	object.On("Close").Return(nil)
+	return object
+}
+
+func TestHedger(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Fast primary is not hedged", func(t *testing.T) {
+		primary := new(mocks.MockMinioClient)
+		secondary := new(mocks.MockMinioClient)
+		object := statObject(minioGo.ObjectInfo{Size: 1}, nil)
+		primary.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Return(object, nil).Once()
+
+		hedger := minio_adapter.NewHedger(testHedgeConfig())
+		got, err := hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{primary, secondary}, "bucket", "object", minioGo.GetObjectOptions{})
+
+		assert.NoError(t, err)
+		info, _ := got.Stat()
+		assert.Equal(t, int64(1), info.Size)
+		assert.NoError(t, got.Close())
+		primary.AssertExpectations(t)
+		secondary.AssertNotCalled(t, "GetObject", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Slow primary loses to the hedge and is cancelled", func(t *testing.T) {
+		primary := new(mocks.MockMinioClient)
+		secondary := new(mocks.MockMinioClient)
+		cancelled := make(chan struct{})
+		primary.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+			close(cancelled)
+		}).Return(nil, context.Canceled).Once()
+		secondary.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).
+			Return(statObject(minioGo.ObjectInfo{Size: 2}, nil), nil).Once()
+
+		hedger := minio_adapter.NewHedger(testHedgeConfig())
+		got, err := hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{primary, secondary}, "bucket", "object", minioGo.GetObjectOptions{})
+
+		assert.NoError(t, err)
+		info, _ := got.Stat()
+		assert.Equal(t, int64(2), info.Size)
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("losing request was not cancelled")
+		}
+		got.Close()
+	})
+
+	t.Run("Single replica is not hedged", func(t *testing.T) {
+		primary := new(mocks.MockMinioClient)
+		primary.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Run(func(mock.Arguments) {
+			time.Sleep(30 * time.Millisecond)
+		}).Return(statObject(minioGo.ObjectInfo{Size: 1}, nil), nil)
+
+		hedger := minio_adapter.NewHedger(testHedgeConfig())
+		got, err := hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{primary}, "bucket", "object", minioGo.GetObjectOptions{})
+
+		assert.NoError(t, err)
+		got.Close()
+		primary.AssertNumberOfCalls(t, "GetObject", 1)
+	})
+
+	t.Run("Hedge budget caps hedges", func(t *testing.T) {
+		config := testHedgeConfig()
+		config.MaxHedgeRatio = 0
+		primary := new(mocks.MockMinioClient)
+		secondary := new(mocks.MockMinioClient)
+		primary.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Run(func(mock.Arguments) {
+			time.Sleep(30 * time.Millisecond)
+		}).Return(statObject(minioGo.ObjectInfo{}, nil), nil)
+		secondary.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).
+			Return(statObject(minioGo.ObjectInfo{}, nil), nil)
+
+		hedger := minio_adapter.NewHedger(config)
+		replicas := []minio_adapter.MinioClientInterface{primary, secondary}
+		for i := 0; i < 3; i++ {
+			got, err := hedger.GetObject(ctx, replicas, "bucket", "object", minioGo.GetObjectOptions{})
+			assert.NoError(t, err)
+			got.Close()
+		}
+
+		// Only the initial banked token may be spent.
+		secondary.AssertNumberOfCalls(t, "GetObject", 1)
+	})
+
+	t.Run("Errors are returned when every attempt fails", func(t *testing.T) {
+		primary := new(mocks.MockMinioClient)
+		primary.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).
+			Return(statObject(minioGo.ObjectInfo{}, minioGo.ErrorResponse{Code: "NoSuchKey"}), nil).Once()
+
+		hedger := minio_adapter.NewHedger(testHedgeConfig())
+		got, err := hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{primary}, "bucket", "object", minioGo.GetObjectOptions{})
+
+		assert.Nil(t, got)
+		assert.Equal(t, "NoSuchKey", minioGo.ToErrorResponse(err).Code)
+		primary.AssertExpectations(t)
+	})
+
+	t.Run("Delay follows the observed percentile", func(t *testing.T) {
+		config := testHedgeConfig()
+		config.MaxDelay = time.Second
+		hedger := minio_adapter.NewHedger(config)
+		assert.Equal(t, time.Second, minio_adapter.NewHedger(minio_adapter.HedgeConfig{MaxDelay: time.Second, MinSamples: 1}).Delay())
+
+		client := new(mocks.MockMinioClient)
+		client.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Run(func(mock.Arguments) {
+			time.Sleep(10 * time.Millisecond)
+		}).Return(statObject(minioGo.ObjectInfo{}, nil), nil)
+		got, err := hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{client}, "bucket", "object", minioGo.GetObjectOptions{})
+		assert.NoError(t, err)
+		got.Close()
+
+		delay := hedger.Delay()
+		assert.GreaterOrEqual(t, delay, 10*time.Millisecond)
+		assert.Less(t, delay, time.Second)
+	})
+
+	t.Run("Delay is recomputed every MinSamples reads", func(t *testing.T) {
+		config := testHedgeConfig()
+		config.MinSamples = 2
+		config.MaxDelay = time.Second
+		hedger := minio_adapter.NewHedger(config)
+
+		client := new(mocks.MockMinioClient)
+		client.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Return(statObject(minioGo.ObjectInfo{}, nil), nil)
+		read := func() {
+			got, err := hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{client}, "bucket", "object", minioGo.GetObjectOptions{})
+			assert.NoError(t, err)
+			got.Close()
+		}
+
+		read()
+		assert.Equal(t, time.Second, hedger.Delay())
+		read()
+		assert.Less(t, hedger.Delay(), time.Second)
+	})
+
+	t.Run("Percentile out of range is clamped", func(t *testing.T) {
+		config := testHedgeConfig()
+		config.Percentile = 95
+		config.MaxDelay = time.Second
+		hedger := minio_adapter.NewHedger(config)
+
+		client := new(mocks.MockMinioClient)
+		client.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Return(statObject(minioGo.ObjectInfo{}, nil), nil)
+		got, err := hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{client}, "bucket", "object", minioGo.GetObjectOptions{})
+		assert.NoError(t, err)
+		got.Close()
+
+		assert.NotPanics(t, func() { hedger.Delay() })
+	})
+
+	t.Run("Primary failure is not masked by the hedge error", func(t *testing.T) {
+		primary := new(mocks.MockMinioClient)
+		primary.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Return(nil, errors.New("primary failed")).Once()
+
+		hedger := minio_adapter.NewHedger(testHedgeConfig())
+		_, err := hedger.GetObject(ctx, []minio_adapter.MinioClientInterface{primary, primary}, "bucket", "object", minioGo.GetObjectOptions{})
+
+		assert.EqualError(t, err, "primary failed")
+	})
+}
@@ -3,11 +3,17 @@ package minio
 import (
 	"context"
 	"io"
+	"net/url"
+	"time"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/tags"
 )
 
 type MinioInstance struct {
+	// ID is the name of the container running the instance.
+	ID        string
 	Endpoint  string
 	AccessKey string
 	SecretKey string
@@ -24,19 +30,56 @@ type MinioClientInterface interface {
 	MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error
 	BucketExists(ctx context.Context, bucketName string) (bool, error)
 	RemoveBucket(ctx context.Context, bucketName string) error
+	ListBuckets(ctx context.Context) ([]minio.BucketInfo, error)
+	SetBucketVersioning(ctx context.Context, bucketName string, config minio.BucketVersioningConfiguration) error
+	GetBucketVersioning(ctx context.Context, bucketName string) (minio.BucketVersioningConfiguration, error)
+	SetBucketLifecycle(ctx context.Context, bucketName string, config *lifecycle.Configuration) error
+	GetBucketLifecycle(ctx context.Context, bucketName string) (*lifecycle.Configuration, error)
 
 	// Object operations
 	PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
 	GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (MinioObject, error)
+	StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
 	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
+	ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+	RemoveObjects(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError
+	RemoveObjectsWithResult(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectResult
+
+	// Object tagging
+	GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (*tags.Tags, error)
+	PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error
+	RemoveObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectTaggingOptions) error
+
+	// Object locking
+	SetObjectLockConfig(ctx context.Context, bucketName string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit) error
+	GetObjectLockConfig(ctx context.Context, bucketName string) (objectLock string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit, err error)
+	PutObjectRetention(ctx context.Context, bucketName, objectName string, opts minio.PutObjectRetentionOptions) error
+	GetObjectRetention(ctx context.Context, bucketName, objectName, versionID string) (mode *minio.RetentionMode, retainUntilDate *time.Time, err error)
+	PutObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minio.PutObjectLegalHoldOptions) error
+	GetObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minio.GetObjectLegalHoldOptions) (*minio.LegalHoldStatus, error)
+
+	// Presigned URLs
+	PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error)
+	PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (*url.URL, error)
+
+	// Multipart upload operations
+	NewMultipartUpload(ctx context.Context, bucketName, objectName string, opts minio.PutObjectOptions) (string, error)
+	PutObjectPart(ctx context.Context, bucketName, objectName, uploadID string, partNumber int, reader io.Reader, size int64, opts minio.PutObjectPartOptions) (minio.ObjectPart, error)
+	ListObjectParts(ctx context.Context, bucketName, objectName, uploadID string, partNumberMarker, maxParts int) (minio.ListObjectPartsResult, error)
+	CompleteMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string, parts []minio.CompletePart, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	AbortMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string) error
+	ListIncompleteUploads(ctx context.Context, bucketName, objectPrefix string, recursive bool) <-chan minio.ObjectMultipartInfo
 }
 
 type MinioClientWrapper struct {
 	client *minio.Client
+	// core exposes the low-level multipart API of the same client.
+	core *minio.Core
 }
 
 func NewMinioAdapter(client *minio.Client) MinioClientInterface {
-	return &MinioClientWrapper{client: client}
+	return &MinioClientWrapper{client: client, core: &minio.Core{Client: client}}
 }
 
 func (m *MinioClientWrapper) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
@@ -51,6 +94,26 @@ func (m *MinioClientWrapper) RemoveBucket(ctx context.Context, bucketName string
 	return m.client.RemoveBucket(ctx, bucketName)
 }
 
+func (m *MinioClientWrapper) ListBuckets(ctx context.Context) ([]minio.BucketInfo, error) {
+	return m.client.ListBuckets(ctx)
+}
+
+func (m *MinioClientWrapper) SetBucketVersioning(ctx context.Context, bucketName string, config minio.BucketVersioningConfiguration) error {
+	return m.client.SetBucketVersioning(ctx, bucketName, config)
+}
+
+func (m *MinioClientWrapper) GetBucketVersioning(ctx context.Context, bucketName string) (minio.BucketVersioningConfiguration, error) {
+	return m.client.GetBucketVersioning(ctx, bucketName)
+}
+
+func (m *MinioClientWrapper) SetBucketLifecycle(ctx context.Context, bucketName string, config *lifecycle.Configuration) error {
+	return m.client.SetBucketLifecycle(ctx, bucketName, config)
+}
+
+func (m *MinioClientWrapper) GetBucketLifecycle(ctx context.Context, bucketName string) (*lifecycle.Configuration, error) {
+	return m.client.GetBucketLifecycle(ctx, bucketName)
+}
+
 func (m *MinioClientWrapper) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
 	return m.client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
 }
@@ -59,6 +122,94 @@ func (m *MinioClientWrapper) GetObject(ctx context.Context, bucketName, objectNa
 	return m.client.GetObject(ctx, bucketName, objectName, opts)
 }
 
+func (m *MinioClientWrapper) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	return m.client.StatObject(ctx, bucketName, objectName, opts)
+}
+
+func (m *MinioClientWrapper) CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error) {
+	return m.client.CopyObject(ctx, dst, src)
+}
+
 func (m *MinioClientWrapper) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
 	return m.client.RemoveObject(ctx, bucketName, objectName, opts)
 }
+
+func (m *MinioClientWrapper) ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	return m.client.ListObjects(ctx, bucketName, opts)
+}
+
+func (m *MinioClientWrapper) RemoveObjects(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+	return m.client.RemoveObjects(ctx, bucketName, objectsCh, opts)
+}
+
+func (m *MinioClientWrapper) RemoveObjectsWithResult(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectResult {
+	return m.client.RemoveObjectsWithResult(ctx, bucketName, objectsCh, opts)
+}
+
+func (m *MinioClientWrapper) GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (*tags.Tags, error) {
+	return m.client.GetObjectTagging(ctx, bucketName, objectName, opts)
+}
+
+func (m *MinioClientWrapper) PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error {
+	return m.client.PutObjectTagging(ctx, bucketName, objectName, otags, opts)
+}
+
+func (m *MinioClientWrapper) RemoveObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectTaggingOptions) error {
+	return m.client.RemoveObjectTagging(ctx, bucketName, objectName, opts)
+}
+
+func (m *MinioClientWrapper) SetObjectLockConfig(ctx context.Context, bucketName string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit) error {
+	return m.client.SetObjectLockConfig(ctx, bucketName, mode, validity, unit)
+}
+
+func (m *MinioClientWrapper) GetObjectLockConfig(ctx context.Context, bucketName string) (string, *minio.RetentionMode, *uint, *minio.ValidityUnit, error) {
+	return m.client.GetObjectLockConfig(ctx, bucketName)
+}
+
+func (m *MinioClientWrapper) PutObjectRetention(ctx context.Context, bucketName, objectName string, opts minio.PutObjectRetentionOptions) error {
+	return m.client.PutObjectRetention(ctx, bucketName, objectName, opts)
+}
+
+func (m *MinioClientWrapper) GetObjectRetention(ctx context.Context, bucketName, objectName, versionID string) (*minio.RetentionMode, *time.Time, error) {
+	return m.client.GetObjectRetention(ctx, bucketName, objectName, versionID)
+}
+
+func (m *MinioClientWrapper) PutObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minio.PutObjectLegalHoldOptions) error {
+	return m.client.PutObjectLegalHold(ctx, bucketName, objectName, opts)
+}
+
+func (m *MinioClientWrapper) GetObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minio.GetObjectLegalHoldOptions) (*minio.LegalHoldStatus, error) {
+	return m.client.GetObjectLegalHold(ctx, bucketName, objectName, opts)
+}
+
+func (m *MinioClientWrapper) PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	return m.client.PresignedGetObject(ctx, bucketName, objectName, expires, reqParams)
+}
+
+func (m *MinioClientWrapper) PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (*url.URL, error) {
+	return m.client.PresignedPutObject(ctx, bucketName, objectName, expires)
+}
+
+func (m *MinioClientWrapper) NewMultipartUpload(ctx context.Context, bucketName, objectName string, opts minio.PutObjectOptions) (string, error) {
+	return m.core.NewMultipartUpload(ctx, bucketName, objectName, opts)
+}
+
+func (m *MinioClientWrapper) PutObjectPart(ctx context.Context, bucketName, objectName, uploadID string, partNumber int, reader io.Reader, size int64, opts minio.PutObjectPartOptions) (minio.ObjectPart, error) {
+	return m.core.PutObjectPart(ctx, bucketName, objectName, uploadID, partNumber, reader, size, opts)
+}
+
+func (m *MinioClientWrapper) ListObjectParts(ctx context.Context, bucketName, objectName, uploadID string, partNumberMarker, maxParts int) (minio.ListObjectPartsResult, error) {
+	return m.core.ListObjectParts(ctx, bucketName, objectName, uploadID, partNumberMarker, maxParts)
+}
+
+func (m *MinioClientWrapper) CompleteMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string, parts []minio.CompletePart, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	return m.core.CompleteMultipartUpload(ctx, bucketName, objectName, uploadID, parts, opts)
+}
+
+func (m *MinioClientWrapper) AbortMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string) error {
+	return m.core.AbortMultipartUpload(ctx, bucketName, objectName, uploadID)
+}
+
+func (m *MinioClientWrapper) ListIncompleteUploads(ctx context.Context, bucketName, objectPrefix string, recursive bool) <-chan minio.ObjectMultipartInfo {
+	return m.client.ListIncompleteUploads(ctx, bucketName, objectPrefix, recursive)
+}
@@ -174,4 +174,32 @@ func TestMinioAdapter(t *testing.T) {
 		mockClient.AssertExpectations(t)
 	})
 
+	t.Run("StatObject", func(t *testing.T) {
+		info := minioGo.ObjectInfo{Key: "object1", Size: 12, ContentType: "text/plain"}
+		mockClient.On("StatObject", mock.Anything, "bucket1", "object1", mock.Anything).Return(info, nil)
+		mockClient.On("StatObject", mock.Anything, "bucket1", "missing", mock.Anything).Return(minioGo.ObjectInfo{}, minioGo.ErrorResponse{Code: "NoSuchKey"})
+
+		got, err := adapter.StatObject(context.Background(), "bucket1", "object1", minioGo.StatObjectOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, info, got)
+
+		_, err = adapter.StatObject(context.Background(), "bucket1", "missing", minioGo.StatObjectOptions{})
+		assert.Equal(t, "NoSuchKey", minioGo.ToErrorResponse(err).Code)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("ListObjects", func(t *testing.T) {
+		objects := []minioGo.ObjectInfo{{Key: "object1"}, {Key: "object2"}}
+		mockClient.On("ListObjects", mock.Anything, "bucket1", mock.Anything).Return(objects)
+
+		var keys []string
+		for object := range adapter.ListObjects(context.Background(), "bucket1", minioGo.ListObjectsOptions{}) {
+			assert.NoError(t, object.Err)
+			keys = append(keys, object.Key)
+		}
+
+		assert.Equal(t, []string{"object1", "object2"}, keys)
+		mockClient.AssertExpectations(t)
+	})
 }
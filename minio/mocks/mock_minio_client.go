@@ -3,8 +3,12 @@ package mocks
 import (
 	"context"
 	"io"
+	"net/url"
+	"time"
 
 	minioGo "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/tags"
 	"github.com/stretchr/testify/mock"
 
 	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
@@ -30,6 +34,33 @@ func (m *MockMinioClient) RemoveBucket(ctx context.Context, bucketName string) e
 	return args.Error(0)
 }
 
+func (m *MockMinioClient) ListBuckets(ctx context.Context) ([]minioGo.BucketInfo, error) {
+	args := m.Called(ctx)
+	buckets, _ := args.Get(0).([]minioGo.BucketInfo)
+	return buckets, args.Error(1)
+}
+
+func (m *MockMinioClient) SetBucketVersioning(ctx context.Context, bucketName string, config minioGo.BucketVersioningConfiguration) error {
+	args := m.Called(ctx, bucketName, config)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) GetBucketVersioning(ctx context.Context, bucketName string) (minioGo.BucketVersioningConfiguration, error) {
+	args := m.Called(ctx, bucketName)
+	return args.Get(0).(minioGo.BucketVersioningConfiguration), args.Error(1)
+}
+
+func (m *MockMinioClient) SetBucketLifecycle(ctx context.Context, bucketName string, config *lifecycle.Configuration) error {
+	args := m.Called(ctx, bucketName, config)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) GetBucketLifecycle(ctx context.Context, bucketName string) (*lifecycle.Configuration, error) {
+	args := m.Called(ctx, bucketName)
+	config, _ := args.Get(0).(*lifecycle.Configuration)
+	return config, args.Error(1)
+}
+
 func (m *MockMinioClient) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minioGo.PutObjectOptions) (minioGo.UploadInfo, error) {
 	args := m.Called(ctx, bucketName, objectName, reader, objectSize, opts)
 	return args.Get(0).(minioGo.UploadInfo), args.Error(1)
@@ -41,7 +72,165 @@ func (m *MockMinioClient) GetObject(ctx context.Context, bucketName, objectName
 	return obj, args.Error(1)
 }
 
+func (m *MockMinioClient) StatObject(ctx context.Context, bucketName, objectName string, opts minioGo.StatObjectOptions) (minioGo.ObjectInfo, error) {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	return args.Get(0).(minioGo.ObjectInfo), args.Error(1)
+}
+
+func (m *MockMinioClient) CopyObject(ctx context.Context, dst minioGo.CopyDestOptions, src minioGo.CopySrcOptions) (minioGo.UploadInfo, error) {
+	args := m.Called(ctx, dst, src)
+	return args.Get(0).(minioGo.UploadInfo), args.Error(1)
+}
+
 func (m *MockMinioClient) RemoveObject(ctx context.Context, bucketName, objectName string, opts minioGo.RemoveObjectOptions) error {
 	args := m.Called(ctx, bucketName, objectName, opts)
 	return args.Error(0)
 }
+
+// ListObjects returns a channel fed from the []ObjectInfo given to Return.
+func (m *MockMinioClient) ListObjects(ctx context.Context, bucketName string, opts minioGo.ListObjectsOptions) <-chan minioGo.ObjectInfo {
+	args := m.Called(ctx, bucketName, opts)
+	objects, _ := args.Get(0).([]minioGo.ObjectInfo)
+	ch := make(chan minioGo.ObjectInfo, len(objects))
+	for _, object := range objects {
+		ch <- object
+	}
+	close(ch)
+	return ch
+}
+
+// RemoveObjects drains objectsCh and records the call with the names of the
+// objects received. The []RemoveObjectError given to Return feeds the result.
+func (m *MockMinioClient) RemoveObjects(ctx context.Context, bucketName string, objectsCh <-chan minioGo.ObjectInfo, opts minioGo.RemoveObjectsOptions) <-chan minioGo.RemoveObjectError {
+	var names []string
+	for object := range objectsCh {
+		names = append(names, object.Key)
+	}
+	args := m.Called(ctx, bucketName, names, opts)
+	results, _ := args.Get(0).([]minioGo.RemoveObjectError)
+	ch := make(chan minioGo.RemoveObjectError, len(results))
+	for _, result := range results {
+		ch <- result
+	}
+	close(ch)
+	return ch
+}
+
+// RemoveObjectsWithResult is recorded like RemoveObjects. The
+// []RemoveObjectResult given to Return feeds the result.
+func (m *MockMinioClient) RemoveObjectsWithResult(ctx context.Context, bucketName string, objectsCh <-chan minioGo.ObjectInfo, opts minioGo.RemoveObjectsOptions) <-chan minioGo.RemoveObjectResult {
+	var names []string
+	for object := range objectsCh {
+		names = append(names, object.Key)
+	}
+	args := m.Called(ctx, bucketName, names, opts)
+	results, _ := args.Get(0).([]minioGo.RemoveObjectResult)
+	ch := make(chan minioGo.RemoveObjectResult, len(results))
+	for _, result := range results {
+		ch <- result
+	}
+	close(ch)
+	return ch
+}
+
+func (m *MockMinioClient) GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minioGo.GetObjectTaggingOptions) (*tags.Tags, error) {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	t, _ := args.Get(0).(*tags.Tags)
+	return t, args.Error(1)
+}
+
+func (m *MockMinioClient) PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minioGo.PutObjectTaggingOptions) error {
+	args := m.Called(ctx, bucketName, objectName, otags, opts)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) RemoveObjectTagging(ctx context.Context, bucketName, objectName string, opts minioGo.RemoveObjectTaggingOptions) error {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) SetObjectLockConfig(ctx context.Context, bucketName string, mode *minioGo.RetentionMode, validity *uint, unit *minioGo.ValidityUnit) error {
+	args := m.Called(ctx, bucketName, mode, validity, unit)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) GetObjectLockConfig(ctx context.Context, bucketName string) (string, *minioGo.RetentionMode, *uint, *minioGo.ValidityUnit, error) {
+	args := m.Called(ctx, bucketName)
+	mode, _ := args.Get(1).(*minioGo.RetentionMode)
+	validity, _ := args.Get(2).(*uint)
+	unit, _ := args.Get(3).(*minioGo.ValidityUnit)
+	return args.String(0), mode, validity, unit, args.Error(4)
+}
+
+func (m *MockMinioClient) PutObjectRetention(ctx context.Context, bucketName, objectName string, opts minioGo.PutObjectRetentionOptions) error {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) GetObjectRetention(ctx context.Context, bucketName, objectName, versionID string) (*minioGo.RetentionMode, *time.Time, error) {
+	args := m.Called(ctx, bucketName, objectName, versionID)
+	mode, _ := args.Get(0).(*minioGo.RetentionMode)
+	retainUntilDate, _ := args.Get(1).(*time.Time)
+	return mode, retainUntilDate, args.Error(2)
+}
+
+func (m *MockMinioClient) PutObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minioGo.PutObjectLegalHoldOptions) error {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) GetObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minioGo.GetObjectLegalHoldOptions) (*minioGo.LegalHoldStatus, error) {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	status, _ := args.Get(0).(*minioGo.LegalHoldStatus)
+	return status, args.Error(1)
+}
+
+func (m *MockMinioClient) PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	args := m.Called(ctx, bucketName, objectName, expires, reqParams)
+	u, _ := args.Get(0).(*url.URL)
+	return u, args.Error(1)
+}
+
+func (m *MockMinioClient) PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (*url.URL, error) {
+	args := m.Called(ctx, bucketName, objectName, expires)
+	u, _ := args.Get(0).(*url.URL)
+	return u, args.Error(1)
+}
+
+func (m *MockMinioClient) NewMultipartUpload(ctx context.Context, bucketName, objectName string, opts minioGo.PutObjectOptions) (string, error) {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockMinioClient) PutObjectPart(ctx context.Context, bucketName, objectName, uploadID string, partNumber int, reader io.Reader, size int64, opts minioGo.PutObjectPartOptions) (minioGo.ObjectPart, error) {
+	args := m.Called(ctx, bucketName, objectName, uploadID, partNumber, reader, size, opts)
+	return args.Get(0).(minioGo.ObjectPart), args.Error(1)
+}
+
+func (m *MockMinioClient) ListObjectParts(ctx context.Context, bucketName, objectName, uploadID string, partNumberMarker, maxParts int) (minioGo.ListObjectPartsResult, error) {
+	args := m.Called(ctx, bucketName, objectName, uploadID, partNumberMarker, maxParts)
+	return args.Get(0).(minioGo.ListObjectPartsResult), args.Error(1)
+}
+
+func (m *MockMinioClient) CompleteMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string, parts []minioGo.CompletePart, opts minioGo.PutObjectOptions) (minioGo.UploadInfo, error) {
+	args := m.Called(ctx, bucketName, objectName, uploadID, parts, opts)
+	return args.Get(0).(minioGo.UploadInfo), args.Error(1)
+}
+
+func (m *MockMinioClient) AbortMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string) error {
+	args := m.Called(ctx, bucketName, objectName, uploadID)
+	return args.Error(0)
+}
+
+// ListIncompleteUploads returns a channel fed from the
+// []ObjectMultipartInfo given to Return.
+func (m *MockMinioClient) ListIncompleteUploads(ctx context.Context, bucketName, objectPrefix string, recursive bool) <-chan minioGo.ObjectMultipartInfo {
+	args := m.Called(ctx, bucketName, objectPrefix, recursive)
+	uploads, _ := args.Get(0).([]minioGo.ObjectMultipartInfo)
+	ch := make(chan minioGo.ObjectMultipartInfo, len(uploads))
+	for _, upload := range uploads {
+		ch <- upload
+	}
+	close(ch)
+	return ch
+}
@@ -0,0 +1,388 @@
+package minio
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+var retryAttempts = expvar.NewMap("minio_retries")
+
+type RetryPolicy struct {
+	// MaxAttempts includes the first call.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// BudgetRatio is the fraction of calls that may be retried. Every call
+	// earns BudgetRatio tokens, every retry spends one, and at most
+	// BudgetBurst tokens are banked.
+	BudgetRatio float64
+	BudgetBurst float64
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    time.Second,
+		BudgetRatio: 0.1,
+		BudgetBurst: 10,
+	}
+}
+
+// backoff returns a full-jitter exponential delay for the given retry (1-based).
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.BaseDelay << (retry - 1)
+	if ceiling <= 0 || ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	ratio  float64
+	burst  float64
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type retryClient struct {
+	client MinioClientInterface
+	policy RetryPolicy
+	budget *retryBudget
+}
+
+// NewRetryClient retries idempotent calls to client on transient backend
+// errors, see IsBackendFailure.
+func NewRetryClient(client MinioClientInterface, policy RetryPolicy) MinioClientInterface {
+	return &retryClient{
+		client: client,
+		policy: policy,
+		budget: &retryBudget{tokens: policy.BudgetBurst, ratio: policy.BudgetRatio, burst: policy.BudgetBurst},
+	}
+}
+
+func (c *retryClient) retry(ctx context.Context, op string, fn func(attempt int) error) error {
+	c.budget.deposit()
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(attempt)
+		if !IsBackendFailure(err) || attempt >= c.policy.MaxAttempts || !c.budget.withdraw() {
+			return err
+		}
+		retryAttempts.Add(op, 1)
+		timer := time.NewTimer(c.policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *retryClient) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	return c.retry(ctx, "MakeBucket", func(attempt int) error {
+		err := c.client.MakeBucket(ctx, bucketName, opts)
+		// An earlier attempt may have succeeded without us seeing the response.
+		if attempt > 1 && minio.ToErrorResponse(err).Code == "BucketAlreadyOwnedByYou" {
+			return nil
+		}
+		return err
+	})
+}
+
+func (c *retryClient) BucketExists(ctx context.Context, bucketName string) (exists bool, err error) {
+	err = c.retry(ctx, "BucketExists", func(int) error {
+		exists, err = c.client.BucketExists(ctx, bucketName)
+		return err
+	})
+	return exists, err
+}
+
+func (c *retryClient) RemoveBucket(ctx context.Context, bucketName string) error {
+	return c.client.RemoveBucket(ctx, bucketName)
+}
+
+func (c *retryClient) ListBuckets(ctx context.Context) (buckets []minio.BucketInfo, err error) {
+	err = c.retry(ctx, "ListBuckets", func(int) error {
+		buckets, err = c.client.ListBuckets(ctx)
+		return err
+	})
+	return buckets, err
+}
+
+func (c *retryClient) SetBucketVersioning(ctx context.Context, bucketName string, config minio.BucketVersioningConfiguration) error {
+	return c.retry(ctx, "SetBucketVersioning", func(int) error {
+		return c.client.SetBucketVersioning(ctx, bucketName, config)
+	})
+}
+
+func (c *retryClient) GetBucketVersioning(ctx context.Context, bucketName string) (config minio.BucketVersioningConfiguration, err error) {
+	err = c.retry(ctx, "GetBucketVersioning", func(int) error {
+		config, err = c.client.GetBucketVersioning(ctx, bucketName)
+		return err
+	})
+	return config, err
+}
+
+func (c *retryClient) SetBucketLifecycle(ctx context.Context, bucketName string, config *lifecycle.Configuration) error {
+	return c.retry(ctx, "SetBucketLifecycle", func(int) error {
+		return c.client.SetBucketLifecycle(ctx, bucketName, config)
+	})
+}
+
+func (c *retryClient) GetBucketLifecycle(ctx context.Context, bucketName string) (config *lifecycle.Configuration, err error) {
+	err = c.retry(ctx, "GetBucketLifecycle", func(int) error {
+		config, err = c.client.GetBucketLifecycle(ctx, bucketName)
+		return err
+	})
+	return config, err
+}
+
+// PutObject is only retried when reader can be rewound to where it started.
+func (c *retryClient) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (info minio.UploadInfo, err error) {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return c.client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return c.client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+	}
+	err = c.retry(ctx, "PutObject", func(attempt int) error {
+		if attempt > 1 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		info, err = c.client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+		return err
+	})
+	return info, err
+}
+
+// GetObject stats the object before returning it. minio-go opens objects
+// lazily, and the stat is what actually issues the GET, so this is where
+// transient errors surface.
+func (c *retryClient) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (object MinioObject, err error) {
+	err = c.retry(ctx, "GetObject", func(int) error {
+		object, err = c.client.GetObject(ctx, bucketName, objectName, opts)
+		if err != nil {
+			return err
+		}
+		if _, err = object.Stat(); err != nil {
+			object.Close()
+			object = nil
+		}
+		return err
+	})
+	return object, err
+}
+
+func (c *retryClient) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (info minio.ObjectInfo, err error) {
+	err = c.retry(ctx, "StatObject", func(int) error {
+		info, err = c.client.StatObject(ctx, bucketName, objectName, opts)
+		return err
+	})
+	return info, err
+}
+
+// CopyObject is retried, copying the same source again is harmless.
+func (c *retryClient) CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (info minio.UploadInfo, err error) {
+	err = c.retry(ctx, "CopyObject", func(int) error {
+		info, err = c.client.CopyObject(ctx, dst, src)
+		return err
+	})
+	return info, err
+}
+
+func (c *retryClient) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	return c.retry(ctx, "RemoveObject", func(int) error {
+		return c.client.RemoveObject(ctx, bucketName, objectName, opts)
+	})
+}
+
+// ListObjects is not retried: a listing may already have been partially
+// consumed by the time an error shows up in the stream.
+func (c *retryClient) ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	return c.client.ListObjects(ctx, bucketName, opts)
+}
+
+// RemoveObjects is not retried: the objects to remove are consumed from the
+// caller's channel and cannot be replayed.
+func (c *retryClient) RemoveObjects(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+	return c.client.RemoveObjects(ctx, bucketName, objectsCh, opts)
+}
+
+// RemoveObjectsWithResult is not retried, like RemoveObjects.
+func (c *retryClient) RemoveObjectsWithResult(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectResult {
+	return c.client.RemoveObjectsWithResult(ctx, bucketName, objectsCh, opts)
+}
+
+func (c *retryClient) GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (t *tags.Tags, err error) {
+	err = c.retry(ctx, "GetObjectTagging", func(int) error {
+		t, err = c.client.GetObjectTagging(ctx, bucketName, objectName, opts)
+		return err
+	})
+	return t, err
+}
+
+// PutObjectTagging replaces the whole tag set, so repeating it is harmless.
+func (c *retryClient) PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error {
+	return c.retry(ctx, "PutObjectTagging", func(int) error {
+		return c.client.PutObjectTagging(ctx, bucketName, objectName, otags, opts)
+	})
+}
+
+func (c *retryClient) RemoveObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectTaggingOptions) error {
+	return c.retry(ctx, "RemoveObjectTagging", func(int) error {
+		return c.client.RemoveObjectTagging(ctx, bucketName, objectName, opts)
+	})
+}
+
+func (c *retryClient) SetObjectLockConfig(ctx context.Context, bucketName string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit) error {
+	return c.retry(ctx, "SetObjectLockConfig", func(int) error {
+		return c.client.SetObjectLockConfig(ctx, bucketName, mode, validity, unit)
+	})
+}
+
+func (c *retryClient) GetObjectLockConfig(ctx context.Context, bucketName string) (objectLock string, mode *minio.RetentionMode, validity *uint, unit *minio.ValidityUnit, err error) {
+	err = c.retry(ctx, "GetObjectLockConfig", func(int) error {
+		objectLock, mode, validity, unit, err = c.client.GetObjectLockConfig(ctx, bucketName)
+		return err
+	})
+	return objectLock, mode, validity, unit, err
+}
+
+func (c *retryClient) PutObjectRetention(ctx context.Context, bucketName, objectName string, opts minio.PutObjectRetentionOptions) error {
+	return c.retry(ctx, "PutObjectRetention", func(int) error {
+		return c.client.PutObjectRetention(ctx, bucketName, objectName, opts)
+	})
+}
+
+func (c *retryClient) GetObjectRetention(ctx context.Context, bucketName, objectName, versionID string) (mode *minio.RetentionMode, retainUntilDate *time.Time, err error) {
+	err = c.retry(ctx, "GetObjectRetention", func(int) error {
+		mode, retainUntilDate, err = c.client.GetObjectRetention(ctx, bucketName, objectName, versionID)
+		return err
+	})
+	return mode, retainUntilDate, err
+}
+
+func (c *retryClient) PutObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minio.PutObjectLegalHoldOptions) error {
+	return c.retry(ctx, "PutObjectLegalHold", func(int) error {
+		return c.client.PutObjectLegalHold(ctx, bucketName, objectName, opts)
+	})
+}
+
+func (c *retryClient) GetObjectLegalHold(ctx context.Context, bucketName, objectName string, opts minio.GetObjectLegalHoldOptions) (status *minio.LegalHoldStatus, err error) {
+	err = c.retry(ctx, "GetObjectLegalHold", func(int) error {
+		status, err = c.client.GetObjectLegalHold(ctx, bucketName, objectName, opts)
+		return err
+	})
+	return status, err
+}
+
+func (c *retryClient) PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (u *url.URL, err error) {
+	err = c.retry(ctx, "PresignedGetObject", func(int) error {
+		u, err = c.client.PresignedGetObject(ctx, bucketName, objectName, expires, reqParams)
+		return err
+	})
+	return u, err
+}
+
+func (c *retryClient) PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (u *url.URL, err error) {
+	err = c.retry(ctx, "PresignedPutObject", func(int) error {
+		u, err = c.client.PresignedPutObject(ctx, bucketName, objectName, expires)
+		return err
+	})
+	return u, err
+}
+
+// NewMultipartUpload is not retried: every attempt would start a new upload.
+func (c *retryClient) NewMultipartUpload(ctx context.Context, bucketName, objectName string, opts minio.PutObjectOptions) (string, error) {
+	return c.client.NewMultipartUpload(ctx, bucketName, objectName, opts)
+}
+
+// PutObjectPart replaces the part on every attempt, so like PutObject it is
+// retried whenever reader can be rewound.
+func (c *retryClient) PutObjectPart(ctx context.Context, bucketName, objectName, uploadID string, partNumber int, reader io.Reader, size int64, opts minio.PutObjectPartOptions) (part minio.ObjectPart, err error) {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return c.client.PutObjectPart(ctx, bucketName, objectName, uploadID, partNumber, reader, size, opts)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return c.client.PutObjectPart(ctx, bucketName, objectName, uploadID, partNumber, reader, size, opts)
+	}
+	err = c.retry(ctx, "PutObjectPart", func(attempt int) error {
+		if attempt > 1 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		part, err = c.client.PutObjectPart(ctx, bucketName, objectName, uploadID, partNumber, reader, size, opts)
+		return err
+	})
+	return part, err
+}
+
+func (c *retryClient) ListObjectParts(ctx context.Context, bucketName, objectName, uploadID string, partNumberMarker, maxParts int) (result minio.ListObjectPartsResult, err error) {
+	err = c.retry(ctx, "ListObjectParts", func(int) error {
+		result, err = c.client.ListObjectParts(ctx, bucketName, objectName, uploadID, partNumberMarker, maxParts)
+		return err
+	})
+	return result, err
+}
+
+// CompleteMultipartUpload is not retried: once it has succeeded the upload
+// is gone, and a retry could only fail with NoSuchUpload.
+func (c *retryClient) CompleteMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string, parts []minio.CompletePart, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	return c.client.CompleteMultipartUpload(ctx, bucketName, objectName, uploadID, parts, opts)
+}
+
+func (c *retryClient) AbortMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string) error {
+	return c.retry(ctx, "AbortMultipartUpload", func(attempt int) error {
+		err := c.client.AbortMultipartUpload(ctx, bucketName, objectName, uploadID)
+		// An earlier attempt may have succeeded without us seeing the response.
+		if attempt > 1 && minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+			return nil
+		}
+		return err
+	})
+}
+
+// ListIncompleteUploads is not retried, for the same reason as ListObjects.
+func (c *retryClient) ListIncompleteUploads(ctx context.Context, bucketName, objectPrefix string, recursive bool) <-chan minio.ObjectMultipartInfo {
+	return c.client.ListIncompleteUploads(ctx, bucketName, objectPrefix, recursive)
+}
@@ -0,0 +1,163 @@
+package minio_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	minioGo "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	minio_adapter "github.com/spacelift-io/homework-object-storage/minio"
+	"github.com/spacelift-io/homework-object-storage/minio/mocks"
+)
+
+func testRetryPolicy() minio_adapter.RetryPolicy {
+	return minio_adapter.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+		BudgetRatio: 0.1,
+		BudgetBurst: 10,
+	}
+}
+
+func TestRetryClient(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Retries transient errors", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, testRetryPolicy())
+		mockClient.On("BucketExists", mock.Anything, "bucket").Return(false, errors.New("connection reset by peer")).Once()
+		mockClient.On("BucketExists", mock.Anything, "bucket").Return(false, minioGo.ErrorResponse{Code: "SlowDown", StatusCode: 503}).Once()
+		mockClient.On("BucketExists", mock.Anything, "bucket").Return(true, nil).Once()
+
+		exists, err := client.BucketExists(ctx, "bucket")
+
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("Gives up after max attempts", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, testRetryPolicy())
+		mockClient.On("RemoveObject", mock.Anything, "bucket", "object", mock.Anything).
+			Return(minioGo.ErrorResponse{Code: "InternalError", StatusCode: 500}).Times(3)
+
+		err := client.RemoveObject(ctx, "bucket", "object", minioGo.RemoveObjectOptions{})
+
+		assert.Equal(t, "InternalError", minioGo.ToErrorResponse(err).Code)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("Does not retry client errors", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, testRetryPolicy())
+		mockClient.On("RemoveObject", mock.Anything, "bucket", "object", mock.Anything).
+			Return(minioGo.ErrorResponse{Code: "NoSuchKey", StatusCode: 404}).Once()
+
+		err := client.RemoveObject(ctx, "bucket", "object", minioGo.RemoveObjectOptions{})
+
+		assert.Equal(t, "NoSuchKey", minioGo.ToErrorResponse(err).Code)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("Does not retry an open circuit", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, testRetryPolicy())
+		mockClient.On("BucketExists", mock.Anything, "bucket").Return(false, minio_adapter.ErrCircuitOpen).Once()
+
+		_, err := client.BucketExists(ctx, "bucket")
+
+		assert.ErrorIs(t, err, minio_adapter.ErrCircuitOpen)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("Retry budget caps retries", func(t *testing.T) {
+		policy := testRetryPolicy()
+		policy.BudgetBurst = 1
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, policy)
+		mockClient.On("BucketExists", mock.Anything, "bucket").Return(false, errors.New("connection refused"))
+
+		client.BucketExists(ctx, "bucket")
+		client.BucketExists(ctx, "bucket")
+
+		// Two attempts for the first call, then the budget is spent.
+		mockClient.AssertNumberOfCalls(t, "BucketExists", 3)
+	})
+
+	t.Run("MakeBucket treats an already owned bucket on retry as success", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, testRetryPolicy())
+		mockClient.On("MakeBucket", mock.Anything, "bucket", mock.Anything).Return(errors.New("i/o timeout")).Once()
+		mockClient.On("MakeBucket", mock.Anything, "bucket", mock.Anything).
+			Return(minioGo.ErrorResponse{Code: "BucketAlreadyOwnedByYou", StatusCode: 409}).Once()
+
+		err := client.MakeBucket(ctx, "bucket", minioGo.MakeBucketOptions{})
+
+		assert.NoError(t, err)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("PutObject with a replayable body is rewound", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, testRetryPolicy())
+		var bodies []string
+		mockClient.On("PutObject", mock.Anything, "bucket", "object", mock.Anything, int64(4), mock.Anything).
+			Run(func(args mock.Arguments) {
+				body, _ := io.ReadAll(args.Get(3).(io.Reader))
+				bodies = append(bodies, string(body))
+			}).Return(minioGo.UploadInfo{}, errors.New("broken pipe")).Once()
+		mockClient.On("PutObject", mock.Anything, "bucket", "object", mock.Anything, int64(4), mock.Anything).
+			Run(func(args mock.Arguments) {
+				body, _ := io.ReadAll(args.Get(3).(io.Reader))
+				bodies = append(bodies, string(body))
+			}).Return(minioGo.UploadInfo{Size: 4}, nil).Once()
+
+		info, err := client.PutObject(ctx, "bucket", "object", bytes.NewReader([]byte("data")), 4, minioGo.PutObjectOptions{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), info.Size)
+		assert.Equal(t, []string{"data", "data"}, bodies)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("PutObject with a streamed body is not retried", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, testRetryPolicy())
+		mockClient.On("PutObject", mock.Anything, "bucket", "object", mock.Anything, int64(-1), mock.Anything).
+			Return(minioGo.UploadInfo{}, errors.New("broken pipe")).Once()
+
+		_, err := client.PutObject(ctx, "bucket", "object", io.NopCloser(strings.NewReader("data")), -1, minioGo.PutObjectOptions{})
+
+		assert.EqualError(t, err, "broken pipe")
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("GetObject retries errors surfaced by the first stat", func(t *testing.T) {
+		mockClient := new(mocks.MockMinioClient)
+		client := minio_adapter.NewRetryClient(mockClient, testRetryPolicy())
+
+		failing := new(mocks.MockMinioObject)
+		failing.On("Stat").Return(minioGo.ObjectInfo{}, errors.New("connection reset by peer"))
+		failing.On("Close").Return(nil)
+		healthy := new(mocks.MockMinioObject)
+		healthy.On("Stat").Return(minioGo.ObjectInfo{Size: 4}, nil)
+		mockClient.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Return(failing, nil).Once()
+		mockClient.On("GetObject", mock.Anything, "bucket", "object", mock.Anything).Return(healthy, nil).Once()
+
+		object, err := client.GetObject(ctx, "bucket", "object", minioGo.GetObjectOptions{})
+
+		assert.NoError(t, err)
+		assert.Same(t, healthy, object)
+		failing.AssertExpectations(t)
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,175 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid share token")
+	ErrExpired      = errors.New("share token expired")
+)
+
+// minKeySize is the shortest secret accepted for signing.
+const minKeySize = 32
+
+// Key is a secret used to sign share tokens, identified by ID so tokens can
+// name the key they were signed with.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Claims is what a share token grants access to.
+type Claims struct {
+	KeyID     string `json:"kid"`
+	Bucket    string `json:"b"`
+	ID        string `json:"id"`
+	ExpiresAt int64  `json:"exp"`
+	// MaxDownloads is zero for unlimited downloads. Limited tokens carry a
+	// Nonce identifying their download counter.
+	MaxDownloads int    `json:"max,omitempty"`
+	Nonce        string `json:"n,omitempty"`
+	// AllowedCIDR restricts downloads to clients in the range, if set.
+	AllowedCIDR string `json:"cidr,omitempty"`
+}
+
+// AllowsIP reports whether ip may use the token.
+func (c Claims) AllowsIP(ip net.IP) bool {
+	if c.AllowedCIDR == "" {
+		return true
+	}
+	_, network, err := net.ParseCIDR(c.AllowedCIDR)
+	if err != nil || ip == nil {
+		return false
+	}
+	return network.Contains(ip)
+}
+
+// Signer mints and verifies share tokens. The first key signs new tokens,
+// the others remain valid for verification so keys can be rotated without
+// invalidating links already handed out.
+type Signer struct {
+	keys []Key
+}
+
+func NewSigner(keys []Key) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one key is required")
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if key.ID == "" || strings.ContainsAny(key.ID, ".,:") {
+			return nil, fmt.Errorf("invalid key ID %q", key.ID)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		if len(key.Secret) < minKeySize {
+			return nil, fmt.Errorf("key %q must be at least %d bytes", key.ID, minKeySize)
+		}
+		seen[key.ID] = true
+	}
+	return &Signer{keys: keys}, nil
+}
+
+// ParseKeys parses a comma separated list of id:base64-secret pairs, the
+// signing key first.
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("key %q must have the form id:secret", entry)
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64", id)
+		}
+		keys = append(keys, Key{ID: id, Secret: secret})
+	}
+	return keys, nil
+}
+
+// GenerateKey returns a random key with the given ID.
+func GenerateKey(id string) (Key, error) {
+	secret := make([]byte, minKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+	return Key{ID: id, Secret: secret}, nil
+}
+
+// NewNonce returns a random identifier for a download counter.
+func NewNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", nonce), nil
+}
+
+// Sign returns a token for claims, signed with the current key. The token is
+// the base64url encoded claims and their HMAC-SHA256, separated by a dot.
+func (s *Signer) Sign(claims Claims) (string, error) {
+	key := s.keys[0]
+	claims.KeyID = key.ID
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac(key.Secret, encoded)), nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+func (s *Signer) Verify(token string, now time.Time) (Claims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	key, ok := s.key(claims.KeyID)
+	if !ok || !hmac.Equal(sum, mac(key.Secret, encoded)) {
+		return Claims{}, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, ErrExpired
+	}
+	return claims, nil
+}
+
+func (s *Signer) key(id string) (Key, bool) {
+	for _, key := range s.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+func mac(secret []byte, payload string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
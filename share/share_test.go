@@ -0,0 +1,116 @@
+package share
+
+import (
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(id string) Key {
+	return Key{ID: id, Secret: []byte(strings.Repeat(id, minKeySize))}
+}
+
+func TestSigner(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	claims := Claims{Bucket: "photos", ID: "abc123", ExpiresAt: now.Add(time.Hour).Unix(), MaxDownloads: 3, Nonce: "n1"}
+
+	signer, err := NewSigner([]Key{testKey("a")})
+	require.NoError(t, err)
+	token, err := signer.Sign(claims)
+	require.NoError(t, err)
+
+	t.Run("Round trip", func(t *testing.T) {
+		got, err := signer.Verify(token, now)
+		assert.NoError(t, err)
+		claims.KeyID = "a"
+		assert.Equal(t, claims, got)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		_, err := signer.Verify(token, now.Add(time.Hour))
+		assert.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("Tampered claims", func(t *testing.T) {
+		payload, signature, _ := strings.Cut(token, ".")
+		decoded, _ := base64.RawURLEncoding.DecodeString(payload)
+		tampered := strings.Replace(string(decoded), `"max":3`, `"max":300`, 1)
+		_, err := signer.Verify(base64.RawURLEncoding.EncodeToString([]byte(tampered))+"."+signature, now)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		for _, token := range []string{"", "abc", "a.b", "!!.!!"} {
+			_, err := signer.Verify(token, now)
+			assert.ErrorIs(t, err, ErrInvalidToken, token)
+		}
+	})
+
+	t.Run("Rotated keys still verify", func(t *testing.T) {
+		rotated, err := NewSigner([]Key{testKey("b"), testKey("a")})
+		require.NoError(t, err)
+		_, err = rotated.Verify(token, now)
+		assert.NoError(t, err)
+
+		newToken, err := rotated.Sign(claims)
+		require.NoError(t, err)
+		got, err := rotated.Verify(newToken, now)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", got.KeyID)
+
+		_, err = signer.Verify(newToken, now)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Retired keys no longer verify", func(t *testing.T) {
+		retired, err := NewSigner([]Key{testKey("b")})
+		require.NoError(t, err)
+		_, err = retired.Verify(token, now)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestNewSigner(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []Key
+		err  string
+	}{
+		{"No keys", nil, "at least one key is required"},
+		{"Short secret", []Key{{ID: "a", Secret: []byte("short")}}, `key "a" must be at least 32 bytes`},
+		{"Duplicate ID", []Key{testKey("a"), testKey("a")}, `duplicate key ID "a"`},
+		{"Invalid ID", []Key{testKey("a.b")}, `invalid key ID "a.b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSigner(tt.keys)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString([]byte("secret"))
+	keys, err := ParseKeys("new:" + secret + ", old:" + secret)
+	assert.NoError(t, err)
+	assert.Equal(t, []Key{{ID: "new", Secret: []byte("secret")}, {ID: "old", Secret: []byte("secret")}}, keys)
+
+	_, err = ParseKeys("missing-secret")
+	assert.Error(t, err)
+	_, err = ParseKeys("a:not base64")
+	assert.Error(t, err)
+}
+
+func TestClaimsAllowsIP(t *testing.T) {
+	assert.True(t, Claims{}.AllowsIP(net.ParseIP("203.0.113.7")))
+
+	claims := Claims{AllowedCIDR: "10.0.0.0/8"}
+	assert.True(t, claims.AllowsIP(net.ParseIP("10.1.2.3")))
+	assert.False(t, claims.AllowsIP(net.ParseIP("203.0.113.7")))
+	assert.False(t, claims.AllowsIP(nil))
+}